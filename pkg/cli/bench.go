@@ -0,0 +1,359 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	benchEnvFlags    []string
+	benchInputFlags  []string
+	benchInputJSON   string
+	benchPredictions int
+	benchConcurrency int
+	benchFormat      string
+)
+
+func newBenchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench [image]",
+		Short: "Measure the latency and throughput of a model",
+		Long: `Measure the latency and throughput of a model.
+
+Starts the model, measuring how long it takes to be ready, then runs a number of
+predictions with the same inputs and reports their latency, throughput and
+error rate.
+
+If 'image' is passed, it will benchmark that Docker image.
+Otherwise, it will build the model in the current directory.`,
+		RunE: cmdBench,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+	addConfigFlag(cmd)
+
+	cmd.Flags().StringArrayVarP(&benchInputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	cmd.Flags().StringVar(&benchInputJSON, "json", "", "Pass inputs as JSON object, read from file (@inputs.json) or via stdin (@-)")
+	cmd.Flags().StringArrayVarP(&benchEnvFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().IntVarP(&benchPredictions, "predictions", "n", 10, "Number of predictions to run")
+	cmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 0, "Number of predictions to run at once (default: concurrency.max in cog.yaml, or 1)")
+	cmd.Flags().StringVar(&benchFormat, "format", "table", "Output format: 'table' or 'json'")
+
+	return cmd
+}
+
+// benchReport is the result of a benchmark. Durations are in seconds.
+type benchReport struct {
+	Image        string       `json:"image"`
+	SetupSeconds float64      `json:"setup_seconds"`
+	Predictions  int          `json:"predictions"`
+	Concurrency  int          `json:"concurrency"`
+	Succeeded    int          `json:"succeeded"`
+	Failed       int          `json:"failed"`
+	ErrorRate    float64      `json:"error_rate"`
+	TotalSeconds float64      `json:"total_seconds"`
+	Throughput   float64      `json:"throughput"`
+	Latency      benchLatency `json:"latency_seconds"`
+}
+
+// benchLatency summarizes the latency of the predictions that succeeded.
+type benchLatency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+func cmdBench(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if benchFormat != "table" && benchFormat != "json" {
+		return fmt.Errorf("Invalid --format %q, expected 'table' or 'json'", benchFormat)
+	}
+	if benchInputJSON != "" && len(benchInputFlags) > 0 {
+		return fmt.Errorf("Must use one of --json or --input to provide model inputs")
+	}
+	if benchPredictions < 1 {
+		return fmt.Errorf("--predictions must be at least 1")
+	}
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	imageName := ""
+	volumes := []command.Volume{}
+	gpus := gpusFlag
+	concurrency := benchConcurrency
+
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(configFilename)
+		if err != nil {
+			return err
+		}
+		if concurrency == 0 && cfg.Concurrency != nil {
+			concurrency = cfg.Concurrency.Max
+		}
+
+		client := registry.NewRegistryClient()
+		if imageName, err = image.BuildBase(ctx, dockerClient, cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput, client, true); err != nil {
+			return err
+		}
+
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, command.Volume{
+			Source:      projectDir,
+			Destination: "/src",
+		})
+
+		if gpus == "" && cfg.Build.GPU {
+			gpus = "all"
+		}
+	} else {
+		imageName = args[0]
+
+		inspectResp, err := dockerClient.Pull(ctx, imageName, false)
+		if err != nil {
+			return fmt.Errorf("Failed to pull image %q: %w", imageName, err)
+		}
+
+		conf, err := image.CogConfigFromManifest(ctx, inspectResp)
+		if err != nil {
+			return err
+		}
+		if concurrency == 0 && conf.Concurrency != nil {
+			concurrency = conf.Concurrency.Max
+		}
+		if gpus == "" && conf.Build.GPU {
+			gpus = "all"
+		}
+	}
+	concurrency = max(concurrency, 1)
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	predictor, err := predict.NewPredictor(ctx, command.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     benchEnvFlags,
+	}, false, false, dockerClient)
+	if err != nil {
+		return err
+	}
+
+	handleInterrupts(ctx, func() *predict.Predictor { return predictor })
+
+	logsWriter := &muteWriter{w: os.Stderr}
+	setupStart := time.Now()
+	if err := predictor.Start(ctx, logsWriter, time.Duration(setupTimeout)*time.Second); err != nil {
+		return err
+	}
+	setup := time.Since(setupStart)
+	// Logs of the predictions would drown out the results
+	logsWriter.Mute()
+
+	defer func() {
+		console.Debugf("Stopping container...")
+		// use background context to ensure stop signal is still sent after root context is canceled
+		if err := predictor.Stop(context.Background()); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	console.Infof("Container ready in %.2fs", setup.Seconds())
+
+	inputs, err := benchInputs(predictor)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Running %d predictions with concurrency %d...", benchPredictions, concurrency)
+	latencies, failed, elapsed, err := runBenchPredictions(ctx, predictor, inputs, benchPredictions, concurrency)
+	if err != nil {
+		return err
+	}
+
+	report := newBenchReport(latencies, failed, elapsed)
+	report.Image = imageName
+	report.SetupSeconds = setup.Seconds()
+	report.Concurrency = concurrency
+
+	if benchFormat == "json" {
+		output, err := prettyJSONMarshal(report)
+		if err != nil {
+			return err
+		}
+		console.Output(string(output))
+		return nil
+	}
+	console.Output(report.table())
+	return nil
+}
+
+// benchInputs returns the inputs passed with --input or --json, checked against
+// the schema of the model.
+func benchInputs(predictor *predict.Predictor) (predict.Inputs, error) {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs predict.Inputs
+	if benchInputJSON != "" {
+		jsonInputs, err := parseJSONInput(benchInputJSON)
+		if err != nil {
+			return nil, err
+		}
+		if inputs, err = jsonToInputs(jsonInputs); err != nil {
+			return nil, err
+		}
+	} else if inputs, err = parseInputFlags(benchInputFlags, schema); err != nil {
+		return nil, err
+	}
+
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// runBenchPredictions runs n predictions, up to concurrency at a time, and
+// returns the latencies of those that succeeded, the number that failed and the
+// time it took to run them all.
+func runBenchPredictions(ctx context.Context, predictor *predict.Predictor, inputs predict.Inputs, n int, concurrency int) ([]time.Duration, int, time.Duration, error) {
+	latencies := []time.Duration{}
+	failed := 0
+	var mu sync.Mutex
+
+	start := time.Now()
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i := range n {
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			predictionStart := time.Now()
+			prediction, err := predictor.Predict(inputs, predict.RequestContext{})
+			latency := time.Since(predictionStart)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failed++
+				console.Warnf("[%d/%d] Prediction failed: %s", i+1, n, err)
+			case prediction.Status != "succeeded":
+				failed++
+				console.Warnf("[%d/%d] Prediction %s: %s", i+1, n, prediction.Status, prediction.Error)
+			default:
+				latencies = append(latencies, latency)
+				console.Debugf("[%d/%d] Prediction succeeded in %.2fs", i+1, n, latency.Seconds())
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, 0, 0, err
+	}
+	return latencies, failed, time.Since(start), nil
+}
+
+func newBenchReport(latencies []time.Duration, failed int, elapsed time.Duration) benchReport {
+	report := benchReport{
+		Predictions:  len(latencies) + failed,
+		Succeeded:    len(latencies),
+		Failed:       failed,
+		TotalSeconds: elapsed.Seconds(),
+	}
+	if report.Predictions > 0 {
+		report.ErrorRate = float64(failed) / float64(report.Predictions)
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Succeeded) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return report
+	}
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	report.Latency = benchLatency{
+		Min:  sorted[0].Seconds(),
+		Mean: (total / time.Duration(len(sorted))).Seconds(),
+		P50:  percentile(sorted, 50).Seconds(),
+		P90:  percentile(sorted, 90).Seconds(),
+		P99:  percentile(sorted, 99).Seconds(),
+		Max:  sorted[len(sorted)-1].Seconds(),
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank-1, 0), len(sorted)-1)]
+}
+
+func (r benchReport) table() string {
+	rows := [][2]string{
+		{"Image", r.Image},
+		{"Setup", fmt.Sprintf("%.2fs", r.SetupSeconds)},
+		{"Predictions", fmt.Sprintf("%d (%d succeeded, %d failed)", r.Predictions, r.Succeeded, r.Failed)},
+		{"Concurrency", fmt.Sprintf("%d", r.Concurrency)},
+		{"Error rate", fmt.Sprintf("%.1f%%", r.ErrorRate*100)},
+		{"Total time", fmt.Sprintf("%.2fs", r.TotalSeconds)},
+		{"Throughput", fmt.Sprintf("%.2f predictions/s", r.Throughput)},
+	}
+	if r.Succeeded > 0 {
+		rows = append(rows,
+			[2]string{"Latency min", fmt.Sprintf("%.3fs", r.Latency.Min)},
+			[2]string{"Latency mean", fmt.Sprintf("%.3fs", r.Latency.Mean)},
+			[2]string{"Latency p50", fmt.Sprintf("%.3fs", r.Latency.P50)},
+			[2]string{"Latency p90", fmt.Sprintf("%.3fs", r.Latency.P90)},
+			[2]string{"Latency p99", fmt.Sprintf("%.3fs", r.Latency.P99)},
+			[2]string{"Latency max", fmt.Sprintf("%.3fs", r.Latency.Max)},
+		)
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row[0]))
+	}
+	table := strings.Builder{}
+	for _, row := range rows {
+		fmt.Fprintf(&table, "%-*s  %s\n", width, row[0], row[1])
+	}
+	return strings.TrimSuffix(table.String(), "\n")
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBenchReport(t *testing.T) {
+	latencies := []time.Duration{}
+	for i := 10; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Second)
+	}
+
+	report := newBenchReport(latencies, 2, 20*time.Second)
+	require.Equal(t, 12, report.Predictions)
+	require.Equal(t, 10, report.Succeeded)
+	require.Equal(t, 2, report.Failed)
+	require.InDelta(t, 2.0/12, report.ErrorRate, 0.0001)
+	require.InDelta(t, 0.5, report.Throughput, 0.0001)
+	require.Equal(t, benchLatency{Min: 1, Mean: 5.5, P50: 5, P90: 9, P99: 10, Max: 10}, report.Latency)
+}
+
+func TestNewBenchReportAllFailed(t *testing.T) {
+	report := newBenchReport(nil, 3, time.Second)
+	require.Equal(t, 3, report.Predictions)
+	require.Equal(t, 1.0, report.ErrorRate)
+	require.Zero(t, report.Throughput)
+	require.Equal(t, benchLatency{}, report.Latency)
+	require.NotContains(t, report.table(), "Latency")
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/replicate/cog/pkg/coglog"
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/http"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/registry"
@@ -30,6 +32,13 @@ var buildStrip bool
 var buildPrecompile bool
 var buildFast bool
 var buildLocalImage bool
+var buildPlatform string
+var buildOutput string
+var buildBuilder string
+var buildBuilderTLSCA string
+var buildBuilderTLSCert string
+var buildBuilderTLSKey string
+var buildLocked bool
 var configFilename string
 
 const useCogBaseImageFlagKey = "use-cog-base-image"
@@ -57,14 +66,19 @@ func newBuildCommand() *cobra.Command {
 	addLocalImage(cmd)
 	addConfigFlag(cmd)
 	addPipelineImage(cmd)
+	addPlatformFlag(cmd)
+	addBuilderFlag(cmd)
+	addCacheFlags(cmd)
+	cmd.Flags().StringVar(&buildOutput, "output", "", "Also export the image to a tarball, in the form 'type=oci,dest=model.tar' or 'type=docker,dest=model.tar'. Needs Docker's containerd image store")
 	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().BoolVar(&buildLocked, "locked", false, "Build from the versions in "+config.LockFilename+", and fail if the build has drifted from them")
 	return cmd
 }
 
 func buildCommand(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
-	dockerClient, err := docker.NewClient(ctx)
+	dockerClient, err := docker.NewClient(ctx, builderOptions()...)
 	if err != nil {
 		return err
 	}
@@ -101,38 +115,144 @@ func buildCommand(cmd *cobra.Command, args []string) error {
 		logClient.EndBuild(ctx, err, logCtx)
 		return err
 	}
+	var output *command.ImageBuildOutput
+	if buildOutput != "" {
+		output, err = command.ParseImageBuildOutput(buildOutput)
+		if err != nil {
+			logClient.EndBuild(ctx, err, logCtx)
+			return err
+		}
+	}
+
 	registryClient := registry.NewRegistryClient()
-	if err := image.Build(
-		ctx,
-		cfg,
-		projectDir,
-		imageName,
-		buildSecrets,
-		buildNoCache,
-		buildSeparateWeights,
-		buildUseCudaBaseImage,
-		buildProgressOutput,
-		buildSchemaFile,
-		buildDockerfileFile,
-		DetermineUseCogBaseImage(cmd),
-		buildStrip,
-		buildPrecompile,
-		buildFast,
-		nil,
-		buildLocalImage,
-		dockerClient,
-		registryClient,
-		pipelinesImage); err != nil {
+	imageNames, err := buildImages(ctx, cmd, cfg, projectDir, imageName, nil, output, dockerClient, registryClient)
+	if err != nil {
 		logClient.EndBuild(ctx, err, logCtx)
 		return err
 	}
 
-	console.Infof("\nImage built as %s", imageName)
+	if output != nil {
+		console.Infof("\nImage %s exported to %s", imageName, output.Dest)
+		console.Infof("Run it with 'cog predict %s'", output.Dest)
+	} else if len(imageNames) == 1 {
+		console.Infof("\nImage built as %s", imageName)
+	} else {
+		console.Infof("\nImages built as %s", strings.Join(imageNames, ", "))
+		console.Infof("Push them as one multi-platform image with 'cog push --platform %s'", buildPlatform)
+	}
 	logClient.EndBuild(ctx, nil, logCtx)
 
 	return nil
 }
 
+// buildImages builds imageName for each platform in --platform and returns
+// the names of the images. With more than one platform, each is built as a
+// separate image named by image.PlatformImageName, because the local image
+// store holds one platform of an image. If output is set, the image is also
+// exported to it.
+func buildImages(ctx context.Context, cmd *cobra.Command, cfg *config.Config, projectDir string, imageName string, annotations map[string]string, output *command.ImageBuildOutput, dockerClient command.Command, registryClient registry.Client) ([]string, error) {
+	platforms, err := registry.ParsePlatforms(buildPlatform)
+	if err != nil {
+		return nil, err
+	}
+	if len(platforms) > 1 && (buildSeparateWeights || buildFast || buildLocalImage || pipelinesImage) {
+		return nil, fmt.Errorf("Images for more than one platform can't be built with --separate-weights, fast builds or pipelines")
+	}
+	if len(platforms) > 1 && output != nil {
+		return nil, fmt.Errorf("Images for more than one platform can't be exported with --output")
+	}
+	if output != nil && (buildFast || buildLocalImage) {
+		return nil, fmt.Errorf("Fast builds can't be exported with --output")
+	}
+	if output != nil {
+		supported, err := dockerClient.ImageExportSupported(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			return nil, fmt.Errorf("Docker can only export images with --output when it uses the containerd image store, see https://docs.docker.com/engine/storage/containerd/")
+		}
+	}
+	var lock *config.Lock
+	if buildLocked {
+		if len(platforms) > 1 {
+			return nil, fmt.Errorf("Images for more than one platform can't be built with --locked")
+		}
+		lock, err = config.ReadLock(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := lock.Check(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	imageNames := []string{}
+	for _, platform := range platforms {
+		name := imageName
+		if len(platforms) > 1 {
+			name, err = image.PlatformImageName(imageName, platform)
+			if err != nil {
+				return nil, err
+			}
+			console.Infof("Building for %s...", platform)
+		}
+		if err := image.Build(
+			ctx,
+			cfg,
+			projectDir,
+			name,
+			buildSecrets,
+			buildNoCache,
+			buildSeparateWeights,
+			buildUseCudaBaseImage,
+			buildProgressOutput,
+			buildSchemaFile,
+			buildDockerfileFile,
+			DetermineUseCogBaseImage(cmd),
+			buildStrip,
+			buildPrecompile,
+			buildFast,
+			annotations,
+			buildLocalImage,
+			dockerClient,
+			registryClient,
+			pipelinesImage,
+			platform,
+			output,
+			lock); err != nil {
+			return nil, err
+		}
+		imageNames = append(imageNames, name)
+	}
+	return imageNames, nil
+}
+
+func addPlatformFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildPlatform, "platform", registry.DefaultPlatform.String(), "Platforms to build the image for, separated by commas, e.g. linux/amd64,linux/arm64")
+}
+
+func addBuilderFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildBuilder, "builder", "", "Address of a BuildKit daemon to build the image on instead of Docker, like tcp://buildkitd:1234. Defaults to $BUILDKIT_HOST")
+	cmd.Flags().StringVar(&buildBuilderTLSCA, "builder-tls-ca", "", "CA certificate to verify the builder's certificate with, to connect to it over TLS")
+	cmd.Flags().StringVar(&buildBuilderTLSCert, "builder-tls-cert", "", "Client certificate to connect to the builder over TLS with")
+	cmd.Flags().StringVar(&buildBuilderTLSKey, "builder-tls-key", "", "Client key to connect to the builder over TLS with")
+}
+
+// builderOptions returns the options of the Docker client for the builder
+// flags.
+func builderOptions() []docker.Option {
+	return []docker.Option{
+		docker.WithBuilder(buildBuilder),
+		docker.WithBuilderTLS(buildBuilderTLSCA, buildBuilderTLSCert, buildBuilderTLSKey),
+	}
+}
+
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&config.BuildCacheFrom, "cache-from", []string{}, "Caches to build the image from, like 'type=registry,ref=registry.example.com/model:cache', 'type=local,src=path/to/dir' or an image")
+	cmd.Flags().StringArrayVar(&config.BuildCacheTo, "cache-to", []string{}, "Caches to export the build cache to, like 'type=registry,ref=registry.example.com/model:cache,mode=max', 'type=local,dest=path/to/dir' or 'type=inline' (default)")
+}
+
 func addBuildProgressOutputFlag(cmd *cobra.Command) {
 	defaultOutput := "auto"
 	if os.Getenv("TERM") == "dumb" {
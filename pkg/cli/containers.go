@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+)
+
+// cogContainer is a running container of a Cog model, started by cog serve -d
+// or cog predict --keep-warm.
+type cogContainer struct {
+	ID         string
+	ProjectDir string
+	Image      string
+	Port       int
+	ConfigHash string
+	// Warm is true for containers kept running by cog predict --keep-warm
+	Warm      bool
+	StartedAt time.Time
+}
+
+// listCogContainers returns the running containers of Cog models, oldest
+// first.
+func listCogContainers(ctx context.Context, dockerClient command.Command) ([]*cogContainer, error) {
+	ids := map[string]bool{}
+	for _, label := range []string{command.CogProjectDirLabelKey, command.CogSessionLabelKey} {
+		found, err := dockerClient.ContainerList(ctx, map[string]string{label: ""})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			ids[id] = true
+		}
+	}
+
+	containers := []*cogContainer{}
+	for id := range ids {
+		inspect, err := dockerClient.ContainerInspect(ctx, id)
+		if err != nil {
+			// The container may have stopped since it was listed
+			continue
+		}
+		c := &cogContainer{ID: id}
+		if inspect.Config != nil {
+			labels := inspect.Config.Labels
+			c.ProjectDir = labels[command.CogProjectDirLabelKey]
+			c.ConfigHash = labels[command.CogConfigHashLabelKey]
+			c.Image = inspect.Config.Image
+			c.Warm = labels[command.CogSessionLabelKey] != ""
+			c.Port, _ = strconv.Atoi(labels[command.CogPortLabelKey])
+		}
+		if c.Port == 0 {
+			c.Port, _ = docker.GetHostPortForContainer(ctx, dockerClient, id, 5000)
+		}
+		if inspect.ContainerJSONBase != nil && inspect.State != nil {
+			c.StartedAt, _ = time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+		}
+		containers = append(containers, c)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].StartedAt.Before(containers[j].StartedAt)
+	})
+	return containers, nil
+}
+
+// projectContainers returns the running containers of the project in
+// projectDir.
+func projectContainers(ctx context.Context, dockerClient command.Command, projectDir string) ([]*cogContainer, error) {
+	containers, err := listCogContainers(ctx, dockerClient)
+	if err != nil {
+		return nil, err
+	}
+	found := []*cogContainer{}
+	for _, c := range containers {
+		if c.ProjectDir == projectDir {
+			found = append(found, c)
+		}
+	}
+	return found, nil
+}
+
+// currentProjectDir returns the directory of the project in the current
+// directory, or the current directory if it isn't in a project.
+func currentProjectDir() (string, error) {
+	projectDir, err := config.GetProjectDir(configFilename)
+	if err == nil {
+		return projectDir, nil
+	}
+	return os.Getwd()
+}
+
+// configHash returns the hash of the config file of the project in
+// projectDir, which tells whether a container was started with the current
+// config.
+func configHash(projectDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, filepath.Base(configFilename)))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read config: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// containerHealth returns the status of the Cog server listening on port.
+func containerHealth(ctx context.Context, port int) string {
+	if port == 0 {
+		return "unknown"
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/health-check", port), nil)
+	if err != nil {
+		return "unknown"
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "unreachable"
+	}
+	defer resp.Body.Close()
+	health := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || health.Status == "" {
+		return "unknown"
+	}
+	return health.Status
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
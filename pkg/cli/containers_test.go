@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestListCogContainers(t *testing.T) {
+	dockerClient := dockertest.NewMockCommand2(t)
+	dockerClient.EXPECT().ContainerList(mock.Anything, map[string]string{command.CogProjectDirLabelKey: ""}).Return([]string{"served", "warm"}, nil)
+	dockerClient.EXPECT().ContainerList(mock.Anything, map[string]string{command.CogSessionLabelKey: ""}).Return([]string{"warm"}, nil)
+	dockerClient.EXPECT().ContainerInspect(mock.Anything, "served").Return(&container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{StartedAt: "2025-01-01T10:00:00Z"}},
+		Config: &container.Config{Labels: map[string]string{
+			command.CogProjectDirLabelKey: "/src/model",
+			command.CogConfigHashLabelKey: "abc",
+			command.CogPortLabelKey:       "8393",
+		}},
+	}, nil)
+	dockerClient.EXPECT().ContainerInspect(mock.Anything, "warm").Return(&container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{StartedAt: "2025-01-01T11:00:00Z"}},
+		Config: &container.Config{Labels: map[string]string{
+			command.CogProjectDirLabelKey: "/src/other",
+			command.CogSessionLabelKey:    "key",
+			command.CogPortLabelKey:       "32768",
+		}},
+	}, nil)
+
+	containers, err := listCogContainers(t.Context(), dockerClient)
+	require.NoError(t, err)
+	require.Len(t, containers, 2)
+	require.Equal(t, "served", containers[0].ID)
+	require.Equal(t, "/src/model", containers[0].ProjectDir)
+	require.Equal(t, 8393, containers[0].Port)
+	require.Equal(t, "abc", containers[0].ConfigHash)
+	require.False(t, containers[0].Warm)
+	require.Equal(t, "warm", containers[1].ID)
+	require.True(t, containers[1].Warm)
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerignore"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var (
+	envFiles      []string
+	noEnvFile     bool
+	envShowValues bool
+)
+
+func addEnvFileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&envFiles, "env-file", []string{}, "Read environment variables from a file, in the same format as `docker run --env-file`")
+	cmd.Flags().BoolVar(&noEnvFile, "no-env-file", false, "Don't load environment variables from "+config.EnvFilename+" in the project")
+}
+
+func newEnvCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print the environment variables a model runs with",
+		Long: `Print the environment variables a model runs with, and where each is set.
+
+Variables are merged in this order, with later ones overriding earlier ones:
+the environment in cog.yaml, ` + config.EnvFilename + ` in the project, files passed with
+--env-file, and -e flags.
+
+Values often hold secrets, so only their first characters are printed unless
+--show-values is passed.`,
+		RunE: cmdEnv,
+		Args: cobra.NoArgs,
+	}
+	addConfigFlag(cmd)
+	addEnvFileFlags(cmd)
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().BoolVar(&envShowValues, "show-values", false, "Print values in full instead of masking them")
+	return cmd
+}
+
+func cmdEnv(cmd *cobra.Command, args []string) error {
+	vars := []config.EnvVar{}
+	if cfg, _, err := config.GetConfig(configFilename); err == nil {
+		vars = configEnv(cfg)
+	}
+	runtime, err := loadRuntimeEnv(envFlags)
+	if err != nil {
+		return err
+	}
+	vars = config.MergeEnv(vars, runtime)
+	if len(vars) == 0 {
+		console.Info("No environment variables are set")
+		return nil
+	}
+
+	table := &strings.Builder{}
+	w := tabwriter.NewWriter(table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+	for _, v := range vars {
+		value := v.Value
+		if !envShowValues {
+			value = maskValue(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, value, v.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	console.Output(strings.TrimSuffix(table.String(), "\n"))
+	return nil
+}
+
+// maskValue hides all but the first few characters of value, which is enough
+// to tell values apart without printing secrets. Short values are hidden
+// entirely.
+func maskValue(value string) string {
+	const shown = 4
+	runes := []rune(value)
+	if len(runes) == 0 {
+		return ""
+	}
+	if len(runes) <= 2*shown {
+		return "********"
+	}
+	return string(runes[:shown]) + "********"
+}
+
+// runtimeEnv returns the environment variables to pass to a container, in the
+// form name=value. The environment in cog.yaml isn't included, because it is
+// already set in the image.
+func runtimeEnv(flags []string) ([]string, error) {
+	vars, err := loadRuntimeEnv(flags)
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, len(vars))
+	for i, v := range vars {
+		env[i] = v.Name + "=" + v.Value
+	}
+	return env, nil
+}
+
+// loadRuntimeEnv merges the environment variables in the project's
+// .cog.env, files passed with --env-file and -e flags, in that order.
+func loadRuntimeEnv(flags []string) ([]config.EnvVar, error) {
+	lists := [][]config.EnvVar{}
+
+	if !noEnvFile {
+		projectDir, err := currentProjectDir()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(projectDir, config.EnvFilename)
+		exists, err := files.Exists(path)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			vars, err := config.ParseEnvFile(path)
+			if err != nil {
+				return nil, err
+			}
+			warnIfEnvFileNotIgnored(projectDir)
+			console.Debugf("Loaded %d environment variables from %s", len(vars), path)
+			lists = append(lists, vars)
+		}
+	}
+
+	for _, path := range envFiles {
+		vars, err := config.ParseEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, vars)
+	}
+
+	vars := []config.EnvVar{}
+	for _, flag := range flags {
+		name, value, hasValue := strings.Cut(flag, "=")
+		if err := config.ValidateEnvName(name); err != nil {
+			return nil, err
+		}
+		if !hasValue {
+			// Like docker run -e, pass on the value from the current environment
+			if value, hasValue = os.LookupEnv(name); !hasValue {
+				continue
+			}
+		}
+		vars = append(vars, config.EnvVar{Name: name, Value: value, Source: "-e"})
+	}
+	lists = append(lists, vars)
+
+	return config.MergeEnv(lists...), nil
+}
+
+// configEnv returns the environment set in cog.yaml.
+func configEnv(cfg *config.Config) []config.EnvVar {
+	vars := []config.EnvVar{}
+	for _, entry := range cfg.Environment {
+		name, _, _ := strings.Cut(entry, "=")
+		vars = append(vars, config.EnvVar{Name: name, Value: cfg.ParsedEnvironment()[name], Source: "cog.yaml"})
+	}
+	return vars
+}
+
+// warnIfEnvFileNotIgnored warns if .cog.env would be sent to Docker with the
+// rest of the project when it is built without Cog, since it usually holds
+// secrets. cog build adds it to .dockerignore itself.
+func warnIfEnvFileNotIgnored(projectDir string) {
+	matcher, err := dockerignore.CreateMatcher(projectDir)
+	if err != nil {
+		return
+	}
+	if matcher == nil || !matcher.MatchesPath(config.EnvFilename) {
+		console.Warnf("%s is not in .dockerignore, so it is sent to Docker if the project is built with docker build", config.EnvFilename)
+	}
+}
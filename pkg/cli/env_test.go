@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskValue(t *testing.T) {
+	require.Equal(t, "", maskValue(""))
+	require.Equal(t, "********", maskValue("1"))
+	require.Equal(t, "********", maskValue("12345678"))
+	require.Equal(t, "r8_a********", maskValue("r8_abcdefghijklmnop"))
+}
+
+func TestRuntimeEnvRejectsDeniedNames(t *testing.T) {
+	t.Chdir(t.TempDir())
+	noEnvFile = true
+	t.Cleanup(func() { noEnvFile = false })
+
+	env, err := runtimeEnv([]string{"FOO=bar"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"FOO=bar"}, env)
+
+	_, err = runtimeEnv([]string{"CUDA_VISIBLE_DEVICES=0"})
+	require.ErrorContains(t, err, `environment variable "CUDA_VISIBLE_DEVICES" is not allowed`)
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newLockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Resolve the build environment in cog.yaml and write it to " + config.LockFilename,
+		Long: `Resolve the build environment in cog.yaml and write it to ` + config.LockFilename + `.
+
+The lock records the digest of the base image, the versions of all the system
+packages and the versions and hashes of the Python packages that were
+installed, the cog wheel, and the CUDA and cuDNN versions. Build from it with
+'cog build --locked', which fails if the build has drifted from the lock.`,
+		Args: cobra.NoArgs,
+		RunE: lockCommand,
+	}
+	addBuildProgressOutputFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildTimestampFlag(cmd)
+	addConfigFlag(cmd)
+	addBuilderFlag(cmd)
+	cmd.Flags().StringVar(&buildPlatform, "platform", registry.DefaultPlatform.String(), "Platform to resolve the build environment for, e.g. linux/arm64")
+	return cmd
+}
+
+func lockCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	cfg, projectDir, err := config.GetConfig(configFilename)
+	if err != nil {
+		return err
+	}
+	if cfg.Build.Fast {
+		return fmt.Errorf("Fast builds can't be locked")
+	}
+	if err := config.ValidateModelPythonVersion(cfg); err != nil {
+		return err
+	}
+	platforms, err := registry.ParsePlatforms(buildPlatform)
+	if err != nil {
+		return err
+	}
+	if len(platforms) > 1 {
+		return fmt.Errorf("%s can only be written for one platform", config.LockFilename)
+	}
+
+	dockerClient, err := docker.NewClient(ctx, builderOptions()...)
+	if err != nil {
+		return err
+	}
+
+	lock, err := image.Lock(ctx, dockerClient, cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput, registry.NewRegistryClient(), platforms[0])
+	if err != nil {
+		return err
+	}
+	if err := lock.Write(projectDir); err != nil {
+		return err
+	}
+
+	console.Infof("\nWrote %s with %d system packages and %d Python packages", config.LockFilename, len(lock.SystemPackages), len(lock.PythonPackages))
+	console.Info("Build from it with 'cog build --locked'")
+	return nil
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+var logsFollow bool
+
+func newLogsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs [container]",
+		Short: "Print the logs of a model container",
+		Long: `Print the logs of a model container.
+
+Without a container ID, it prints the logs of the container running the model
+in the current directory, started by cog serve -d or cog predict --keep-warm.`,
+		RunE: cmdLogs,
+		Args: cobra.MaximumNArgs(1),
+	}
+	addConfigFlag(cmd)
+	cmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing new logs until the container stops")
+	return cmd
+}
+
+func cmdLogs(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	containerID := ""
+	if len(args) > 0 {
+		containerID = args[0]
+	} else {
+		projectDir, err := currentProjectDir()
+		if err != nil {
+			return err
+		}
+		containers, err := projectContainers(ctx, dockerClient, projectDir)
+		if err != nil {
+			return err
+		}
+		switch len(containers) {
+		case 0:
+			return fmt.Errorf("No model containers are running for %s, start one with cog serve -d", projectDir)
+		case 1:
+			containerID = containers[0].ID
+		default:
+			ids := make([]string, len(containers))
+			for i, c := range containers {
+				ids[i] = shortContainerID(c.ID)
+			}
+			return fmt.Errorf("Several model containers are running for %s, pass one of %s", projectDir, strings.Join(ids, ", "))
+		}
+	}
+
+	return dockerClient.ContainerLogs(ctx, containerID, os.Stdout, logsFollow)
+}
@@ -3,7 +3,6 @@ package cli
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,10 +11,14 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	dockerimage "github.com/docker/docker/api/types/image"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -24,17 +27,21 @@ import (
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
 	r8_path "github.com/replicate/cog/pkg/path"
 	"github.com/replicate/cog/pkg/predict"
 	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/files"
-	"github.com/replicate/cog/pkg/util/mime"
 )
 
 const StdinPath = "-"
 
+// cancelGracePeriod is how long a canceled prediction has to stop before its
+// container is stopped.
+const cancelGracePeriod = 30 * time.Second
+
 var (
 	envFlags             []string
 	inputFlags           []string
@@ -42,6 +49,19 @@ var (
 	setupTimeout         uint32
 	useReplicateAPIToken bool
 	inputJSON            string
+	predictAsync         bool
+	predictStream        bool
+	batchInputs          string
+	batchOutputDir       string
+	keepWarm             bool
+	serverURLFlag        string
+	fileTransferFlag     string
+	uploadOutputsFlag    bool
+	showMetrics          bool
+	jsonOutput           bool
+	logsFile             string
+	predictInteractive   bool
+	predictCompareImages bool
 )
 
 func newPredictCommand() *cobra.Command {
@@ -51,12 +71,22 @@ func newPredictCommand() *cobra.Command {
 		Long: `Run a prediction.
 
 If 'image' is passed, it will run the prediction on that Docker image.
-It must be an image that has been built by Cog.
+It must be an image that has been built by Cog. It can also be the path
+of a tarball exported with 'cog build --output', which is loaded into
+Docker first.
 
 Otherwise, it will build the model in the current directory and run
-the prediction on that.`,
-		RunE:       cmdPredict,
-		Args:       cobra.MaximumNArgs(1),
+the prediction on that.
+
+With --compare, it runs the same prediction on two images and shows the
+differences between their outputs, and the latency of each.`,
+		RunE: cmdPredict,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if predictCompareImages {
+				return cobra.ExactArgs(2)(cmd, args)
+			}
+			return cobra.MaximumNArgs(1)(cmd, args)
+		},
 		SuggestFor: []string{"infer"},
 	}
 
@@ -66,16 +96,29 @@ the prediction on that.`,
 	addDockerfileFlag(cmd)
 	addGpusFlag(cmd)
 	addSetupTimeoutFlag(cmd)
+	addServerURLFlag(cmd)
+	addFileTransferFlag(cmd)
 	addFastFlag(cmd)
 	addLocalImage(cmd)
 	addConfigFlag(cmd)
 	addPipelineImage(cmd)
+	addEnvFileFlags(cmd)
 
 	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
 	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path")
 	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
 	cmd.Flags().BoolVar(&useReplicateAPIToken, "use-replicate-token", false, "Pass REPLICATE_API_TOKEN from local environment into the model context")
 	cmd.Flags().StringVar(&inputJSON, "json", "", "Pass inputs as JSON object, read from file (@inputs.json) or via stdin (@-)")
+	cmd.Flags().BoolVar(&predictAsync, "async", false, "Run the prediction asynchronously and print its progress as it arrives")
+	cmd.Flags().StringVar(&batchInputs, "batch", "", "Run a prediction for every line of a JSONL file of inputs (inputs.jsonl), or stdin (-)")
+	cmd.Flags().StringVar(&batchOutputDir, "output-dir", "output", "Directory to write the outputs of --batch predictions to")
+	cmd.Flags().BoolVar(&keepWarm, "keep-warm", false, "Leave the container running after the prediction, and reuse it for later predictions with the same image and options")
+	cmd.Flags().BoolVar(&predictStream, "stream", false, "Print the outputs of iterator models and logs as they are produced")
+	cmd.Flags().BoolVar(&showMetrics, "show-metrics", false, "Print the timings and metrics of the prediction")
+	cmd.Flags().BoolVar(&jsonOutput, "json-output", false, "Print the prediction as JSON, including its ID, logs, metrics and timings. Predictions with --json inputs are always printed as JSON")
+	cmd.Flags().StringVar(&logsFile, "logs-file", "", "Write the logs of the prediction to this file")
+	cmd.Flags().BoolVar(&predictInteractive, "interactive", false, "Prompt for inputs and run predictions in a loop, reusing the same container")
+	cmd.Flags().BoolVar(&predictCompareImages, "compare", false, "Run the prediction on two images, passed as arguments, and show the differences between their outputs")
 
 	return cmd
 }
@@ -122,49 +165,64 @@ func parseJSONInput(jsonInput string) (map[string]any, error) {
 		jsonStr = jsonInput
 	}
 
+	return decodeJSONInputs([]byte(jsonStr))
+}
+
+// decodeJSONInputs decodes a JSON object of inputs. Numbers are kept as
+// json.Number, so large integers aren't rounded to the nearest float64.
+func decodeJSONInputs(data []byte) (map[string]any, error) {
 	var inputs map[string]any
-	if err := json.Unmarshal([]byte(jsonStr), &inputs); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&inputs); err != nil {
 		return nil, fmt.Errorf("Failed to parse JSON: %w", err)
 	}
-
+	if decoder.More() {
+		return nil, fmt.Errorf("Failed to parse JSON: unexpected data after the object")
+	}
 	return inputs, nil
 }
 
-func transformPathsToBase64URLs(inputs map[string]any) (map[string]any, error) {
-	result := make(map[string]any)
+func cmdPredict(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 
-	for key, value := range inputs {
-		if strValue, ok := value.(string); ok && strings.HasPrefix(strValue, "@") {
-			// This is a file path, convert to base64 data URL
-			filePath := strValue[1:]
+	if batchInputs != "" && (inputJSON != "" || len(inputFlags) > 0) {
+		return fmt.Errorf("--batch cannot be used with --json or --input")
+	}
 
-			// Read file
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to read file %q: %w", filePath, err)
-			}
+	if keepWarm && (predictAsync || predictStream) {
+		return fmt.Errorf("--keep-warm cannot be used with --async or --stream")
+	}
 
-			// Get MIME type
-			mimeType := mime.TypeByExtension(filepath.Ext(filePath))
-			if mimeType == "" {
-				mimeType = "application/octet-stream"
-			}
+	if batchInputs != "" && (logsFile != "" || jsonOutput) {
+		return fmt.Errorf("--batch cannot be used with --logs-file or --json-output, the logs and metrics of each prediction are written to --output-dir")
+	}
 
-			// Create base64 data URL
-			base64Data := base64.StdEncoding.EncodeToString(data)
-			dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
+	if predictInteractive && (batchInputs != "" || inputJSON != "" || serverURLFlag != "") {
+		return fmt.Errorf("--interactive cannot be used with --batch, --json or --url")
+	}
 
-			result[key] = dataURL
-		} else {
-			result[key] = value
+	if predictCompareImages {
+		if batchInputs != "" || serverURLFlag != "" || predictInteractive || keepWarm || predictAsync || predictStream {
+			return fmt.Errorf("--compare cannot be used with --batch, --url, --interactive, --keep-warm, --async or --stream")
 		}
+		return predictCompare(ctx, args)
 	}
 
-	return result, nil
-}
+	historyDir = predictionHistoryDir(".")
 
-func cmdPredict(cmd *cobra.Command, args []string) error {
-	ctx := cmd.Context()
+	if serverURLFlag != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("--url cannot be used with an image")
+		}
+		if keepWarm || predictAsync || predictStream {
+			return fmt.Errorf("--url cannot be used with --keep-warm, --async or --stream")
+		}
+		// The server decides how many predictions it runs at once, so batches run one at a time
+		return predictOnServer(ctx, serverURLFlag, false, func(predictor *predict.Predictor) error {
+			return predictWithInputFlags(ctx, predictor, 1)
+		})
+	}
 
 	dockerClient, err := docker.NewClient(ctx)
 	if err != nil {
@@ -174,6 +232,9 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 	imageName := ""
 	volumes := []command.Volume{}
 	gpus := gpusFlag
+	concurrency := 1
+	// Warm containers of models in the current directory are recorded in the project
+	sessionDir := "."
 
 	if len(args) == 0 {
 		// Build image
@@ -182,10 +243,15 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		sessionDir = projectDir
+		historyDir = predictionHistoryDir(projectDir)
 
 		if cfg.Build.Fast {
 			buildFast = cfg.Build.Fast
 		}
+		if cfg.Concurrency != nil && cfg.Concurrency.Max > 1 {
+			concurrency = cfg.Concurrency.Max
+		}
 
 		client := registry.NewRegistryClient()
 		if buildFast || pipelinesImage {
@@ -210,7 +276,10 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 				buildLocalImage,
 				dockerClient,
 				client,
-				pipelinesImage); err != nil {
+				pipelinesImage,
+				registry.DefaultPlatform,
+				nil,
+				nil); err != nil {
 				return err
 			}
 		} else {
@@ -238,8 +307,17 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("Invalid image name '%s'. Did you forget `-i`?", imageName)
 		}
 
-		inspectResp, err := dockerClient.Pull(ctx, imageName, false)
-		if err != nil {
+		// An image exported with cog build --output is loaded from the tarball
+		var inspectResp *dockerimage.InspectResponse
+		if info, err := os.Stat(imageName); err == nil && info.Mode().IsRegular() {
+			console.Infof("Loading image from %s...", imageName)
+			if imageName, err = dockerClient.ImageLoad(ctx, imageName); err != nil {
+				return err
+			}
+			if inspectResp, err = dockerClient.Inspect(ctx, imageName); err != nil {
+				return fmt.Errorf("Failed to inspect image %q: %w", imageName, err)
+			}
+		} else if inspectResp, err = dockerClient.Pull(ctx, imageName, false); err != nil {
 			return fmt.Errorf("Failed to pull image %q: %w", imageName, err)
 		}
 
@@ -253,35 +331,87 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		if conf.Build.Fast {
 			buildFast = conf.Build.Fast
 		}
+		if conf.Concurrency != nil && conf.Concurrency.Max > 1 {
+			concurrency = conf.Concurrency.Max
+		}
 	}
 
-	console.Info("")
-	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	// The schema in the labels of the image lets inputs be checked before
+	// setup() runs. Models run from source only have a schema once started.
+	manifest, err := dockerClient.Inspect(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect image %q: %w", imageName, err)
+	}
+	schema, err := image.OpenAPISchemaFromManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	predictorOpts, err := fileTransferOptions()
+	if err != nil {
+		return err
+	}
+	if schema != nil {
+		predictorOpts = append(predictorOpts, predict.WithSchema(schema))
+	}
+	labels := map[string]string{}
+	if keepWarm {
+		predictorOpts = append(predictorOpts, predict.WithKeepWarm(filepath.Join(sessionDir, global.CogBuildArtifactsFolder, "session.json")))
+		// So cog ps, cog logs and cog stop can find the container of the project
+		absSessionDir, err := filepath.Abs(sessionDir)
+		if err != nil {
+			return err
+		}
+		labels[command.CogProjectDirLabelKey] = absSessionDir
+	}
+	logsWriter := &muteWriter{w: os.Stderr}
+	switch {
+	case predictStream:
+		predictorOpts = append(predictorOpts, predict.WithStreaming())
+	case predictAsync:
+		predictorOpts = append(predictorOpts, predict.WithAsync())
+	}
+
+	env, err := runtimeEnv(envFlags)
+	if err != nil {
+		return err
+	}
+	historyEnv, err = recordedEnv(envFlags)
+	if err != nil {
+		return err
+	}
 
 	predictor, err := predict.NewPredictor(ctx, command.RunOptions{
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: volumes,
-		Env:     envFlags,
-	}, false, buildFast, dockerClient)
+		Env:     env,
+		Labels:  labels,
+	}, false, buildFast, dockerClient, predictorOpts...)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
+	var inputs predict.Inputs
+	inputsValidated := schema != nil && !predictInteractive && batchInputs == ""
+	if inputsValidated {
+		if inputs, err = inputsFromFlags(predictor, schema); err != nil {
+			return err
+		}
+	}
 
-		<-captureSignal
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
 
-		console.Info("Stopping container...")
-		if err := predictor.Stop(ctx); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
+	predictionDone := func() {}
+	if predictInteractive {
+		predictionDone = handleInteractiveInterrupts(ctx, func() *predict.Predictor { return predictor })
+	} else {
+		handleInterrupts(ctx, func() *predict.Predictor { return predictor })
+	}
 
 	timeout := time.Duration(setupTimeout) * time.Second
-	if err := predictor.Start(ctx, os.Stderr, timeout); err != nil {
+	if err := predictor.Start(ctx, logsWriter, timeout); err != nil {
 		// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
 		// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
 		if gpus == "all" && errors.Is(err, docker.ErrMissingDeviceDriver) {
@@ -291,13 +421,14 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			predictor, err = predict.NewPredictor(ctx, command.RunOptions{
 				Image:   imageName,
 				Volumes: volumes,
-				Env:     envFlags,
-			}, false, buildFast, dockerClient)
+				Env:     env,
+				Labels:  labels,
+			}, false, buildFast, dockerClient, predictorOpts...)
 			if err != nil {
 				return err
 			}
 
-			if err := predictor.Start(ctx, os.Stderr, timeout); err != nil {
+			if err := predictor.Start(ctx, logsWriter, timeout); err != nil {
 				return err
 			}
 		} else {
@@ -305,8 +436,11 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// FIXME: will not run on signal
 	defer func() {
+		if keepWarm {
+			console.Info("Leaving container running for later predictions")
+			return
+		}
 		console.Debugf("Stopping container...")
 		// use background context to ensure stop signal is still sent after root context is canceled
 		if err := predictor.Stop(context.Background()); err != nil {
@@ -314,65 +448,207 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
+	if predictAsync || predictStream {
+		// The container prints the same logs that arrive in webhooks, show them only once
+		logsWriter.Mute()
+	}
+
+	switch {
+	case predictInteractive:
+		err = predictInteractively(ctx, predictor, inputFlags, predictionDone)
+	case inputsValidated:
+		err = runPrediction(ctx, predictor, inputs, outPath, false, inputJSON != "" || jsonOutput)
+	default:
+		err = predictWithInputFlags(ctx, predictor, concurrency)
+	}
+	if err != nil {
+		// The muted logs may explain the failure, like the traceback of a
+		// crash that never made it into a webhook
+		logsWriter.Unmute()
+	}
+	return err
+}
+
+// predictWithInputFlags runs the predictions requested with --batch, --json or --input.
+func predictWithInputFlags(ctx context.Context, predictor *predict.Predictor, concurrency int) error {
+	if batchInputs != "" {
+		return predictBatch(ctx, predictor, batchInputs, batchOutputDir, concurrency)
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	inputs, err := inputsFromFlags(predictor, schema)
+	if err != nil {
+		return err
+	}
+	// Predictions with --json inputs are always printed as JSON
+	return runPrediction(ctx, predictor, inputs, outPath, false, inputJSON != "" || jsonOutput)
+}
+
+// inputsFromFlags parses the inputs of --json or --input, and validates them
+// against schema.
+func inputsFromFlags(predictor *predict.Predictor, schema *openapi3.T) (predict.Inputs, error) {
 	if inputJSON != "" {
 		if len(inputFlags) > 0 {
-			return fmt.Errorf("Must use one of --json or --input to provide model inputs")
+			return nil, fmt.Errorf("Must use one of --json or --input to provide model inputs")
 		}
+		return parseJSONInputs(predictor, inputJSON, schema)
+	}
+	return parseIndividualInputs(predictor, inputFlags, schema)
+}
 
-		return predictJSONInputs(*predictor, inputJSON, outPath, false)
+// predictOnServer runs predictions on a Cog server that is already running at serverURL.
+func predictOnServer(ctx context.Context, serverURL string, isTrain bool, run func(predictor *predict.Predictor) error) error {
+	predictor, err := predict.NewRemotePredictor(serverURL, isTrain)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Waiting for Cog server at %s...", serverURL)
+	if err := predictor.Start(ctx, os.Stderr, time.Duration(setupTimeout)*time.Second); err != nil {
+		return fmt.Errorf("Cog server at %s is not ready: %w", serverURL, err)
 	}
-	return predictIndividualInputs(*predictor, inputFlags, outPath, false)
+	handleRemoteInterrupts(ctx, predictor)
+
+	return run(predictor)
+}
+
+// handleInterrupts cancels the running prediction on the first Ctrl-C, and
+// stops the container on the second Ctrl-C or if the prediction doesn't stop
+// within cancelGracePeriod. Ctrl-C stops the container straight away if no
+// prediction is running.
+func handleInterrupts(ctx context.Context, predictor func() *predict.Predictor) {
+	captureSignal := make(chan os.Signal, 1)
+	signal.Notify(captureSignal, syscall.SIGINT)
+
+	go func() {
+		// Later Ctrl-Cs interrupt cog as usual, in case stopping the container
+		// doesn't end it
+		defer signal.Stop(captureSignal)
+		<-captureSignal
+
+		err := predictor().Cancel(ctx)
+		switch {
+		case err == nil:
+			console.Info("Canceling prediction, press Ctrl-C again to stop the container...")
+			select {
+			case <-captureSignal:
+			case <-time.After(cancelGracePeriod):
+				console.Warnf("Prediction was not canceled after %s", cancelGracePeriod)
+			}
+		case !errors.Is(err, predict.ErrNoPrediction):
+			console.Warnf("Failed to cancel prediction: %s", err)
+		}
+
+		console.Info("Stopping container...")
+		if err := predictor().Stop(ctx); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+}
+
+// handleRemoteInterrupts cancels the running prediction on a Cog server on the
+// first Ctrl-C, and exits on the second Ctrl-C or if the prediction doesn't
+// stop within cancelGracePeriod. Ctrl-C exits straight away if no prediction
+// is running. There is no container to stop, and the server may ignore the
+// cancel, so cog exits rather than waiting for the prediction.
+func handleRemoteInterrupts(ctx context.Context, predictor *predict.Predictor) {
+	captureSignal := make(chan os.Signal, 1)
+	signal.Notify(captureSignal, syscall.SIGINT)
+
+	go func() {
+		<-captureSignal
+
+		err := predictor.Cancel(ctx)
+		switch {
+		case err == nil:
+			console.Info("Canceling prediction, press Ctrl-C again to exit...")
+			select {
+			case <-captureSignal:
+			case <-time.After(cancelGracePeriod):
+				console.Warnf("Prediction was not canceled after %s", cancelGracePeriod)
+			}
+		case !errors.Is(err, predict.ErrNoPrediction):
+			console.Warnf("Failed to cancel prediction: %s", err)
+		}
+		os.Exit(130)
+	}()
 }
 
 func isURI(ref *openapi3.Schema) bool {
 	return ref != nil && ref.Type.Is("string") && ref.Format == "uri"
 }
 
-func predictJSONInputs(predictor predict.Predictor, jsonInput string, outputPath string, isTrain bool) error {
+// parseJSONInputs parses the inputs of --json and validates them against
+// schema.
+func parseJSONInputs(predictor *predict.Predictor, jsonInput string, schema *openapi3.T) (predict.Inputs, error) {
 	jsonInputs, err := parseJSONInput(jsonInput)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	transformedInputs, err := transformPathsToBase64URLs(jsonInputs)
+	inputs, err := jsonToInputs(jsonInputs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return nil, err
 	}
+	return inputs, nil
+}
 
-	// Convert to predict.Inputs format
+// jsonToInputs converts inputs decoded from a JSON object to predict.Inputs.
+// Strings prefixed with @ are paths to input files.
+func jsonToInputs(jsonInputs map[string]any) (predict.Inputs, error) {
 	inputs := make(predict.Inputs)
-	for key, value := range transformedInputs {
-		if strValue, ok := value.(string); ok {
+	for key, value := range jsonInputs {
+		if strValue, ok := value.(string); ok && strings.HasPrefix(strValue, "@") {
+			filePath := strValue[1:]
+			inputs[key] = predict.Input{File: &filePath}
+		} else if ok {
 			inputs[key] = predict.Input{String: &strValue}
 		} else {
 			// For non-string values, marshal to JSON
 			jsonBytes, err := json.Marshal(value)
 			if err != nil {
-				return fmt.Errorf("Failed to marshal input %q to JSON: %w", key, err)
+				return nil, fmt.Errorf("Failed to marshal input %q to JSON: %w", key, err)
 			}
 			jsonRaw := json.RawMessage(jsonBytes)
 			inputs[key] = predict.Input{Json: &jsonRaw}
 		}
 	}
-
-	return runPrediction(predictor, inputs, outputPath, isTrain, true)
+	return inputs, nil
 }
 
-func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, outputPath string, isTrain bool) error {
+func predictIndividualInputs(ctx context.Context, predictor *predict.Predictor, inputFlags []string, outputPath string, isTrain bool) error {
 	schema, err := predictor.GetSchema()
 	if err != nil {
 		return err
 	}
-
-	inputs, err := parseInputFlags(inputFlags, schema)
+	inputs, err := parseIndividualInputs(predictor, inputFlags, schema)
 	if err != nil {
 		return err
 	}
 
-	return runPrediction(predictor, inputs, outputPath, isTrain, false)
+	return runPrediction(ctx, predictor, inputs, outputPath, isTrain, jsonOutput)
 }
 
-func runPrediction(predictor predict.Predictor, inputs predict.Inputs, outputPath string, isTrain bool, needsJSON bool) error {
+// parseIndividualInputs parses the inputs of --input and validates them
+// against schema.
+func parseIndividualInputs(predictor *predict.Predictor, inputFlags []string, schema *openapi3.T) (predict.Inputs, error) {
+	inputs, err := parseInputFlags(inputFlags, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+func runPrediction(ctx context.Context, predictor *predict.Predictor, inputs predict.Inputs, outputPath string, isTrain bool, needsJSON bool) error {
 	if isTrain {
 		console.Info("Running training...")
 	} else {
@@ -385,13 +661,20 @@ func runPrediction(predictor predict.Predictor, inputs predict.Inputs, outputPat
 		url = "/trainings"
 	}
 
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	outputSchema := schema.Paths.Value(url).Post.Responses.Value("200").Value.Content["application/json"].Schema.Value.Properties["output"].Value
+	nestedFiles := hasNestedFiles(outputSchema)
+
 	writeOutputToDisk := outputPath != ""
 	fallbackPath := "output"
-	if needsJSON {
+	if needsJSON || nestedFiles {
 		fallbackPath = "output.json"
 	}
 
-	outputPath, err := ensureOutputWriteable(strings.TrimPrefix(outputPath, "@"), fallbackPath)
+	outputPath, err = ensureOutputWriteable(strings.TrimPrefix(outputPath, "@"), fallbackPath)
 	if err != nil {
 		return fmt.Errorf("Output path is not writable: %w", err)
 	}
@@ -400,39 +683,71 @@ func runPrediction(predictor predict.Predictor, inputs predict.Inputs, outputPat
 		console.Warnf("--output value does not have a .json suffix: %s", path.Base(outputPath))
 	}
 
-	context := predict.RequestContext{}
+	requestContext := predict.RequestContext{}
 
 	if useReplicateAPIToken {
-		context.ReplicateAPIToken = os.Getenv("REPLICATE_API_TOKEN")
-		if context.ReplicateAPIToken == "" {
+		requestContext.ReplicateAPIToken = os.Getenv("REPLICATE_API_TOKEN")
+		if requestContext.ReplicateAPIToken == "" {
 			return fmt.Errorf("Failed to find REPLICATE_API_TOKEN in the current environment when called with --use-replicate-token")
 		}
 	}
 
-	prediction, err := predictor.Predict(inputs, context)
+	fileOutputPath := outputPath
+	if needsJSON || nestedFiles {
+		// Strip the suffix when in JSON mode, or when files are written to a
+		// directory next to the JSON output.
+		fileOutputPath = r8_path.TrimExt(fileOutputPath)
+	}
+
+	var prediction *predict.Response
+	var renderer *streamRenderer
+	switch {
+	case predictStream && !isTrain && !needsJSON:
+		renderer = newStreamRenderer(predictor, outputSchema, fileOutputPath)
+		prediction, err = predictor.PredictAsync(ctx, inputs, requestContext, renderer.handleEvent)
+	case (predictAsync || predictStream) && !isTrain:
+		prediction, err = predictor.PredictAsync(ctx, inputs, requestContext, printPredictionEvent)
+	default:
+		prediction, err = predictor.Predict(inputs, requestContext)
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to predict: %w", err)
 	}
 
-	schema, err := predictor.GetSchema()
-	if err != nil {
-		return err
+	if logsFile != "" {
+		path, err := files.WriteFile([]byte(prediction.Logs), logsFile)
+		if err != nil {
+			return fmt.Errorf("Failed to write logs: %w", err)
+		}
+		console.Infof("Written logs to: %s", path)
+	}
+	if showMetrics {
+		printMetrics(prediction)
 	}
-	outputSchema := schema.Paths.Value(url).Post.Responses.Value("200").Value.Content["application/json"].Schema.Value.Properties["output"].Value
 
-	fileOutputPath := outputPath
-	if needsJSON {
-		// Strip the suffix when in JSON mode.
-		fileOutputPath = r8_path.TrimExt(fileOutputPath)
+	if renderer != nil && renderer.finish() {
+		recordPrediction(ctx, predictor, inputs, prediction)
+		if prediction.Status != "succeeded" {
+			return fmt.Errorf("Prediction failed with status %q: %s", prediction.Status, prediction.Error)
+		}
+		// Outputs have already been printed and written as they arrived
+		return nil
 	}
 
-	if prediction.Status == "succeeded" && prediction.Output != nil {
-		transformed, err := processFileOutputs(*prediction.Output, outputSchema, fileOutputPath)
+	// Canceled predictions return the output produced until they were canceled
+	if (prediction.Status == "succeeded" || prediction.Status == "canceled") && prediction.Output != nil {
+		transformed, err := processFileOutputs(predictor, *prediction.Output, outputSchema, fileOutputPath)
+		if err != nil {
+			return err
+		}
+		// Files that weren't written to disk are included in the output
+		transformed, err = predictor.InlineFiles(transformed)
 		if err != nil {
 			return err
 		}
 		prediction.Output = &transformed
 	}
+	recordPrediction(ctx, predictor, inputs, prediction)
 
 	if needsJSON {
 		rawJSON, err := json.Marshal(prediction)
@@ -462,7 +777,10 @@ func runPrediction(predictor predict.Predictor, inputs predict.Inputs, outputPat
 		return nil
 	}
 
-	if prediction.Status != "succeeded" {
+	switch {
+	case prediction.Status == "canceled" && prediction.Output != nil:
+		console.Warn("Prediction was canceled, output is incomplete")
+	case prediction.Status != "succeeded":
 		return fmt.Errorf("Prediction failed with status %q: %s", prediction.Status, prediction.Error)
 	}
 
@@ -578,8 +896,40 @@ func prettyJSONMarshal(v any) ([]byte, error) {
 	return formatted.Bytes(), nil
 }
 
-func processFileOutputs(output any, schema *openapi3.Schema, destination string) (any, error) {
-	// TODO: This doesn't currently support arbitrary objects.
+// processFileOutputs writes the files in output to disk and returns output with
+// each file replaced by the path it was written to. A Path output is written to
+// destination, and the items of a list[Path] output to numbered paths next to it.
+// Files nested in other outputs, such as objects, are written inside a directory
+// named destination, to a path made of the fields and indexes that lead to them,
+// e.g. output/masks/0.png.
+func processFileOutputs(predictor *predict.Predictor, output any, schema *openapi3.Schema, destination string) (any, error) {
+	if schema != nil && schema.Type.Is("array") && isURI(itemsSchema(schema)) {
+		outputs, ok := output.([]any)
+		if !ok {
+			return nil, fmt.Errorf("Failed to decode output: %v", output)
+		}
+
+		clone := []any{}
+		for i, output := range outputs {
+			item, err := writeFileOutputs(predictor, output, schema.Items.Value, indexedDestination(destination, i))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to write output %d: %w", i, err)
+			}
+
+			clone = append(clone, item)
+		}
+
+		return clone, nil
+	}
+
+	return writeFileOutputs(predictor, output, schema, destination)
+}
+
+func writeFileOutputs(predictor *predict.Predictor, output any, schema *openapi3.Schema, destination string) (any, error) {
+	if schema == nil || output == nil {
+		return output, nil
+	}
+
 	switch {
 	case isURI(schema):
 		outputStr, ok := output.(string)
@@ -587,36 +937,243 @@ func processFileOutputs(output any, schema *openapi3.Schema, destination string)
 			return nil, fmt.Errorf("Failed to convert prediction output to string: %v", output)
 		}
 
-		path, err := files.WriteDataURLToFile(outputStr, destination)
+		if err := os.MkdirAll(path.Dir(destination), 0o755); err != nil {
+			return nil, fmt.Errorf("Failed to create output directory: %w", err)
+		}
+		path, err := predictor.WriteOutputFile(outputStr, destination)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to write output: %w", err)
 		}
 		console.Infof("Written output to: %s", path)
 
 		return any(path), nil
-	case schema.Type.Is("array") && isURI(schema.Items.Value):
-		outputs, ok := (output).([]any)
-		if !ok {
-			return nil, fmt.Errorf("Failed to decode output: %v", output)
-		}
+	case len(schema.AnyOf) > 0 || len(schema.OneOf) > 0:
+		variant := matchingVariant(output, append(schema.AnyOf, schema.OneOf...))
+		return writeFileOutputs(predictor, output, variant, destination)
+	case len(schema.AllOf) == 1:
+		return writeFileOutputs(predictor, output, schema.AllOf[0].Value, destination)
+	}
 
-		clone := []any{}
-		for i, output := range outputs {
-			itemDestination := fmt.Sprintf("%s.%d%s", r8_path.TrimExt(destination), i, path.Ext(destination))
-			item, err := processFileOutputs(output, schema.Items.Value, itemDestination)
+	switch value := output.(type) {
+	case []any:
+		items := itemsSchema(schema)
+		clone := make([]any, len(value))
+		for i, item := range value {
+			written, err := writeFileOutputs(predictor, item, items, path.Join(destination, strconv.Itoa(i)))
 			if err != nil {
-				return nil, fmt.Errorf("Failed to write output %d: %w", i, err)
+				return nil, err
 			}
-
-			clone = append(clone, item)
+			clone[i] = written
+		}
+		return clone, nil
+	case map[string]any:
+		clone := make(map[string]any, len(value))
+		for key, item := range value {
+			property := propertySchema(schema, key)
+			if !containsFiles(property, map[*openapi3.Schema]bool{}) {
+				clone[key] = item
+				continue
+			}
+			keyDestination, err := fieldDestination(destination, key)
+			if err != nil {
+				return nil, err
+			}
+			written, err := writeFileOutputs(predictor, item, property, keyDestination)
+			if err != nil {
+				return nil, err
+			}
+			clone[key] = written
 		}
-
 		return clone, nil
 	}
 
 	return output, nil
 }
 
+// hasNestedFiles returns true if the output has files that are not a Path or
+// list[Path] output, and so are written inside a directory.
+func hasNestedFiles(schema *openapi3.Schema) bool {
+	if schema == nil || isURI(schema) || (schema.Type.Is("array") && isURI(itemsSchema(schema))) {
+		return false
+	}
+	return containsFiles(schema, map[*openapi3.Schema]bool{})
+}
+
+func containsFiles(schema *openapi3.Schema, seen map[*openapi3.Schema]bool) bool {
+	if schema == nil || seen[schema] {
+		return false
+	}
+	seen[schema] = true
+
+	if isURI(schema) {
+		return true
+	}
+	refs := append(append(append(openapi3.SchemaRefs{}, schema.AnyOf...), schema.OneOf...), schema.AllOf...)
+	refs = append(refs, schema.Items)
+	for _, property := range schema.Properties {
+		refs = append(refs, property)
+	}
+	if schema.AdditionalProperties.Schema != nil {
+		refs = append(refs, schema.AdditionalProperties.Schema)
+	}
+	for _, ref := range refs {
+		if ref != nil && containsFiles(ref.Value, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingVariant returns the variant of a union that describes value.
+func matchingVariant(value any, variants openapi3.SchemaRefs) *openapi3.Schema {
+	for _, variant := range variants {
+		schema := variant.Value
+		if schema == nil {
+			continue
+		}
+		var matches bool
+		switch value.(type) {
+		case string:
+			matches = isURI(schema)
+		case []any:
+			matches = schema.Type.Is("array")
+		case map[string]any:
+			matches = schema.Type.Is("object") || len(schema.Properties) > 0
+		}
+		if matches {
+			return schema
+		}
+	}
+	return nil
+}
+
+func itemsSchema(schema *openapi3.Schema) *openapi3.Schema {
+	if schema.Items == nil {
+		return nil
+	}
+	return schema.Items.Value
+}
+
+func propertySchema(schema *openapi3.Schema, name string) *openapi3.Schema {
+	if property, ok := schema.Properties[name]; ok {
+		return property.Value
+	}
+	if schema.AdditionalProperties.Schema != nil {
+		return schema.AdditionalProperties.Schema.Value
+	}
+	return nil
+}
+
+// fieldDestination returns the path the files in field key of an object output
+// written to destination are written to. Keys of objects with
+// additionalProperties come from the model, so they can't be paths.
+func fieldDestination(destination string, key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("Failed to write output %q: the names of fields with files can't contain path separators", key)
+	}
+	joined := path.Join(destination, key)
+	if path.Dir(joined) != path.Clean(destination) {
+		return "", fmt.Errorf("Failed to write output %q: it would be written outside %s", key, destination)
+	}
+	return joined, nil
+}
+
+// indexedDestination returns the path of item i of a list output written to destination.
+func indexedDestination(destination string, i int) string {
+	return fmt.Sprintf("%s.%d%s", r8_path.TrimExt(destination), i, path.Ext(destination))
+}
+
+func printPredictionEvent(event predict.Event) {
+	switch event.Type {
+	case predict.EventStart:
+		console.Infof("Prediction %s started", event.Response.ID)
+	case predict.EventLogs:
+		console.Info(strings.TrimSuffix(event.Logs, "\n"))
+	case predict.EventOutput:
+		output, err := json.Marshal(event.Response.Output)
+		if err != nil {
+			console.Debugf("Failed to encode prediction output: %s", err)
+			return
+		}
+		console.Infof("Output: %s", output)
+	case predict.EventCompleted:
+		console.Infof("Prediction %s completed with status %q", event.Response.ID, event.Response.Status)
+	}
+}
+
+// printMetrics prints the timings and metrics the server recorded for a prediction.
+func printMetrics(prediction *predict.Response) {
+	console.Info("")
+	if prediction.ID != "" {
+		console.Infof("Prediction ID: %s", prediction.ID)
+	}
+	if prediction.StartedAt != "" {
+		console.Infof("Started at: %s", prediction.StartedAt)
+	}
+	if prediction.CompletedAt != "" {
+		console.Infof("Completed at: %s", prediction.CompletedAt)
+	}
+
+	names := make([]string, 0, len(prediction.Metrics))
+	for name := range prediction.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		console.Infof("%s: %v", name, prediction.Metrics[name])
+	}
+	if len(names) == 0 {
+		console.Info("No metrics recorded")
+	}
+	console.Info("")
+}
+
+// maxMutedLogBytes is how much of the most recent muted output muteWriter
+// keeps, to write when it is unmuted.
+const maxMutedLogBytes = 64 * 1024
+
+// muteWriter forwards writes to w until it is muted. While muted, it keeps the
+// last maxMutedLogBytes written, which are written to w when it is unmuted.
+type muteWriter struct {
+	w     io.Writer
+	mu    sync.Mutex
+	muted bool
+	buf   []byte
+}
+
+func (m *muteWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.muted {
+		m.buf = append(m.buf, p...)
+		if len(m.buf) > maxMutedLogBytes {
+			m.buf = m.buf[len(m.buf)-maxMutedLogBytes:]
+		}
+		return len(p), nil
+	}
+	return m.w.Write(p)
+}
+
+func (m *muteWriter) Mute() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.muted = true
+}
+
+// Unmute writes the output kept while muted, then forwards writes to w again.
+func (m *muteWriter) Unmute() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.muted {
+		return
+	}
+	m.muted = false
+	if len(m.buf) > 0 {
+		_, _ = m.w.Write(m.buf)
+		m.buf = nil
+	}
+}
+
 func parseInputFlags(inputs []string, schema *openapi3.T) (predict.Inputs, error) {
 	keyVals := map[string][]string{}
 	for _, input := range inputs {
@@ -642,6 +1199,29 @@ func parseInputFlags(inputs []string, schema *openapi3.T) (predict.Inputs, error
 	return predict.NewInputs(keyVals, schema)
 }
 
+func addServerURLFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&serverURLFlag, "url", "", "URL of a running Cog server to use instead of building and running the model, e.g. http://localhost:5000")
+}
+
+func addFileTransferFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fileTransferFlag, "file-transfer", string(predict.FileTransferDataURL), "How to send input files: 'data-url' sends them in requests, 'http' serves them from this machine, which the container must be able to reach through the Docker bridge, 'auto' serves files over 25MB")
+	cmd.Flags().BoolVar(&uploadOutputsFlag, "upload-outputs", true, "Have the model upload output files straight to this machine through the Docker bridge, rather than return them as data URLs")
+}
+
+// fileTransferOptions returns the predictor options set by the flags added
+// with addFileTransferFlag.
+func fileTransferOptions() ([]predict.Option, error) {
+	fileTransfer, err := predict.ParseFileTransfer(fileTransferFlag)
+	if err != nil {
+		return nil, err
+	}
+	opts := []predict.Option{predict.WithFileTransfer(fileTransfer)}
+	if uploadOutputsFlag {
+		opts = append(opts, predict.WithOutputUploads())
+	}
+	return opts, nil
+}
+
 func addSetupTimeoutFlag(cmd *cobra.Command) {
 	cmd.Flags().Uint32Var(&setupTimeout, "setup-timeout", 5*60, "The timeout for a container to setup (in seconds).")
 }
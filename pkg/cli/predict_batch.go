@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+const batchSummaryFilename = "summary.jsonl"
+
+// batchResult is a line of the summary written after a batch of predictions.
+type batchResult struct {
+	Line            int       `json:"line"`
+	Status          string    `json:"status"`
+	Output          string    `json:"output,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// predictBatch runs a prediction for every line of a JSONL file of inputs, up to
+// concurrency at a time. The result of each line is written to <line>.json in
+// outputDir, alongside any files it outputs and a summary of the batch.
+func predictBatch(ctx context.Context, predictor *predict.Predictor, batchFile string, outputDir string, concurrency int) error {
+	lines, err := readBatchFile(batchFile)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("No inputs found in %s", batchFile)
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create output directory: %w", err)
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	console.Infof("Running %d predictions with concurrency %d...", len(lines), concurrency)
+
+	results := make([]batchResult, len(lines))
+	var mu sync.Mutex
+	completed := 0
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i, line := range lines {
+		g.Go(func() error {
+			result := runBatchLine(ctx, predictor, line.number, line.text, outputDir, schema)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = result
+			completed++
+			if result.Error != "" {
+				console.Warnf("[%d/%d] Line %d %s: %s", completed, len(lines), result.Line, result.Status, result.Error)
+			} else {
+				console.Infof("[%d/%d] Line %d %s in %.2fs", completed, len(lines), result.Line, result.Status, result.DurationSeconds)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	summary := strings.Builder{}
+	failed := 0
+	for _, result := range results {
+		if result.Status != "succeeded" {
+			failed++
+		}
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("Failed to encode batch summary: %w", err)
+		}
+		summary.Write(encoded)
+		summary.WriteString("\n")
+	}
+	summaryPath, err := files.WriteFile([]byte(summary.String()), filepath.Join(outputDir, batchSummaryFilename))
+	if err != nil {
+		return fmt.Errorf("Failed to write batch summary: %w", err)
+	}
+	console.Infof("Written summary to: %s", summaryPath)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d predictions failed", failed, len(lines))
+	}
+	return nil
+}
+
+type batchLine struct {
+	number int
+	text   string
+}
+
+// readBatchFile reads the non-empty lines of a JSONL file, or stdin if path is "-".
+func readBatchFile(path string) ([]batchLine, error) {
+	f := os.Stdin
+	if path != StdinPath {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read batch inputs: %w", err)
+		}
+		defer f.Close()
+	}
+
+	lines := []batchLine{}
+	scanner := bufio.NewScanner(f)
+	// Inputs can contain long strings, so allow lines well beyond the 64KiB default
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		lines = append(lines, batchLine{number: number, text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read batch inputs: %w", err)
+	}
+	return lines, nil
+}
+
+func runBatchLine(ctx context.Context, predictor *predict.Predictor, number int, text string, outputDir string, schema *openapi3.T) batchResult {
+	result := batchResult{Line: number, StartedAt: time.Now()}
+	fail := func(err error) batchResult {
+		result.Status = "failed"
+		result.Error = err.Error()
+		result.DurationSeconds = time.Since(result.StartedAt).Seconds()
+		return result
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+
+	jsonInputs, err := decodeJSONInputs([]byte(text))
+	if err != nil {
+		return fail(err)
+	}
+	inputs, err := jsonToInputs(jsonInputs)
+	if err != nil {
+		return fail(err)
+	}
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return fail(err)
+	}
+
+	prediction, err := predictor.Predict(inputs, predict.RequestContext{})
+	result.DurationSeconds = time.Since(result.StartedAt).Seconds()
+	if err != nil {
+		return fail(err)
+	}
+	result.Status = string(prediction.Status)
+	result.Error = prediction.Error
+
+	name := strconv.Itoa(number)
+	if prediction.Output != nil {
+		outputSchema := schema.Paths.Value("/predictions").Post.Responses.Value("200").Value.Content["application/json"].Schema.Value.Properties["output"].Value
+		transformed, err := processFileOutputs(predictor, *prediction.Output, outputSchema, filepath.Join(outputDir, name))
+		if err != nil {
+			return fail(err)
+		}
+		transformed, err = predictor.InlineFiles(transformed)
+		if err != nil {
+			return fail(err)
+		}
+		prediction.Output = &transformed
+	}
+	recordPrediction(ctx, predictor, inputs, prediction)
+
+	encoded, err := prettyJSONMarshal(prediction)
+	if err != nil {
+		return fail(err)
+	}
+	result.Output, err = files.WriteFile(encoded, filepath.Join(outputDir, name+".json"))
+	if err != nil {
+		return fail(fmt.Errorf("Failed to write output: %w", err))
+	}
+	return result
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inputs.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"prompt\": \"a\"}\n\n  {\"prompt\": \"b\"}  \n"), 0o644))
+
+	lines, err := readBatchFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []batchLine{
+		{number: 1, text: `{"prompt": "a"}`},
+		{number: 3, text: `{"prompt": "b"}`},
+	}, lines)
+}
@@ -0,0 +1,347 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// comparedPrediction is the result of the prediction on one side of a
+// comparison.
+type comparedPrediction struct {
+	Image   string
+	Latency time.Duration
+	Output  any
+	// OutputDir is where the output files of the prediction were written
+	OutputDir string
+}
+
+// predictCompare runs the same prediction on two images and prints the
+// differences between their outputs, and the latency of each.
+func predictCompare(ctx context.Context, images []string) error {
+	if inputJSON != "" && len(inputFlags) > 0 {
+		return fmt.Errorf("Must use one of --json or --input to provide model inputs")
+	}
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	outputDir := outPath
+	if outputDir == "" {
+		outputDir = "output"
+	}
+
+	predictors := make([]*predict.Predictor, 0, len(images))
+	defer func() {
+		for _, predictor := range predictors {
+			console.Debugf("Stopping container...")
+			// use background context to ensure stop signal is still sent after root context is canceled
+			if err := predictor.Stop(context.Background()); err != nil {
+				console.Warnf("Failed to stop container: %s", err)
+			}
+		}
+	}()
+
+	for _, imageName := range images {
+		predictor, err := startComparedPredictor(ctx, dockerClient, imageName)
+		if predictor != nil {
+			predictors = append(predictors, predictor)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The images may disagree on the types of inputs, so each parses them with
+	// its own schema. Both are checked before either prediction runs.
+	inputs := make([]predict.Inputs, len(predictors))
+	for i, predictor := range predictors {
+		if inputs[i], err = comparedInputs(predictor); err != nil {
+			return fmt.Errorf("Inputs don't match the schema of %s: %w", images[i], err)
+		}
+	}
+
+	results := make([]comparedPrediction, len(predictors))
+	for i, predictor := range predictors {
+		side := string(rune('a' + i))
+		// Predictions run one after the other, so they don't slow each other down
+		console.Infof("Running prediction on %s...", images[i])
+		result, err := runComparedPrediction(predictor, inputs[i], filepath.Join(outputDir, side))
+		if err != nil {
+			return fmt.Errorf("Failed to predict with %s: %w", images[i], err)
+		}
+		result.Image = images[i]
+		results[i] = *result
+	}
+
+	console.Output(formatComparison(results[0], results[1]))
+	return nil
+}
+
+// startComparedPredictor pulls an image and starts it, with the GPUs it was
+// built for unless --gpus is passed.
+func startComparedPredictor(ctx context.Context, dockerClient command.Command, imageName string) (*predict.Predictor, error) {
+	inspectResp, err := dockerClient.Pull(ctx, imageName, false)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to pull image %q: %w", imageName, err)
+	}
+	conf, err := image.CogConfigFromManifest(ctx, inspectResp)
+	if err != nil {
+		return nil, err
+	}
+	gpus := gpusFlag
+	if gpus == "" && conf.Build.GPU {
+		gpus = "all"
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	env, err := runtimeEnv(envFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	predictor, err := predict.NewPredictor(ctx, command.RunOptions{
+		GPUs:  gpus,
+		Image: imageName,
+		Env:   env,
+	}, false, false, dockerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	handleInterrupts(ctx, func() *predict.Predictor { return predictor })
+
+	logsWriter := &muteWriter{w: os.Stderr}
+	if err := predictor.Start(ctx, logsWriter, time.Duration(setupTimeout)*time.Second); err != nil {
+		return predictor, err
+	}
+	// Logs of the other container would be interleaved with these
+	logsWriter.Mute()
+	return predictor, nil
+}
+
+// comparedInputs parses the inputs from --json or --input flags with the
+// schema of predictor, and validates them against it.
+func comparedInputs(predictor *predict.Predictor) (predict.Inputs, error) {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	var inputs predict.Inputs
+	if inputJSON != "" {
+		jsonInputs, err := parseJSONInput(inputJSON)
+		if err != nil {
+			return nil, err
+		}
+		if inputs, err = jsonToInputs(jsonInputs); err != nil {
+			return nil, err
+		}
+	} else if inputs, err = parseInputFlags(inputFlags, schema); err != nil {
+		return nil, err
+	}
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// runComparedPrediction runs a prediction and writes its output files in
+// outputDir.
+func runComparedPrediction(predictor *predict.Predictor, inputs predict.Inputs, outputDir string) (*comparedPrediction, error) {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	prediction, err := predictor.Predict(inputs, predict.RequestContext{})
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+	if prediction.Status != "succeeded" {
+		return nil, fmt.Errorf("Prediction failed with status %q: %s", prediction.Status, prediction.Error)
+	}
+
+	result := &comparedPrediction{Latency: latency, OutputDir: outputDir}
+	if prediction.Output == nil {
+		return result, nil
+	}
+	outputSchema := schema.Paths.Value("/predictions").Post.Responses.Value("200").Value.Content["application/json"].Schema.Value.Properties["output"].Value
+	// Files are written inside outputDir, rather than next to it, so both
+	// sides can be told apart
+	if result.Output, err = writeFileOutputs(predictor, *prediction.Output, outputSchema, filepath.Join(outputDir, "output")); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// formatComparison describes the latency of two predictions and the
+// differences between their outputs.
+func formatComparison(a comparedPrediction, b comparedPrediction) string {
+	s := &strings.Builder{}
+	fmt.Fprintf(s, "A: %s (%.2fs)\n", a.Image, a.Latency.Seconds())
+	fmt.Fprintf(s, "B: %s (%.2fs)\n", b.Image, b.Latency.Seconds())
+	fmt.Fprintln(s)
+
+	differences := diffOutputs("output", a.Output, b.Output, a.OutputDir, b.OutputDir)
+	if len(differences) == 0 {
+		s.WriteString("Outputs are identical")
+		return s.String()
+	}
+	s.WriteString(strings.Join(differences, "\n"))
+	return s.String()
+}
+
+// diffOutputs returns the differences between output a and output b, each
+// prefixed with the path to them, e.g. output.masks[0]. Strings that are
+// paths to files in dirA and dirB are compared as files.
+func diffOutputs(path string, a any, b any, dirA string, dirB string) []string {
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			return diffObjects(path, a, b, dirA, dirB)
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			return diffArrays(path, a, b, dirA, dirB)
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			if isOutputFile(a, dirA) && isOutputFile(b, dirB) {
+				return diffFiles(path, a, b)
+			}
+			return diffStrings(path, a, b)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: A is %s, B is %s", path, compactJSON(a), compactJSON(b))}
+}
+
+func diffObjects(path string, a map[string]any, b map[string]any, dirA string, dirB string) []string {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	differences := []string{}
+	for _, key := range sorted {
+		valueA, inA := a[key]
+		valueB, inB := b[key]
+		keyPath := path + "." + key
+		switch {
+		case !inB:
+			differences = append(differences, fmt.Sprintf("%s: only in A, %s", keyPath, compactJSON(valueA)))
+		case !inA:
+			differences = append(differences, fmt.Sprintf("%s: only in B, %s", keyPath, compactJSON(valueB)))
+		default:
+			differences = append(differences, diffOutputs(keyPath, valueA, valueB, dirA, dirB)...)
+		}
+	}
+	return differences
+}
+
+func diffArrays(path string, a []any, b []any, dirA string, dirB string) []string {
+	differences := []string{}
+	if len(a) != len(b) {
+		differences = append(differences, fmt.Sprintf("%s: A has %d items, B has %d", path, len(a), len(b)))
+	}
+	for i := range min(len(a), len(b)) {
+		differences = append(differences, diffOutputs(path+"["+strconv.Itoa(i)+"]", a[i], b[i], dirA, dirB)...)
+	}
+	return differences
+}
+
+// diffStrings compares two strings, with a line diff if either has several
+// lines.
+func diffStrings(path string, a string, b string) []string {
+	if a == b {
+		return nil
+	}
+	if !strings.Contains(a, "\n") && !strings.Contains(b, "\n") {
+		return []string{fmt.Sprintf("%s: A is %q, B is %q", path, a, b)}
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: "A",
+		ToFile:   "B",
+		Context:  3,
+	})
+	if err != nil {
+		return []string{fmt.Sprintf("%s: A is %q, B is %q", path, a, b)}
+	}
+	return []string{fmt.Sprintf("%s:\n%s", path, strings.TrimSuffix(diff, "\n"))}
+}
+
+// diffFiles compares two output files by their hashes, and describes how
+// similar they are if they differ.
+func diffFiles(path string, a string, b string) []string {
+	dataA, errA := os.ReadFile(a)
+	dataB, errB := os.ReadFile(b)
+	if errA != nil || errB != nil {
+		return []string{fmt.Sprintf("%s: Failed to read output files: %v", path, firstError(errA, errB))}
+	}
+	hashA, hashB := sha256.Sum256(dataA), sha256.Sum256(dataB)
+	if hashA == hashB {
+		return nil
+	}
+
+	difference := fmt.Sprintf("%s: files differ\n  A: %s, %d bytes, sha256 %s\n  B: %s, %d bytes, sha256 %s",
+		path, a, len(dataA), hex.EncodeToString(hashA[:]), b, len(dataB), hex.EncodeToString(hashB[:]))
+	// Images are compared pixel by pixel, and other files of the same size
+	// byte by byte, e.g. uncompressed audio
+	if d, err := fileDifference(dataA, dataB); err == nil {
+		difference += fmt.Sprintf("\n  similarity: %.2f%%", (1-d)*100)
+	}
+	return []string{difference}
+}
+
+// isOutputFile returns true if s is the path of a file written in dir.
+func isOutputFile(s string, dir string) bool {
+	rel, err := filepath.Rel(dir, s)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	info, err := os.Stat(s)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func TestDiffOutputs(t *testing.T) {
+	a := map[string]any{"label": "cat", "scores": []any{0.5, 0.25}, "extra": true}
+	b := map[string]any{"label": "dog", "scores": []any{0.5, 0.75, 1.0}}
+	require.Equal(t, []string{
+		`output.extra: only in A, true`,
+		`output.label: A is "cat", B is "dog"`,
+		`output.scores: A has 2 items, B has 3`,
+		`output.scores[1]: A is 0.25, B is 0.75`,
+	}, diffOutputs("output", a, b, "a", "b"))
+
+	require.Empty(t, diffOutputs("output", a, a, "a", "b"))
+
+	differences := diffOutputs("output", "one\ntwo\n", "one\nthree\n", "a", "b")
+	require.Len(t, differences, 1)
+	require.Contains(t, differences[0], "-two\n+three")
+}
+
+func TestDiffOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	dirA, dirB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	require.NoError(t, os.MkdirAll(dirA, 0o755))
+	require.NoError(t, os.MkdirAll(dirB, 0o755))
+	fileA, fileB := filepath.Join(dirA, "output.bin"), filepath.Join(dirB, "output.bin")
+	require.NoError(t, os.WriteFile(fileA, []byte{0, 0, 0, 0}, 0o644))
+	require.NoError(t, os.WriteFile(fileB, []byte{0, 0, 0, 0}, 0o644))
+
+	require.Empty(t, diffOutputs("output", fileA, fileB, dirA, dirB))
+
+	require.NoError(t, os.WriteFile(fileB, []byte{0, 0, 0, 0xff}, 0o644))
+	differences := diffOutputs("output", fileA, fileB, dirA, dirB)
+	require.Len(t, differences, 1)
+	require.Contains(t, differences[0], "files differ")
+	require.Contains(t, differences[0], "similarity: 75.00%")
+
+	// Paths outside the output directories are compared as strings
+	require.Equal(t, []string{`output: A is "` + fileA + `", B is "` + fileB + `"`}, diffOutputs("output", fileA, fileB, dirB, dirA))
+}
+
+func TestComparedInputsUseTheSchemaOfEachImage(t *testing.T) {
+	serve := func(inputSchema string) *predict.Predictor {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"openapi": "3.0.2", "info": {"title": "Cog", "version": "0.1.0"}, "paths": {}, "components": {"schemas": {"Input": %s}}}`, inputSchema)
+		}))
+		t.Cleanup(server.Close)
+		predictor, err := predict.NewRemotePredictor(server.URL, false)
+		require.NoError(t, err)
+		return predictor
+	}
+	integerSteps := serve(`{"type": "object", "properties": {"steps": {"type": "integer"}}}`)
+	stringSteps := serve(`{"type": "object", "properties": {"steps": {"type": "string"}}}`)
+	noSteps := serve(`{"type": "object", "properties": {"prompt": {"type": "string"}}}`)
+
+	oldInputFlags := inputFlags
+	inputFlags = []string{"steps=5"}
+	t.Cleanup(func() { inputFlags = oldInputFlags })
+
+	inputs, err := comparedInputs(integerSteps)
+	require.NoError(t, err)
+	require.NotNil(t, inputs["steps"].Json)
+	require.JSONEq(t, "5", string(*inputs["steps"].Json))
+
+	inputs, err = comparedInputs(stringSteps)
+	require.NoError(t, err)
+	require.Equal(t, "5", *inputs["steps"].String)
+
+	_, err = comparedInputs(noSteps)
+	require.ErrorContains(t, err, "steps")
+}
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// predictInteractively prompts for the inputs of the model and runs a
+// prediction with them, over and over, until stdin is closed. The inputs of a
+// prediction are the defaults of the next one, so they can be tweaked one at a
+// time. initialInputs are --input flags, used as the first defaults.
+func predictInteractively(ctx context.Context, predictor *predict.Predictor, initialInputs []string, predictionDone func()) error {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	ref, ok := schema.Components.Schemas["Input"]
+	if !ok || ref.Value == nil {
+		return fmt.Errorf("Failed to find the inputs of the model in its schema")
+	}
+	inputSchema := ref.Value
+
+	values := map[string]string{}
+	for _, input := range initialInputs {
+		name, value, ok := strings.Cut(input, "=")
+		if !ok {
+			return fmt.Errorf("Failed to parse input '%s', expected format is 'name=value'", input)
+		}
+		values[name] = value
+	}
+
+	console.Info("")
+	console.Info("Enter the inputs of each prediction. Press Enter to keep the value in brackets, Ctrl-C to cancel a prediction, and Ctrl-D to exit.")
+	for {
+		console.Info("")
+		flags := []string{}
+		for _, name := range orderedInputNames(inputSchema) {
+			value, err := promptInput(name, inputSchema, values[name])
+			if errors.Is(err, io.EOF) {
+				console.Info("")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				delete(values, name)
+				continue
+			}
+			values[name] = value
+			flags = append(flags, name+"="+value)
+		}
+
+		inputs, err := parseInputFlags(flags, schema)
+		if err == nil {
+			err = predictor.ValidateInputs(inputs, schema)
+		}
+		if err != nil {
+			console.Warnf("%s", err)
+			continue
+		}
+
+		err = runPrediction(ctx, predictor, inputs, outPath, false, false)
+		predictionDone()
+		if err != nil {
+			console.Warnf("%s", err)
+		}
+	}
+}
+
+// promptInput asks for the value of an input, in the format of --input.
+func promptInput(name string, inputSchema *openapi3.Schema, previous string) (string, error) {
+	property := inputSchema.Properties[name].Value
+	options := inputChoices(property)
+
+	value := previous
+	if value == "" && property.Default != nil {
+		value = formatInputValue(property.Default)
+	}
+	if options != nil && !containsString(options, value) {
+		value = ""
+	}
+
+	prompt := name
+	if isURI(property) {
+		prompt += " (prefix files with @)"
+	}
+	return console.Interactive{
+		Prompt:      prompt,
+		Description: property.Description,
+		Default:     value,
+		Options:     options,
+		Required:    value == "" && containsString(inputSchema.Required, name),
+	}.Read()
+}
+
+// orderedInputNames returns the names of the inputs in the order they are
+// declared in predict().
+func orderedInputNames(inputSchema *openapi3.Schema) []string {
+	names := make([]string, 0, len(inputSchema.Properties))
+	for name, property := range inputSchema.Properties {
+		if property.Value != nil {
+			names = append(names, name)
+		}
+	}
+	order := func(name string) float64 {
+		if order, ok := inputSchema.Properties[name].Value.Extensions["x-order"].(float64); ok {
+			return order
+		}
+		return float64(len(names))
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if order(names[i]) != order(names[j]) {
+			return order(names[i]) < order(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// inputChoices returns the choices of an input, which Cog declares as a
+// reference to an enum, or nil if any value is allowed.
+func inputChoices(property *openapi3.Schema) []string {
+	enum := property.Enum
+	if len(enum) == 0 && len(property.AllOf) == 1 && property.AllOf[0].Value != nil {
+		enum = property.AllOf[0].Value.Enum
+	}
+	if len(enum) == 0 {
+		return nil
+	}
+	options := make([]string, len(enum))
+	for i, choice := range enum {
+		options[i] = formatInputValue(choice)
+	}
+	return options
+}
+
+func formatInputValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInteractiveInterrupts cancels the running prediction on Ctrl-C, so
+// the next one can be entered. Ctrl-C stops the container and exits if no
+// prediction is running, or if the prediction hasn't stopped since the last
+// Ctrl-C. The returned function must be called when a prediction finishes.
+func handleInteractiveInterrupts(ctx context.Context, predictor func() *predict.Predictor) (predictionDone func()) {
+	captureSignal := make(chan os.Signal, 1)
+	signal.Notify(captureSignal, syscall.SIGINT)
+
+	var canceled atomic.Bool
+	go func() {
+		for range captureSignal {
+			if !canceled.Load() {
+				err := predictor().Cancel(ctx)
+				if err == nil {
+					console.Info("Canceling prediction, press Ctrl-C again to stop the container...")
+					canceled.Store(true)
+					continue
+				}
+				if !errors.Is(err, predict.ErrNoPrediction) {
+					console.Warnf("Failed to cancel prediction: %s", err)
+				}
+			}
+
+			console.Info("")
+			console.Info("Stopping container...")
+			if err := predictor().Stop(ctx); err != nil {
+				console.Warnf("Failed to stop container: %s", err)
+			}
+			os.Exit(130)
+		}
+	}()
+	return func() { canceled.Store(false) }
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedInputNames(t *testing.T) {
+	schema := loadSchema(t, `{
+		"type": "object",
+		"properties": {
+			"steps": {"type": "integer", "default": 50, "x-order": 1},
+			"prompt": {"type": "string", "x-order": 0},
+			"scheduler": {"allOf": [{"type": "string", "enum": ["DDIM", "K_EULER"]}], "default": "DDIM", "x-order": 2},
+			"seed": {"type": "integer"}
+		}
+	}`)
+
+	require.Equal(t, []string{"prompt", "steps", "scheduler", "seed"}, orderedInputNames(schema))
+	require.Equal(t, []string{"DDIM", "K_EULER"}, inputChoices(schema.Properties["scheduler"].Value))
+	require.Nil(t, inputChoices(schema.Properties["prompt"].Value))
+	require.Equal(t, "50", formatInputValue(schema.Properties["steps"].Value.Default))
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// streamRenderer prints the items of an iterator output as they arrive, and
+// writes file items to disk as soon as they are produced.
+type streamRenderer struct {
+	predictor   *predict.Predictor
+	schema      *openapi3.Schema
+	destination string
+	concatenate bool
+	items       int
+}
+
+func newStreamRenderer(predictor *predict.Predictor, schema *openapi3.Schema, destination string) *streamRenderer {
+	return &streamRenderer{
+		predictor:   predictor,
+		schema:      schema,
+		destination: destination,
+		concatenate: isIterator(schema) && schema.Extensions["x-cog-array-display"] == "concatenate",
+	}
+}
+
+// isIterator returns true if schema is the output of a model that returns an Iterator.
+func isIterator(schema *openapi3.Schema) bool {
+	return schema != nil && schema.Type.Is("array") && schema.Items != nil && schema.Extensions["x-cog-array-type"] == "iterator"
+}
+
+func (r *streamRenderer) handleEvent(event predict.Event) {
+	switch event.Type {
+	case predict.EventLogs:
+		console.Info(strings.TrimSuffix(event.Logs, "\n"))
+	case predict.EventOutput:
+		if !isIterator(r.schema) {
+			return
+		}
+		for _, item := range event.NewOutput {
+			if err := r.renderItem(item); err != nil {
+				console.Warnf("Failed to render output %d: %s", r.items, err)
+			}
+			r.items++
+		}
+	}
+}
+
+func (r *streamRenderer) renderItem(item any) error {
+	itemSchema := r.schema.Items.Value
+	switch {
+	case isURI(itemSchema):
+		_, err := processFileOutputs(r.predictor, item, itemSchema, indexedDestination(r.destination, r.items))
+		return err
+	case itemSchema.Type.Is("string"):
+		s, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("Failed to convert prediction output to string")
+		}
+		if r.concatenate {
+			fmt.Fprint(os.Stdout, s)
+		} else {
+			console.Output(s)
+		}
+		return nil
+	default:
+		item, err := r.predictor.InlineFiles(item)
+		if err != nil {
+			return err
+		}
+		output, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("Failed to encode prediction output: %w", err)
+		}
+		console.Output(string(output))
+		return nil
+	}
+}
+
+// finish terminates the streamed output. It returns true if the output was
+// rendered while streaming and doesn't need to be printed again.
+func (r *streamRenderer) finish() bool {
+	if r.concatenate && r.items > 0 {
+		fmt.Fprintln(os.Stdout)
+	}
+	return isIterator(r.schema)
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func loadSchema(t *testing.T, data string) *openapi3.Schema {
+	t.Helper()
+	schema := &openapi3.Schema{}
+	require.NoError(t, json.Unmarshal([]byte(data), schema))
+	return schema
+}
+
+func TestProcessFileOutputsNested(t *testing.T) {
+	schema := loadSchema(t, `{
+		"type": "object",
+		"properties": {
+			"image": {"type": "string", "format": "uri"},
+			"masks": {"type": "array", "items": {"type": "string", "format": "uri"}},
+			"caption": {"type": "string"},
+			"extra": {"anyOf": [{"type": "string", "format": "uri"}, {"type": "null"}]}
+		}
+	}`)
+	require.True(t, hasNestedFiles(schema))
+
+	destination := filepath.Join(t.TempDir(), "output")
+	output, err := processFileOutputs(&predict.Predictor{}, map[string]any{
+		"image":   "data:text/plain;base64,aW1hZ2U=",
+		"masks":   []any{"data:text/plain;base64,MA==", "data:text/plain;base64,MQ=="},
+		"caption": "a cat",
+		"extra":   nil,
+	}, schema, destination)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]any{
+		"image":   filepath.Join(destination, "image.txt"),
+		"masks":   []any{filepath.Join(destination, "masks", "0.txt"), filepath.Join(destination, "masks", "1.txt")},
+		"caption": "a cat",
+		"extra":   nil,
+	}, output)
+
+	content, err := os.ReadFile(filepath.Join(destination, "masks", "1.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(content))
+}
+
+func TestProcessFileOutputsRejectsTraversalKeys(t *testing.T) {
+	schema := loadSchema(t, `{"type": "object", "additionalProperties": {"type": "string", "format": "uri"}}`)
+
+	dir := t.TempDir()
+	destination := filepath.Join(dir, "out", "output")
+	for _, key := range []string{"../../escaped", "..", `..\escaped`, ""} {
+		_, err := processFileOutputs(&predict.Predictor{}, map[string]any{key: "data:text/plain;base64,aGk="}, schema, destination)
+		require.ErrorContains(t, err, "Failed to write output")
+	}
+	require.NoFileExists(t, filepath.Join(dir, "escaped.txt"))
+
+	output, err := processFileOutputs(&predict.Predictor{}, map[string]any{"mask": "data:text/plain;base64,aGk="}, schema, destination)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"mask": filepath.Join(destination, "mask.txt")}, output)
+}
+
+func TestProcessFileOutputsList(t *testing.T) {
+	schema := loadSchema(t, `{"type": "array", "items": {"type": "string", "format": "uri"}}`)
+	require.False(t, hasNestedFiles(schema))
+
+	destination := filepath.Join(t.TempDir(), "output")
+	output, err := processFileOutputs(&predict.Predictor{}, []any{"data:text/plain;base64,MA=="}, schema, destination)
+	require.NoError(t, err)
+	require.Equal(t, []any{destination + ".0.txt"}, output)
+}
+
+func TestMuteWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &muteWriter{w: &out}
+	_, _ = w.Write([]byte("setup\n"))
+	w.Mute()
+	_, _ = w.Write([]byte("Traceback (most recent call last):\n"))
+	require.Equal(t, "setup\n", out.String())
+
+	w.Unmute()
+	_, _ = w.Write([]byte("after\n"))
+	require.Equal(t, "setup\nTraceback (most recent call last):\nafter\n", out.String())
+}
+
+func TestMuteWriterKeepsLatestOutput(t *testing.T) {
+	var out bytes.Buffer
+	w := &muteWriter{w: &out}
+	w.Mute()
+	_, _ = w.Write(bytes.Repeat([]byte("a"), maxMutedLogBytes))
+	_, _ = w.Write([]byte("crash"))
+	w.Unmute()
+	require.Equal(t, maxMutedLogBytes, out.Len())
+	require.True(t, strings.HasSuffix(out.String(), "crash"))
+}
+
+func TestDecodeJSONInputsKeepsLargeIntegers(t *testing.T) {
+	inputs, err := decodeJSONInputs([]byte(`{"seed": 9007199254740993, "prompt": "a cat"}`))
+	require.NoError(t, err)
+	predictInputs, err := jsonToInputs(inputs)
+	require.NoError(t, err)
+	require.Equal(t, `9007199254740993`, string(*predictInputs["seed"].Json))
+
+	_, err = decodeJSONInputs([]byte(`{"seed": 1} {}`))
+	require.ErrorContains(t, err, "Failed to parse JSON")
+}
@@ -0,0 +1,318 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	// historyDir is where predictions and trainings are recorded. It is set by
+	// the commands that run them.
+	historyDir string
+	// historyEnv is how the environment of the model was set, recorded with
+	// its predictions. It is set by the commands that start the model.
+	historyEnv *predict.RecordEnv
+	// rerunOf is the ID of the prediction being run again by cog predictions rerun
+	rerunOf string
+
+	predictionsLimit int
+	rerunImage       string
+	rerunOutPath     string
+)
+
+func newPredictionsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "predictions",
+		Short: "List, show and rerun past predictions",
+		Long: `List, show and rerun past predictions.
+
+Every prediction and training run with cog predict and cog train is recorded in
+.cog/predictions in the project, with copies of its input files, so it can be
+inspected and run again later.`,
+	}
+
+	cmd.AddCommand(
+		newPredictionsListCommand(),
+		newPredictionsShowCommand(),
+		newPredictionsRerunCommand(),
+	)
+	return cmd
+}
+
+func newPredictionsListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List past predictions, newest first",
+		RunE:  cmdPredictionsList,
+		Args:  cobra.NoArgs,
+	}
+	addConfigFlag(cmd)
+	cmd.Flags().IntVarP(&predictionsLimit, "limit", "n", 20, "Number of predictions to list, or 0 for all")
+	return cmd
+}
+
+func newPredictionsShowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show the inputs, outputs and metrics of a past prediction",
+		Long: `Show the inputs, outputs and metrics of a past prediction.
+
+The ID can be shortened to any prefix that identifies a single prediction.`,
+		RunE: cmdPredictionsShow,
+		Args: cobra.ExactArgs(1),
+	}
+	addConfigFlag(cmd)
+	return cmd
+}
+
+func newPredictionsRerunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rerun <id>",
+		Short: "Run a past prediction again",
+		Long: `Run a past prediction again, with the same inputs.
+
+It runs on the same image as the original prediction, unless another image is
+passed with --image, with the same -e variables and env files. The ID can be
+shortened to any prefix that identifies a single prediction.`,
+		RunE: cmdPredictionsRerun,
+		Args: cobra.ExactArgs(1),
+	}
+
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+	addConfigFlag(cmd)
+
+	cmd.Flags().StringVar(&rerunImage, "image", "", "Run the prediction on this image instead")
+	cmd.Flags().StringVarP(&rerunOutPath, "output", "o", "", "Output path")
+	return cmd
+}
+
+// predictionHistoryDir returns the directory predictions of the project in
+// projectDir are recorded in.
+func predictionHistoryDir(projectDir string) string {
+	return filepath.Join(projectDir, global.CogBuildArtifactsFolder, "predictions")
+}
+
+// projectHistoryDir returns the history directory of the project in the
+// current directory, or of the current directory if it isn't in a project.
+func projectHistoryDir() string {
+	projectDir, err := config.GetProjectDir(configFilename)
+	if err != nil {
+		return predictionHistoryDir(".")
+	}
+	return predictionHistoryDir(projectDir)
+}
+
+// recordPrediction records a prediction in the history. Failing to record it
+// doesn't fail the prediction.
+func recordPrediction(ctx context.Context, predictor *predict.Predictor, inputs predict.Inputs, prediction *predict.Response) {
+	if historyDir == "" {
+		return
+	}
+	var output any
+	if prediction.Output != nil {
+		output = *prediction.Output
+	}
+	record, err := predictor.SaveRecord(ctx, historyDir, inputs, prediction, output, historyEnv, rerunOf)
+	if err != nil {
+		console.Warnf("Failed to record prediction: %s", err)
+		return
+	}
+	console.Debugf("Recorded prediction %s", record.ID)
+}
+
+// recordedEnv returns how the environment is set by the -e flags in vars and
+// the --env-file flags, to be recorded with predictions.
+func recordedEnv(vars []string) (*predict.RecordEnv, error) {
+	env := &predict.RecordEnv{
+		Vars:      vars,
+		NoEnvFile: noEnvFile,
+	}
+	for _, path := range envFiles {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		env.Files = append(env.Files, absPath)
+	}
+	return env, nil
+}
+
+// rerunEnv returns the environment variables of a recorded prediction, reading
+// its env files again.
+func rerunEnv(record *predict.Record) ([]string, error) {
+	if record.Env == nil {
+		return runtimeEnv(nil)
+	}
+	envFiles = record.Env.Files
+	noEnvFile = record.Env.NoEnvFile
+	return runtimeEnv(record.Env.Vars)
+}
+
+func cmdPredictionsList(cmd *cobra.Command, args []string) error {
+	records, err := predict.ListRecords(projectHistoryDir())
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		console.Info("No predictions recorded yet, run cog predict to record one")
+		return nil
+	}
+	if predictionsLimit > 0 && len(records) > predictionsLimit {
+		records = records[:predictionsLimit]
+	}
+
+	table := &strings.Builder{}
+	w := tabwriter.NewWriter(table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tTYPE\tSTATUS\tPREDICT TIME\tIMAGE")
+	for _, record := range records {
+		kind := "prediction"
+		if record.IsTrain {
+			kind = "training"
+		}
+		predictTime := "-"
+		if seconds, ok := record.Metrics["predict_time"].(float64); ok {
+			predictTime = fmt.Sprintf("%.2fs", seconds)
+		}
+		image := record.Image
+		if image == "" {
+			image = record.ServerURL
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", record.ID, record.CreatedAt.Local().Format(time.DateTime), kind, record.Status, predictTime, image)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	console.Output(strings.TrimSuffix(table.String(), "\n"))
+	return nil
+}
+
+func cmdPredictionsShow(cmd *cobra.Command, args []string) error {
+	record, err := predict.LoadRecord(projectHistoryDir(), args[0])
+	if err != nil {
+		return err
+	}
+	output, err := prettyJSONMarshal(record)
+	if err != nil {
+		return err
+	}
+	console.Output(string(output))
+	return nil
+}
+
+func cmdPredictionsRerun(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	historyDir = projectHistoryDir()
+	record, err := predict.LoadRecord(historyDir, args[0])
+	if err != nil {
+		return err
+	}
+	inputs, err := record.RerunInputs(historyDir)
+	if err != nil {
+		return err
+	}
+	rerunOf = record.ID
+	historyEnv = record.Env
+
+	if rerunImage == "" && record.Image == "" {
+		if record.ServerURL == "" {
+			return fmt.Errorf("Prediction %s has no image, pass one with --image", record.ID)
+		}
+		return predictOnServer(ctx, record.ServerURL, record.IsTrain, func(predictor *predict.Predictor) error {
+			return rerunPrediction(ctx, predictor, inputs, record.IsTrain)
+		})
+	}
+
+	env, err := rerunEnv(record)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	imageName := rerunImage
+	gpus := gpusFlag
+	volumes := []command.Volume{}
+	if imageName == "" {
+		imageName = record.Image
+		if gpus == "" {
+			gpus = record.GPUs
+		}
+		if record.SourceDir != "" {
+			// The model was run from source mounted on a base image
+			volumes = append(volumes, command.Volume{Source: record.SourceDir, Destination: "/src"})
+		}
+	}
+
+	inspectResp, err := dockerClient.Pull(ctx, imageName, false)
+	if err != nil {
+		return fmt.Errorf("Failed to pull image %q: %w", imageName, err)
+	}
+	if rerunImage == "" && record.ImageID != "" && inspectResp.ID != record.ImageID {
+		console.Warnf("Image %s has changed since prediction %s was run", imageName, record.ID)
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	runOptions := command.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     env,
+	}
+	if record.IsTrain {
+		runOptions.Args = []string{"python", "-m", "cog.server.http", "--x-mode", "train"}
+	}
+	predictor, err := predict.NewPredictor(ctx, runOptions, record.IsTrain, false, dockerClient)
+	if err != nil {
+		return err
+	}
+
+	handleInterrupts(ctx, func() *predict.Predictor { return predictor })
+
+	if err := predictor.Start(ctx, os.Stderr, time.Duration(setupTimeout)*time.Second); err != nil {
+		return err
+	}
+
+	defer func() {
+		console.Debugf("Stopping container...")
+		// use background context to ensure stop signal is still sent after root context is canceled
+		if err := predictor.Stop(context.Background()); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	return rerunPrediction(ctx, predictor, inputs, record.IsTrain)
+}
+
+// rerunPrediction checks recorded inputs against the schema of the model they
+// are run on, which may be a different image, and runs the prediction.
+func rerunPrediction(ctx context.Context, predictor *predict.Predictor, inputs predict.Inputs, isTrain bool) error {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		return err
+	}
+	return runPrediction(ctx, predictor, inputs, rerunOutPath, isTrain, false)
+}
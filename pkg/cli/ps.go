@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newPsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List running model containers",
+		Long: `List running model containers.
+
+Lists the containers started by cog serve -d and cog predict --keep-warm, with
+the status of their server. The config column says whether cog.yaml has
+changed since the container was started.`,
+		RunE: cmdPs,
+		Args: cobra.NoArgs,
+	}
+	addConfigFlag(cmd)
+	return cmd
+}
+
+func cmdPs(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	containers, err := listCogContainers(ctx, dockerClient)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		console.Info("No model containers are running")
+		return nil
+	}
+
+	table := &strings.Builder{}
+	w := tabwriter.NewWriter(table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tTYPE\tURL\tHEALTH\tCONFIG\tUP\tPROJECT")
+	for _, c := range containers {
+		kind := "serve"
+		if c.Warm {
+			kind = "warm"
+		}
+		url := "-"
+		if c.Port != 0 {
+			url = fmt.Sprintf("http://127.0.0.1:%d", c.Port)
+		}
+		configStatus := "-"
+		if c.ConfigHash != "" && c.ProjectDir != "" {
+			if hash, err := configHash(c.ProjectDir); err == nil && hash == c.ConfigHash {
+				configStatus = "current"
+			} else {
+				configStatus = "changed"
+			}
+		}
+		up := "-"
+		if !c.StartedAt.IsZero() {
+			up = time.Since(c.StartedAt).Round(time.Second).String()
+		}
+		project := c.ProjectDir
+		if project == "" {
+			project = c.Image
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", shortContainerID(c.ID), kind, url, containerHealth(ctx, c.Port), configStatus, up, project)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	console.Output(strings.TrimSuffix(table.String(), "\n"))
+	return nil
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/http"
-	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 )
@@ -44,6 +43,9 @@ func newPushCommand() *cobra.Command {
 	addLocalImage(cmd)
 	addConfigFlag(cmd)
 	addPipelineImage(cmd)
+	addPlatformFlag(cmd)
+	addBuilderFlag(cmd)
+	addCacheFlags(cmd)
 
 	return cmd
 }
@@ -51,7 +53,7 @@ func newPushCommand() *cobra.Command {
 func push(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
-	dockerClient, err := docker.NewClient(ctx)
+	dockerClient, err := docker.NewClient(ctx, builderOptions()...)
 	if err != nil {
 		return err
 	}
@@ -104,27 +106,8 @@ func push(cmd *cobra.Command, args []string) error {
 
 	startBuildTime := time.Now()
 	registryClient := registry.NewRegistryClient()
-	if err := image.Build(
-		ctx,
-		cfg,
-		projectDir,
-		imageName,
-		buildSecrets,
-		buildNoCache,
-		buildSeparateWeights,
-		buildUseCudaBaseImage,
-		buildProgressOutput,
-		buildSchemaFile,
-		buildDockerfileFile,
-		DetermineUseCogBaseImage(cmd),
-		buildStrip,
-		buildPrecompile,
-		buildFast,
-		annotations,
-		buildLocalImage,
-		dockerClient,
-		registryClient,
-		pipelinesImage); err != nil {
+	imageNames, err := buildImages(ctx, cmd, cfg, projectDir, imageName, annotations, nil, dockerClient, registryClient)
+	if err != nil {
 		return err
 	}
 
@@ -135,11 +118,16 @@ func push(cmd *cobra.Command, args []string) error {
 		console.Info("Fast push enabled.")
 	}
 
-	err = docker.Push(ctx, imageName, buildFast, projectDir, dockerClient, docker.BuildInfo{
+	buildInfo := docker.BuildInfo{
 		BuildTime: buildDuration,
 		BuildID:   buildID.String(),
 		Pipeline:  pipelinesImage,
-	}, client, cfg)
+	}
+	if len(imageNames) > 1 {
+		err = docker.PlatformPush(ctx, imageName, imageNames, dockerClient, registryClient, buildInfo, client)
+	} else {
+		err = docker.Push(ctx, imageName, buildFast, projectDir, dockerClient, buildInfo, client, cfg)
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "404") {
 			err = fmt.Errorf("Unable to find existing Replicate model for %s. "+
@@ -36,14 +36,22 @@ https://github.com/replicate/cog`,
 	setPersistentFlags(&rootCmd)
 
 	rootCmd.AddCommand(
+		newBenchCommand(),
 		newBuildCommand(),
 		newDebugCommand(),
+		newEnvCommand(),
 		newInitCommand(),
+		newLockCommand(),
 		newLoginCommand(),
+		newLogsCommand(),
 		newPredictCommand(),
+		newPredictionsCommand(),
+		newPsCommand(),
 		newPushCommand(),
 		newRunCommand(),
 		newServeCommand(),
+		newStopCommand(),
+		newTestCommand(),
 		newTrainCommand(),
 		newMigrateCommand(),
 		newPullCommand(),
@@ -40,6 +40,7 @@ func newRunCommand() *cobra.Command {
 	addLocalImage(cmd)
 	addConfigFlag(cmd)
 	addPipelineImage(cmd)
+	addEnvFileFlags(cmd)
 
 	flags := cmd.Flags()
 	// Flags after first argument are considered args and passed to command
@@ -90,7 +91,10 @@ func run(cmd *cobra.Command, args []string) error {
 			buildLocalImage,
 			dockerClient,
 			client,
-			pipelinesImage)
+			pipelinesImage,
+			registry.DefaultPlatform,
+			nil,
+			nil)
 		if err != nil {
 			return err
 		}
@@ -101,6 +105,11 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	env, err := runtimeEnv(envFlags)
+	if err != nil {
+		return err
+	}
+
 	gpus := ""
 	if gpusFlag != "" {
 		gpus = gpusFlag
@@ -110,7 +119,7 @@ func run(cmd *cobra.Command, args []string) error {
 
 	runOptions := command.RunOptions{
 		Args:    args,
-		Env:     envFlags,
+		Env:     env,
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: []command.Volume{{Source: projectDir, Destination: "/src"}},
@@ -1,6 +1,11 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -10,11 +15,17 @@ import (
 	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/serve"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
 var (
-	port = 8393
+	port                = 8393
+	serveWatch          bool
+	serveReplicaCount   int
+	serveGPUsPerReplica int
+	serveRouting        string
+	serveDetach         bool
 )
 
 func newServeCommand() *cobra.Command {
@@ -23,7 +34,17 @@ func newServeCommand() *cobra.Command {
 		Short: "Run a prediction HTTP server",
 		Long: `Run a prediction HTTP server.
 
-Generate and run an HTTP server based on the declared model inputs and outputs.`,
+Generate and run an HTTP server based on the declared model inputs and outputs.
+
+With --watch, the server is restarted when a file in the project changes, and
+the image is rebuilt when cog.yaml changes. Files ignored by .dockerignore are
+not watched.
+
+With --replicas, several containers are started, each with its own GPUs, and
+a load balancer on --port spreads predictions across them.
+
+With -d, the server runs in the background. Use cog ps, cog logs and cog stop
+to manage it.`,
 		RunE:       cmdServe,
 		Args:       cobra.MaximumNArgs(0),
 		SuggestFor: []string{"http"},
@@ -35,8 +56,16 @@ Generate and run an HTTP server based on the declared model inputs and outputs.`
 	addGpusFlag(cmd)
 	addFastFlag(cmd)
 	addConfigFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+	addEnvFileFlags(cmd)
 
 	cmd.Flags().IntVarP(&port, "port", "p", port, "Port on which to listen")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().BoolVar(&serveWatch, "watch", false, "Restart the server when files in the project change")
+	cmd.Flags().IntVar(&serveReplicaCount, "replicas", 1, "Number of containers to run behind a load balancer")
+	cmd.Flags().IntVar(&serveGPUsPerReplica, "gpus-per-replica", 0, "Number of GPUs to give each replica to itself. Defaults to 1 if the model uses a GPU and --gpus isn't passed")
+	cmd.Flags().BoolVarP(&serveDetach, "detach", "d", false, "Run the server in the background and print its container ID")
+	cmd.Flags().StringVar(&serveRouting, "routing", string(serve.LeastBusy), "How the load balancer picks a replica: 'least-busy' or 'round-robin'")
 
 	return cmd
 }
@@ -49,19 +78,66 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 		return err
 	}
 
-	cfg, projectDir, err := config.GetConfig(configFilename)
+	if buildFast {
+		console.Info("Fast serve enabled.")
+	}
+
+	if serveReplicaCount < 1 {
+		return fmt.Errorf("--replicas must be at least 1")
+	}
+	if serveDetach {
+		if serveWatch || serveReplicaCount > 1 {
+			return fmt.Errorf("--detach cannot be used with --watch or --replicas")
+		}
+		return serveDetached(ctx, cmd, dockerClient)
+	}
+	if serveReplicaCount > 1 {
+		if serveWatch {
+			return fmt.Errorf("--watch cannot be used with --replicas")
+		}
+		return serveReplicas(ctx, cmd, dockerClient)
+	}
+	if serveWatch {
+		return serveAndWatch(ctx, cmd, dockerClient)
+	}
+
+	runOptions, _, err := serveRunOptions(ctx, cmd, dockerClient)
 	if err != nil {
 		return err
 	}
 
-	client := registry.NewRegistryClient()
-	imageName, err := image.BuildBase(ctx, dockerClient, cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput, client, true)
+	console.Info("")
+	console.Infof("Running '%[1]s' in Docker with the current directory mounted as a volume...", strings.Join(runOptions.Args, " "))
+	console.Info("")
+	console.Infof("Serving at http://127.0.0.1:%[1]v", port)
+	console.Info("")
+
+	err = docker.Run(ctx, dockerClient, runOptions)
+	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
+	// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
+	if runOptions.GPUs == "all" && err == docker.ErrMissingDeviceDriver {
+		console.Info("Missing device driver, re-trying without GPU")
+
+		runOptions.GPUs = ""
+		err = docker.Run(ctx, dockerClient, runOptions)
+	}
+
+	return err
+}
+
+// serveRunOptions builds the base image of the project and returns the
+// options to run the server on it, with the project mounted at /src, and the
+// directory of the project.
+func serveRunOptions(ctx context.Context, cmd *cobra.Command, dockerClient command.Command) (command.RunOptions, string, error) {
+	cfg, projectDir, err := config.GetConfig(configFilename)
 	if err != nil {
-		return err
+		return command.RunOptions{}, "", err
 	}
 
-	if buildFast {
-		console.Info("Fast serve enabled.")
+	client := registry.NewRegistryClient()
+	imageName, err := image.BuildBase(ctx, dockerClient, cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput, client, true)
+	if err != nil {
+		return command.RunOptions{}, "", err
 	}
 
 	gpus := ""
@@ -71,6 +147,11 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 		gpus = "all"
 	}
 
+	env, err := runtimeEnv(envFlags)
+	if err != nil {
+		return command.RunOptions{}, "", err
+	}
+
 	args := []string{
 		"python",
 		"--check-hash-based-pycs", "never",
@@ -80,7 +161,7 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 
 	runOptions := command.RunOptions{
 		Args:    args,
-		Env:     envFlags,
+		Env:     env,
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: []command.Volume{{Source: projectDir, Destination: "/src"}},
@@ -88,26 +169,58 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 	}
 	runOptions, err = docker.FillInWeightsManifestVolumes(ctx, dockerClient, runOptions)
 	if err != nil {
-		return err
+		return command.RunOptions{}, "", err
 	}
 
 	runOptions.Ports = append(runOptions.Ports, command.Port{HostPort: port, ContainerPort: 5000})
+	return runOptions, projectDir, nil
+}
 
-	console.Info("")
-	console.Infof("Running '%[1]s' in Docker with the current directory mounted as a volume...", strings.Join(args, " "))
-	console.Info("")
-	console.Infof("Serving at http://127.0.0.1:%[1]v", port)
-	console.Info("")
+// serveDetached starts the server in the background, labelled so cog ps,
+// cog logs and cog stop can find it.
+func serveDetached(ctx context.Context, cmd *cobra.Command, dockerClient command.Command) error {
+	runOptions, projectDir, err := serveRunOptions(ctx, cmd, dockerClient)
+	if err != nil {
+		return err
+	}
 
-	err = docker.Run(ctx, dockerClient, runOptions)
+	running, err := dockerClient.ContainerList(ctx, map[string]string{
+		command.CogProjectDirLabelKey: projectDir,
+		command.CogPortLabelKey:       strconv.Itoa(port),
+	})
+	if err != nil {
+		return err
+	}
+	if len(running) > 0 {
+		return fmt.Errorf("The model is already being served on port %d by container %s, stop it with cog stop", port, shortContainerID(running[0]))
+	}
+
+	hash, err := configHash(projectDir)
+	if err != nil {
+		return err
+	}
+	runOptions.Labels = map[string]string{
+		command.CogProjectDirLabelKey: projectDir,
+		command.CogConfigHashLabelKey: hash,
+		command.CogPortLabelKey:       strconv.Itoa(port),
+	}
+
+	containerID, err := docker.RunDaemon(ctx, dockerClient, runOptions, os.Stderr)
 	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
 	// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
-	if runOptions.GPUs == "all" && err == docker.ErrMissingDeviceDriver {
+	if runOptions.GPUs == "all" && errors.Is(err, docker.ErrMissingDeviceDriver) {
 		console.Info("Missing device driver, re-trying without GPU")
 
 		runOptions.GPUs = ""
-		err = docker.Run(ctx, dockerClient, runOptions)
+		containerID, err = docker.RunDaemon(ctx, dockerClient, runOptions, os.Stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to start container: %w", err)
 	}
 
-	return err
+	console.Info("")
+	console.Infof("Serving at http://127.0.0.1:%v in the background", port)
+	console.Info("Run 'cog logs -f' to follow its logs, 'cog ps' to check its status and 'cog stop' to stop it")
+	console.Output(containerID)
+	return nil
 }
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/serve"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// replicaHealthInterval is how often the load balancer checks the health of
+// replicas.
+const replicaHealthInterval = time.Second
+
+// serveReplicas runs a container for each replica of the server, and a load
+// balancer in front of them on --port, until it is interrupted.
+func serveReplicas(ctx context.Context, cmd *cobra.Command, dockerClient command.Command) error {
+	strategy, err := serve.ParseStrategy(serveRouting)
+	if err != nil {
+		return err
+	}
+
+	runOptions, _, err := serveRunOptions(ctx, cmd, dockerClient)
+	if err != nil {
+		return err
+	}
+	// Replicas get the GPUs they need to themselves, unless --gpus picks them
+	gpusPerReplica := serveGPUsPerReplica
+	if gpusPerReplica == 0 && gpusFlag == "" && runOptions.GPUs == "all" {
+		gpusPerReplica = 1
+	}
+	if gpusPerReplica > 0 {
+		available, err := availableGPUs(ctx, dockerClient, runOptions.Image)
+		if err != nil {
+			return err
+		}
+		if needed := gpusPerReplica * serveReplicaCount; needed > available {
+			return fmt.Errorf("%d replicas with %d GPUs each need %d GPUs, but only %d are available", serveReplicaCount, gpusPerReplica, needed, available)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	containerIDs := []string{}
+	defer func() {
+		console.Info("Stopping containers...")
+		var wg sync.WaitGroup
+		for _, containerID := range containerIDs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// use background context to ensure stop signal is still sent after root context is canceled
+				if err := dockerClient.ContainerStop(context.Background(), containerID); err != nil {
+					console.Warnf("Failed to stop container: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+
+	console.Info("")
+	console.Infof("Running '%s' in %d Docker containers with the current directory mounted as a volume...", strings.Join(runOptions.Args, " "), serveReplicaCount)
+
+	replicaURLs := []string{}
+	for i := range serveReplicaCount {
+		options := runOptions
+		options.Ports = []command.Port{{HostPort: 0, ContainerPort: 5000}}
+		if gpusPerReplica > 0 {
+			options.GPUs = replicaGPUs(i, gpusPerReplica)
+		}
+		logsWriter := &prefixWriter{w: os.Stderr, prefix: fmt.Sprintf("[replica %d] ", i+1)}
+
+		containerID, err := docker.RunDaemon(ctx, dockerClient, options, logsWriter)
+		if err != nil {
+			return fmt.Errorf("Failed to start replica %d: %w", i+1, err)
+		}
+		containerIDs = append(containerIDs, containerID)
+
+		hostPort, err := docker.GetHostPortForContainer(ctx, dockerClient, containerID, 5000)
+		if err != nil {
+			return fmt.Errorf("Failed to determine port of replica %d: %w", i+1, err)
+		}
+		replicaURLs = append(replicaURLs, fmt.Sprintf("http://127.0.0.1:%d", hostPort))
+
+		go func() {
+			if err := dockerClient.ContainerLogs(ctx, containerID, logsWriter, true); err != nil && ctx.Err() == nil {
+				console.Warnf("Error getting logs of replica %d: %s", i+1, err)
+			}
+		}()
+	}
+
+	balancer, err := serve.NewBalancer(replicaURLs, strategy)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	// The health of replicas is checked concurrently
+	var readyMu sync.Mutex
+	ready := make([]bool, serveReplicaCount)
+	balancer.OnStatusChange = func(i int, status string) {
+		readyMu.Lock()
+		defer readyMu.Unlock()
+		if status == serve.StatusReady && !ready[i] {
+			ready[i] = true
+			console.Infof("Replica %d is ready, setup() took %.2fs", i+1, time.Since(start).Seconds())
+			return
+		}
+		console.Infof("Replica %d is %s", i+1, status)
+	}
+	go balancer.CheckHealth(ctx, replicaHealthInterval)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           balancer,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	console.Info("")
+	console.Infof("Serving at http://127.0.0.1:%v, with %s routing across %d replicas", port, strategy, serveReplicaCount)
+	console.Info("")
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("Failed to run load balancer: %w", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// availableGPUs returns the number of GPUs containers can use, by listing
+// them with nvidia-smi in a container of image that is given all GPUs.
+func availableGPUs(ctx context.Context, dockerClient command.Command, image string) (int, error) {
+	var stdout, stderr bytes.Buffer
+	err := docker.RunWithIO(ctx, dockerClient, command.RunOptions{
+		Image: image,
+		Args:  []string{"nvidia-smi", "--query-gpu=index", "--format=csv,noheader"},
+		GPUs:  "all",
+	}, nil, &stdout, &stderr)
+	if errors.Is(err, docker.ErrMissingDeviceDriver) {
+		return 0, nil
+	}
+	if err != nil {
+		console.Info(stderr.String())
+		return 0, fmt.Errorf("Failed to count GPUs: %w", err)
+	}
+	return countGPUs(stdout.String()), nil
+}
+
+// countGPUs counts the GPUs listed by nvidia-smi --query-gpu, one per line.
+func countGPUs(output string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// replicaGPUs returns the --gpus value that gives replica i the next n GPUs
+// to itself.
+func replicaGPUs(i int, n int) string {
+	devices := make([]string, n)
+	for j := range n {
+		devices[j] = strconv.Itoa(i*n + j)
+	}
+	return "device=" + strings.Join(devices, ",")
+}
+
+// prefixWriter writes each line written to it to w, after prefix, so the
+// logs of several containers can be told apart.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
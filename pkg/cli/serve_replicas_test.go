@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaGPUs(t *testing.T) {
+	require.Equal(t, "device=0", replicaGPUs(0, 1))
+	require.Equal(t, "device=2", replicaGPUs(2, 1))
+	require.Equal(t, "device=2,3", replicaGPUs(1, 2))
+}
+
+func TestCountGPUs(t *testing.T) {
+	require.Equal(t, 0, countGPUs(""))
+	require.Equal(t, 1, countGPUs("0\n"))
+	require.Equal(t, 4, countGPUs("0\n1\n2\n3\n"))
+}
+
+func TestPrefixWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := &prefixWriter{w: out, prefix: "[replica 1] "}
+	_, err := w.Write([]byte("setting up\nloading wei"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("ghts\n"))
+	require.NoError(t, err)
+	require.Equal(t, "[replica 1] setting up\n[replica 1] loading weights\n", out.String())
+}
@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/dockerignore"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// watchInterval is how often the project is checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watchServerScript runs the command passed to it in a loop, so the server
+// starts again with the latest code after a request to /shutdown. Stopping
+// the container interrupts the server and ends the loop.
+const watchServerScript = `trap 'kill -INT $pid 2>/dev/null; wait $pid; exit 0' TERM INT
+while true; do
+  "$@" &
+  pid=$!
+  wait $pid
+done`
+
+// fileState is what a change to a watched file is detected by.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// serveAndWatch runs the server and restarts it when files in the project
+// change, until it is interrupted. The image is rebuilt and the container
+// replaced when cog.yaml or the Python requirements change.
+func serveAndWatch(ctx context.Context, cmd *cobra.Command, dockerClient command.Command) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	projectDir := ""
+	for {
+		runOptions, dir, err := serveRunOptions(ctx, cmd, dockerClient)
+		if err != nil {
+			if projectDir == "" || ctx.Err() != nil {
+				return err
+			}
+			// Keep watching, so the next change can fix the build
+			console.Warnf("%s", err)
+			console.Info("Waiting for changes...")
+			if err := waitForChanges(ctx, projectDir); err != nil {
+				if ctx.Err() != nil {
+					// Interrupted while waiting
+					return nil
+				}
+				return err
+			}
+			continue
+		}
+		projectDir = dir
+
+		rebuild, err := serveWatched(ctx, dockerClient, runOptions, projectDir)
+		if err != nil || !rebuild {
+			return err
+		}
+	}
+}
+
+// serveWatched starts a container running the server and restarts the server
+// in it when the project changes. It returns true if the image has to be
+// rebuilt, or false when it is interrupted.
+func serveWatched(ctx context.Context, dockerClient command.Command, runOptions command.RunOptions, projectDir string) (bool, error) {
+	snapshot, err := snapshotProject(projectDir)
+	if err != nil {
+		return false, err
+	}
+
+	serverArgs := runOptions.Args
+	runOptions.Args = append([]string{"sh", "-c", watchServerScript, "cog"}, serverArgs...)
+
+	console.Info("")
+	console.Infof("Running '%s' in Docker with the current directory mounted as a volume, and restarting it when files change...", strings.Join(serverArgs, " "))
+
+	start := time.Now()
+	containerID, err := docker.RunDaemon(ctx, dockerClient, runOptions, os.Stderr)
+	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
+	// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
+	if runOptions.GPUs == "all" && errors.Is(err, docker.ErrMissingDeviceDriver) {
+		console.Info("Missing device driver, re-trying without GPU")
+
+		runOptions.GPUs = ""
+		containerID, err = docker.RunDaemon(ctx, dockerClient, runOptions, os.Stderr)
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to start container: %w", err)
+	}
+	defer func() {
+		console.Debugf("Stopping container...")
+		// use background context to ensure stop signal is still sent after root context is canceled
+		if err := dockerClient.ContainerStop(context.Background(), containerID); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	go func() {
+		if err := dockerClient.ContainerLogs(ctx, containerID, os.Stderr, true); err != nil && ctx.Err() == nil {
+			console.Warnf("Error getting container logs: %s", err)
+		}
+	}()
+
+	serverURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	console.Info("")
+	console.Infof("Serving at %s", serverURL)
+	console.Info("")
+	waitForServerSetup(ctx, serverURL, start)
+
+	rebuildFiles, err := serveRebuildFiles(projectDir)
+	if err != nil {
+		return false, err
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+		}
+
+		current, err := snapshotProject(projectDir)
+		if err != nil {
+			// Files can disappear while the project is walked, e.g. when an
+			// editor saves them, so try again on the next tick
+			console.Debugf("Failed to check project for changes: %s", err)
+			continue
+		}
+		changed := changedFiles(snapshot, current)
+		if len(changed) == 0 {
+			continue
+		}
+		snapshot = current
+
+		for _, path := range changed {
+			if containsString(rebuildFiles, path) {
+				console.Infof("%s changed, rebuilding image...", path)
+				return true, nil
+			}
+		}
+
+		console.Infof("%s changed, restarting server...", strings.Join(changed, ", "))
+		start := time.Now()
+		if err := restartServer(ctx, serverURL); err != nil {
+			console.Warnf("Failed to restart server: %s", err)
+			continue
+		}
+		waitForServerSetup(ctx, serverURL, start)
+	}
+}
+
+// serveRebuildFiles returns the files in the project, relative to it, that
+// the image is built from.
+func serveRebuildFiles(projectDir string) ([]string, error) {
+	cfg, _, err := config.GetConfig(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{filepath.Base(configFilename)}
+	if cfg.Build != nil && cfg.Build.PythonRequirements != "" {
+		files = append(files, filepath.Clean(cfg.Build.PythonRequirements))
+	}
+	return files, nil
+}
+
+// waitForServerSetup waits for setup() to finish and prints how long it took
+// since start. Setup failures are only printed, so they can be fixed while
+// the project is watched.
+func waitForServerSetup(ctx context.Context, serverURL string, start time.Time) {
+	predictor, err := predict.NewRemotePredictor(serverURL, false)
+	if err != nil {
+		console.Warnf("%s", err)
+		return
+	}
+	if err := predictor.Start(ctx, nil, time.Duration(setupTimeout)*time.Second); err != nil {
+		if ctx.Err() == nil {
+			console.Warnf("Server is not ready: %s", err)
+		}
+		return
+	}
+	console.Infof("setup() finished in %.2fs", time.Since(start).Seconds())
+}
+
+// restartServer asks the server to shut down, which the loop in the container
+// starts it again after, and waits for it to stop.
+func restartServer(ctx context.Context, serverURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL+"/shutdown", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// Until it stops, the old server would pass the health check of the new one
+	deadline := time.Now().Add(time.Duration(setupTimeout) * time.Second)
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/health-check", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil
+		}
+		resp.Body.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("Timed out waiting for the server to shut down")
+}
+
+// waitForChanges returns when a file in the project changes, or an error when
+// it is interrupted.
+func waitForChanges(ctx context.Context, projectDir string) error {
+	snapshot, err := snapshotProject(projectDir)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := snapshotProject(projectDir)
+		if err == nil && len(changedFiles(snapshot, current)) > 0 {
+			return nil
+		}
+	}
+}
+
+// snapshotProject returns the state of the files in the project that aren't
+// ignored by .dockerignore, by their path relative to it. Bytecode that
+// Python writes when the server imports the model isn't included.
+func snapshotProject(dir string) (map[string]fileState, error) {
+	matcher, err := dockerignore.CreateMatcher(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := map[string]fileState{}
+	err = dockerignore.Walk(dir, matcher, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() {
+			if info.Name() == ".git" || info.Name() == "__pycache__" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".pyc") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		snapshot[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// changedFiles returns the files that were added, removed or modified between
+// two snapshots, sorted.
+func changedFiles(before map[string]fileState, after map[string]fileState) []string {
+	changed := []string{}
+	for path, state := range after {
+		if previous, ok := before[path]; !ok || !previous.modTime.Equal(state.modTime) || previous.size != state.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotProject(t *testing.T) {
+	dir := t.TempDir()
+	for path, contents := range map[string]string{
+		".dockerignore":                     "data\n*.log\n",
+		"predict.py":                        "print('hello')",
+		"lib/utils.py":                      "",
+		"lib/__pycache__/utils.cpython.pyc": "",
+		"data/weights.bin":                  "",
+		"train.log":                         "",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(contents), 0o644))
+	}
+
+	before, err := snapshotProject(dir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"predict.py", filepath.Join("lib", "utils.py")}, slices.Collect(maps.Keys(before)))
+
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "predict.py"), later, later))
+	require.NoError(t, os.Remove(filepath.Join(dir, "lib", "utils.py")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build: {}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "more.bin"), []byte{}, 0o644))
+
+	after, err := snapshotProject(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cog.yaml", filepath.Join("lib", "utils.py"), "predict.py"}, changedFiles(before, after))
+	require.Empty(t, changedFiles(after, after))
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var stopAll bool
+
+func newStopCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop [container...]",
+		Short: "Stop model containers",
+		Long: `Stop model containers.
+
+Without container IDs, it stops the containers running the model in the
+current directory, started by cog serve -d or cog predict --keep-warm.`,
+		RunE: cmdStop,
+	}
+	addConfigFlag(cmd)
+	cmd.Flags().BoolVar(&stopAll, "all", false, "Stop the containers of every model")
+	return cmd
+}
+
+func cmdStop(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if stopAll && len(args) > 0 {
+		return fmt.Errorf("--all cannot be used with container IDs")
+	}
+
+	containerIDs := args
+	if len(args) == 0 {
+		var containers []*cogContainer
+		if stopAll {
+			containers, err = listCogContainers(ctx, dockerClient)
+		} else {
+			projectDir, dirErr := currentProjectDir()
+			if dirErr != nil {
+				return dirErr
+			}
+			containers, err = projectContainers(ctx, dockerClient, projectDir)
+		}
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			containerIDs = append(containerIDs, c.ID)
+		}
+	}
+	if len(containerIDs) == 0 {
+		console.Info("No model containers are running")
+		return nil
+	}
+
+	for _, containerID := range containerIDs {
+		if err := dockerClient.ContainerStop(ctx, containerID); err != nil {
+			return err
+		}
+		console.Infof("Stopped %s", shortContainerID(containerID))
+	}
+	return nil
+}
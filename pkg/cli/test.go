@@ -0,0 +1,319 @@
+package cli
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	testJUnitPath  string
+	testExampleDir string
+)
+
+func newTestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [image]",
+		Short: "Run the examples in cog.yaml and check their outputs",
+		Long: `Run the examples in cog.yaml and check their outputs.
+
+Each example in the 'examples' section of cog.yaml is run as a prediction, and
+its output is compared with the expected output. The command fails if any
+example fails, so it can be used in CI to catch regressions in a model.
+
+If 'image' is passed, it will run the examples on that Docker image.
+Otherwise, it will build the model in the current directory.`,
+		RunE: cmdTest,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+	addConfigFlag(cmd)
+
+	addEnvFileFlags(cmd)
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().StringVar(&testJUnitPath, "junit", "", "Write the results as a JUnit XML report to this path")
+	cmd.Flags().StringVar(&testExampleDir, "examples-dir", "", "Directory that files in examples are relative to, when running them on an image (default: the current directory)")
+
+	return cmd
+}
+
+// exampleResult is the result of running an example.
+type exampleResult struct {
+	Name     string
+	Duration time.Duration
+	// Failure is set if the output didn't match the expected output
+	Failure string
+	// Error is set if the prediction couldn't be run
+	Error string
+}
+
+func cmdTest(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	imageName := ""
+	gpus := gpusFlag
+	var examples []config.Example
+	baseDir := testExampleDir
+
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(configFilename)
+		if err != nil {
+			return err
+		}
+		examples = cfg.Examples
+		if baseDir == "" {
+			baseDir = projectDir
+		}
+		if len(examples) == 0 {
+			return fmt.Errorf("No examples to test, add them to the 'examples' section of cog.yaml")
+		}
+
+		// The examples are run on the image that would be pushed, rather than
+		// on the source mounted into a base image, so they test what ships
+		imageName = config.DockerImageName(projectDir)
+		if err := image.Build(
+			ctx,
+			cfg,
+			projectDir,
+			imageName,
+			buildSecrets,
+			buildNoCache,
+			buildSeparateWeights,
+			buildUseCudaBaseImage,
+			buildProgressOutput,
+			buildSchemaFile,
+			buildDockerfileFile,
+			DetermineUseCogBaseImage(cmd),
+			buildStrip,
+			buildPrecompile,
+			false,
+			nil,
+			buildLocalImage,
+			dockerClient,
+			registry.NewRegistryClient(),
+			false,
+			registry.DefaultPlatform,
+			nil,
+			nil); err != nil {
+			return err
+		}
+
+		if gpus == "" && cfg.Build.GPU {
+			gpus = "all"
+		}
+	} else {
+		imageName = args[0]
+
+		inspectResp, err := dockerClient.Pull(ctx, imageName, false)
+		if err != nil {
+			return fmt.Errorf("Failed to pull image %q: %w", imageName, err)
+		}
+
+		conf, err := image.CogConfigFromManifest(ctx, inspectResp)
+		if err != nil {
+			return err
+		}
+		examples = conf.Examples
+		if baseDir == "" {
+			baseDir = "."
+		}
+		if len(examples) == 0 {
+			return fmt.Errorf("Image %s has no examples to test", imageName)
+		}
+		if gpus == "" && conf.Build.GPU {
+			gpus = "all"
+		}
+	}
+
+	env, err := runtimeEnv(envFlags)
+	if err != nil {
+		return err
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	predictor, err := predict.NewPredictor(ctx, command.RunOptions{
+		GPUs:  gpus,
+		Image: imageName,
+		Env:   env,
+	}, false, false, dockerClient)
+	if err != nil {
+		return err
+	}
+
+	handleInterrupts(ctx, func() *predict.Predictor { return predictor })
+
+	if err := predictor.Start(ctx, os.Stderr, time.Duration(setupTimeout)*time.Second); err != nil {
+		return err
+	}
+
+	defer func() {
+		console.Debugf("Stopping container...")
+		// use background context to ensure stop signal is still sent after root context is canceled
+		if err := predictor.Stop(context.Background()); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+
+	console.Info("")
+	results := make([]exampleResult, len(examples))
+	failed := 0
+	for i, example := range examples {
+		name := example.Name
+		if name == "" {
+			name = "example-" + strconv.Itoa(i+1)
+		}
+		results[i] = runExample(predictor, schema, example, name, baseDir)
+
+		switch {
+		case results[i].Error != "":
+			failed++
+			console.Infof("ERROR %s: %s", name, results[i].Error)
+		case results[i].Failure != "":
+			failed++
+			console.Infof("FAIL  %s: %s", name, results[i].Failure)
+		default:
+			console.Infof("PASS  %s (%.2fs)", name, results[i].Duration.Seconds())
+		}
+	}
+
+	if testJUnitPath != "" {
+		if err := writeJUnitReport(testJUnitPath, imageName, results); err != nil {
+			return err
+		}
+		console.Infof("Written JUnit report to: %s", testJUnitPath)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, len(examples))
+	}
+	console.Infof("All %d examples passed", len(examples))
+	return nil
+}
+
+func runExample(predictor *predict.Predictor, schema *openapi3.T, example config.Example, name string, baseDir string) exampleResult {
+	result := exampleResult{Name: name}
+	start := time.Now()
+
+	inputs := predict.NewInputsWithBaseDir(example.Input, baseDir)
+	if err := predictor.ValidateInputs(inputs, schema); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	prediction, err := predictor.Predict(inputs, predict.RequestContext{})
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if prediction.Status != "succeeded" {
+		result.Error = fmt.Sprintf("Prediction failed with status %q: %s", prediction.Status, prediction.Error)
+		return result
+	}
+
+	var output any
+	if prediction.Output != nil {
+		output = *prediction.Output
+	}
+	if err := compareOutput(predictor, example, output, baseDir); err != nil {
+		result.Failure = err.Error()
+	}
+	return result
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes results as a JUnit XML report, with a test suite
+// named after the image.
+func writeJUnitReport(path string, suiteName string, results []exampleResult) error {
+	suite := junitTestSuite{Name: suiteName, Tests: len(results)}
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: suiteName,
+			Time:      formatSeconds(result.Duration),
+		}
+		if result.Failure != "" {
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: "Output did not match", Text: result.Failure}
+		}
+		if result.Error != "" {
+			suite.Errors++
+			testCase.Error = &junitMessage{Message: "Prediction failed", Text: result.Error}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = formatSeconds(total)
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode JUnit report: %w", err)
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
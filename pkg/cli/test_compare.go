@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// compareOutput checks the output of a prediction made by predictor against the
+// expected output of example. Files the example refers to are relative to baseDir.
+func compareOutput(predictor *predict.Predictor, example config.Example, output any, baseDir string) error {
+	if example.Output == "" && example.Match == "" {
+		// The prediction only has to succeed
+		return nil
+	}
+
+	switch example.MatchMode() {
+	case config.ExampleMatchJSON:
+		var expected any
+		if err := json.Unmarshal([]byte(example.Output), &expected); err != nil {
+			return fmt.Errorf("Failed to parse expected output as JSON: %w", err)
+		}
+		if !reflect.DeepEqual(expected, output) {
+			return fmt.Errorf("expected %s, got %s", compactJSON(expected), compactJSON(output))
+		}
+		return nil
+	case config.ExampleMatchFile:
+		fileURL, ok := output.(string)
+		if !ok {
+			return fmt.Errorf("expected a file, got %s", compactJSON(output))
+		}
+		return compareFile(predictor, fileURL, filepath.Join(baseDir, strings.TrimPrefix(example.Output, "@")), example.Tolerance)
+	default:
+		actual, ok := output.(string)
+		if !ok {
+			actual = compactJSON(output)
+		}
+		if actual != example.Output {
+			return fmt.Errorf("expected %q, got %q", example.Output, actual)
+		}
+		return nil
+	}
+}
+
+// compareFile compares the file at fileURL with the file at expectedPath. With
+// no tolerance the files must be identical. Otherwise, the average difference
+// between the pixels of images, or the bytes of other files, must be at most
+// tolerance, from 0 to 1.
+func compareFile(predictor *predict.Predictor, fileURL string, expectedPath string, tolerance float64) error {
+	expected, err := os.ReadFile(expectedPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read expected output: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "cog-test-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path, err := predictor.WriteOutputFile(fileURL, filepath.Join(dir, "output"))
+	if err != nil {
+		return fmt.Errorf("Failed to read output: %w", err)
+	}
+	actual, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read output: %w", err)
+	}
+
+	if tolerance == 0 {
+		expectedHash, actualHash := sha256.Sum256(expected), sha256.Sum256(actual)
+		if expectedHash != actualHash {
+			return fmt.Errorf("expected a file with sha256 %s, got %s", hex.EncodeToString(expectedHash[:]), hex.EncodeToString(actualHash[:]))
+		}
+		return nil
+	}
+
+	difference, err := fileDifference(expected, actual)
+	if err != nil {
+		return err
+	}
+	if difference > tolerance {
+		return fmt.Errorf("output differs from the expected file by %.4f, more than the tolerance of %.4f", difference, tolerance)
+	}
+	return nil
+}
+
+// fileDifference returns the average difference between two images, or two
+// files of the same size, from 0 to 1.
+func fileDifference(expected []byte, actual []byte) (float64, error) {
+	expectedImage, _, expectedErr := image.Decode(bytes.NewReader(expected))
+	actualImage, _, actualErr := image.Decode(bytes.NewReader(actual))
+	if expectedErr == nil && actualErr == nil {
+		return imageDifference(expectedImage, actualImage)
+	}
+
+	if len(expected) != len(actual) {
+		return 0, fmt.Errorf("expected a file of %d bytes, got %d bytes", len(expected), len(actual))
+	}
+	if len(expected) == 0 {
+		return 0, nil
+	}
+	total := 0.0
+	for i := range expected {
+		total += absDiff(float64(expected[i]), float64(actual[i])) / 0xff
+	}
+	return total / float64(len(expected)), nil
+}
+
+func imageDifference(expected image.Image, actual image.Image) (float64, error) {
+	bounds := expected.Bounds()
+	if bounds.Size() != actual.Bounds().Size() {
+		return 0, fmt.Errorf("expected an image of %v, got %v", bounds.Size(), actual.Bounds().Size())
+	}
+	if bounds.Empty() {
+		return 0, nil
+	}
+
+	offset := actual.Bounds().Min.Sub(bounds.Min)
+	total := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := expected.At(x, y).RGBA()
+			r2, g2, b2, a2 := actual.At(x+offset.X, y+offset.Y).RGBA()
+			total += (absDiff(float64(r1), float64(r2)) +
+				absDiff(float64(g1), float64(g2)) +
+				absDiff(float64(b1), float64(b2)) +
+				absDiff(float64(a1), float64(a2))) / (4 * 0xffff)
+		}
+	}
+	return total / float64(bounds.Dx()*bounds.Dy()), nil
+}
+
+func absDiff(a float64, b float64) float64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
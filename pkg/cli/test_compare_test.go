@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func TestCompareOutput(t *testing.T) {
+	require.NoError(t, compareOutput(&predict.Predictor{}, config.Example{Output: "hello"}, "hello", ""))
+	require.ErrorContains(t, compareOutput(&predict.Predictor{}, config.Example{Output: "hello"}, "bye", ""), `expected "hello", got "bye"`)
+	require.NoError(t, compareOutput(&predict.Predictor{}, config.Example{Output: "42"}, float64(42), ""))
+
+	jsonExample := config.Example{Output: `{"labels": ["cat", "dog"], "score": 0.5}`, Match: config.ExampleMatchJSON}
+	require.NoError(t, compareOutput(&predict.Predictor{}, jsonExample, map[string]any{"score": 0.5, "labels": []any{"cat", "dog"}}, ""))
+	require.Error(t, compareOutput(&predict.Predictor{}, jsonExample, map[string]any{"score": 0.5, "labels": []any{"dog", "cat"}}, ""))
+
+	// Examples without an output only have to succeed
+	require.NoError(t, compareOutput(&predict.Predictor{}, config.Example{}, "anything", ""))
+}
+
+func TestCompareOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "expected.txt"), []byte("hello"), 0o644))
+
+	example := config.Example{Output: "@expected.txt"}
+	require.NoError(t, compareOutput(&predict.Predictor{}, example, "data:text/plain;base64,aGVsbG8=", dir))
+	require.ErrorContains(t, compareOutput(&predict.Predictor{}, example, "data:text/plain;base64,aGVsbE8=", dir), "expected a file with sha256")
+
+	example.Tolerance = 0.1
+	require.NoError(t, compareOutput(&predict.Predictor{}, example, "data:text/plain;base64,aGVsbE8=", dir))
+}
+
+func TestFileDifferenceImages(t *testing.T) {
+	encode := func(gray uint8) []byte {
+		img := image.NewGray(image.Rect(0, 0, 2, 2))
+		for i := range img.Pix {
+			img.Pix[i] = gray
+		}
+		img.Set(0, 0, color.Gray{Y: 0})
+		buf := &bytes.Buffer{}
+		require.NoError(t, png.Encode(buf, img))
+		return buf.Bytes()
+	}
+
+	difference, err := fileDifference(encode(100), encode(100))
+	require.NoError(t, err)
+	require.Zero(t, difference)
+
+	// The images differ on 3 of 4 pixels, by 51 of 255 in the color channels
+	difference, err = fileDifference(encode(100), encode(151))
+	require.NoError(t, err)
+	require.InDelta(t, 0.75*0.2*0.75, difference, 0.0001)
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	require.NoError(t, writeJUnitReport(path, "my-model", []exampleResult{
+		{Name: "greeting"},
+		{Name: "upscale", Failure: `expected "a", got "b"`},
+		{Name: "broken", Error: "Prediction failed"},
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	report := string(data)
+	require.Contains(t, report, `<testsuite name="my-model" tests="3" failures="1" errors="1" time="0.000">`)
+	require.Contains(t, report, `<testcase name="greeting" classname="my-model" time="0.000"></testcase>`)
+	require.Contains(t, report, `<failure message="Output did not match">expected &#34;a&#34;, got &#34;b&#34;</failure>`)
+}
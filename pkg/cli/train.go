@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -47,6 +45,9 @@ Otherwise, it will build the model in the current directory and train it.`,
 	addUseCogBaseImageFlag(cmd)
 	addFastFlag(cmd)
 	addConfigFlag(cmd)
+	addServerURLFlag(cmd)
+	addFileTransferFlag(cmd)
+	addEnvFileFlags(cmd)
 
 	cmd.Flags().StringArrayVarP(&trainInputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
 	cmd.Flags().StringArrayVarP(&trainEnvFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
@@ -58,6 +59,17 @@ Otherwise, it will build the model in the current directory and train it.`,
 func cmdTrain(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
+	historyDir = predictionHistoryDir(".")
+
+	if serverURLFlag != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("--url cannot be used with an image")
+		}
+		return predictOnServer(ctx, serverURLFlag, true, func(predictor *predict.Predictor) error {
+			return predictIndividualInputs(ctx, predictor, trainInputFlags, trainOutPath, true)
+		})
+	}
+
 	dockerClient, err := docker.NewClient(ctx)
 	if err != nil {
 		return err
@@ -71,6 +83,7 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	historyDir = predictionHistoryDir(projectDir)
 
 	if len(args) == 0 {
 		// Build image
@@ -117,34 +130,37 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 	console.Info("")
 	console.Infof("Starting Docker image %s...", imageName)
 
+	predictorOpts, err := fileTransferOptions()
+	if err != nil {
+		return err
+	}
+
+	env, err := runtimeEnv(trainEnvFlags)
+	if err != nil {
+		return err
+	}
+	historyEnv, err = recordedEnv(trainEnvFlags)
+	if err != nil {
+		return err
+	}
+
 	predictor, err := predict.NewPredictor(ctx, command.RunOptions{
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: volumes,
-		Env:     trainEnvFlags,
+		Env:     env,
 		Args:    []string{"python", "-m", "cog.server.http", "--x-mode", "train"},
-	}, true, buildFast, dockerClient)
+	}, true, buildFast, dockerClient, predictorOpts...)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
-
-		<-captureSignal
-
-		console.Info("Stopping container...")
-		if err := predictor.Stop(ctx); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
+	handleInterrupts(ctx, func() *predict.Predictor { return predictor })
 
 	if err := predictor.Start(ctx, os.Stderr, time.Duration(setupTimeout)*time.Second); err != nil {
 		return err
 	}
 
-	// FIXME: will not run on signal
 	defer func() {
 		console.Debugf("Stopping container...")
 		// use background context to ensure stop signal is still sent after root context is canceled
@@ -153,5 +169,5 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
-	return predictIndividualInputs(*predictor, trainInputFlags, trainOutPath, true)
+	return predictIndividualInputs(ctx, predictor, trainInputFlags, trainOutPath, true)
 }
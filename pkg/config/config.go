@@ -21,7 +21,12 @@ import (
 var (
 	BuildSourceEpochTimestamp int64 = -1
 	BuildXCachePath           string
-	PipPackageNameRegex       = regexp.MustCompile(`^([^>=<~ \n[#]+)`)
+	// BuildCacheFrom and BuildCacheTo are the caches the model image is
+	// built from and exported to, in the form of docker buildx build
+	// --cache-from and --cache-to
+	BuildCacheFrom      []string
+	BuildCacheTo        []string
+	PipPackageNameRegex = regexp.MustCompile(`^([^>=<~ \n[#]+)`)
 )
 
 // TODO(andreas): support conda packages
@@ -66,9 +71,32 @@ type Concurrency struct {
 	Max int `json:"max,omitempty" yaml:"max"`
 }
 
+// Ways of comparing the output of an example with the expected output.
+const (
+	ExampleMatchExact = "exact"
+	ExampleMatchJSON  = "json"
+	ExampleMatchFile  = "file"
+)
+
 type Example struct {
-	Input  map[string]string `json:"input" yaml:"input"`
-	Output string            `json:"output" yaml:"output"`
+	Name      string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Input     map[string]string `json:"input" yaml:"input"`
+	Output    string            `json:"output,omitempty" yaml:"output,omitempty"`
+	Match     string            `json:"match,omitempty" yaml:"match,omitempty"`
+	Tolerance float64           `json:"tolerance,omitempty" yaml:"tolerance,omitempty"`
+}
+
+// MatchMode returns how the output of the example is compared. Outputs that
+// start with @ are files, everything else is compared exactly.
+func (e Example) MatchMode() string {
+	switch {
+	case e.Match != "":
+		return e.Match
+	case strings.HasPrefix(e.Output, "@"):
+		return ExampleMatchFile
+	default:
+		return ExampleMatchExact
+	}
 }
 
 type Config struct {
@@ -78,6 +106,7 @@ type Config struct {
 	Train       string       `json:"train,omitempty" yaml:"train,omitempty"`
 	Concurrency *Concurrency `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
 	Environment []string     `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Examples    []Example    `json:"examples,omitempty" yaml:"examples,omitempty"`
 
 	parsedEnvironment map[string]string
 }
@@ -338,6 +367,10 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		errs = append(errs, err)
 	}
 
+	if err := c.validateExamples(); err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -602,6 +635,23 @@ func (c *Config) ParsedEnvironment() map[string]string {
 	return c.parsedEnvironment
 }
 
+func (c *Config) validateExamples() error {
+	for i, example := range c.Examples {
+		name := example.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		mode := example.MatchMode()
+		if mode == ExampleMatchFile && !strings.HasPrefix(example.Output, "@") {
+			return fmt.Errorf("Example %s in cog.yaml matches a file, so its output must be a path prefixed with @", name)
+		}
+		if example.Tolerance != 0 && mode != ExampleMatchFile {
+			return fmt.Errorf("Example %s in cog.yaml has a tolerance, which is only supported for file outputs", name)
+		}
+	}
+	return nil
+}
+
 func (c *Config) loadEnvironment() error {
 	env, err := parseAndValidateEnvironment(c.Environment)
 	if err != nil {
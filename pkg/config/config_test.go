@@ -457,6 +457,30 @@ foo==1.0.0`
 	require.Equal(t, expected, requirements)
 }
 
+func TestPythonPackagesForArchTorchCPUOnARM(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:           false,
+			PythonVersion: "3.8",
+			PythonPackages: []string{
+				"torch==1.7.1",
+				"torchvision==0.8.2",
+				"foo==1.0.0",
+			},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.NoError(t, err)
+
+	requirements, err := config.PythonRequirementsForArch("linux", "arm64", []string{})
+	require.NoError(t, err)
+	expected := `--find-links https://download.pytorch.org/whl/torch_stable.html
+torch==1.7.1
+torchvision==0.8.2
+foo==1.0.0`
+	require.Equal(t, expected, requirements)
+}
+
 func TestPythonPackagesForArchTensorflowGPU(t *testing.T) {
 	config := &Config{
 		Build: &Build{
@@ -763,3 +787,29 @@ func TestContainsCoglet(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, config.ContainsCoglet())
 }
+
+func TestExamplesConfig(t *testing.T) {
+	yamlString := `
+build:
+  python_version: "3.12"
+predict: "predict.py:Predictor"
+examples:
+  - name: greeting
+    input:
+      name: world
+    output: hello world
+  - input:
+      image: "@examples/in.png"
+    output: "@examples/out.png"
+    tolerance: 0.01
+`
+	cfg, err := FromYAML([]byte(yamlString))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(""))
+	require.Len(t, cfg.Examples, 2)
+	require.Equal(t, ExampleMatchExact, cfg.Examples[0].MatchMode())
+	require.Equal(t, ExampleMatchFile, cfg.Examples[1].MatchMode())
+
+	cfg.Examples[0].Tolerance = 0.5
+	require.ErrorContains(t, cfg.ValidateAndComplete(""), "Example greeting in cog.yaml has a tolerance")
+}
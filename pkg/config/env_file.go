@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// EnvFilename is the name of the file in a project that environment variables
+// are loaded from when the model is run locally. It is meant for secrets, so
+// it should be ignored by git and .dockerignore.
+const EnvFilename = ".cog.env"
+
+// EnvVar is an environment variable and where its value was set.
+type EnvVar struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ParseEnvFile reads environment variables from a file in the format of
+// docker run --env-file. Each line is NAME=VALUE, or NAME to pass on the
+// value from the current environment, and lines starting with # are
+// comments. Values are taken as they are, without removing quotes.
+func ParseEnvFile(path string) ([]EnvVar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read env file: %w", err)
+	}
+	defer f.Close()
+
+	vars := []EnvVar{}
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimLeftFunc(scanner.Text(), unicode.IsSpace)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(line, "=")
+		if name == "" {
+			return nil, fmt.Errorf("%s:%d: variable without a name", path, lineNumber)
+		}
+		if strings.ContainsFunc(name, unicode.IsSpace) {
+			return nil, fmt.Errorf("%s:%d: variable %q contains whitespace", path, lineNumber, name)
+		}
+		if err := ValidateEnvName(name); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		if !hasValue {
+			value, hasValue = os.LookupEnv(name)
+			if !hasValue {
+				continue
+			}
+		}
+		vars = append(vars, EnvVar{Name: name, Value: value, Source: path})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read env file: %w", err)
+	}
+	return vars, nil
+}
+
+// MergeEnv merges lists of environment variables, where a variable overrides
+// any variable of the same name in earlier lists. Variables are in the order
+// they were first set.
+func MergeEnv(lists ...[]EnvVar) []EnvVar {
+	merged := []EnvVar{}
+	index := map[string]int{}
+	for _, vars := range lists {
+		for _, v := range vars {
+			if i, ok := index[v.Name]; ok {
+				merged[i] = v
+				continue
+			}
+			index[v.Name] = len(merged)
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Setenv("COG_TEST_FROM_HOST", "host value")
+	path := filepath.Join(t.TempDir(), ".cog.env")
+	require.NoError(t, os.WriteFile(path, []byte(`# API keys
+API_KEY=secret
+
+  QUOTED="kept as is"
+EMPTY=
+COG_TEST_FROM_HOST
+COG_TEST_UNSET
+`), 0o644))
+
+	vars, err := ParseEnvFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []EnvVar{
+		{Name: "API_KEY", Value: "secret", Source: path},
+		{Name: "QUOTED", Value: `"kept as is"`, Source: path},
+		{Name: "EMPTY", Value: "", Source: path},
+		{Name: "COG_TEST_FROM_HOST", Value: "host value", Source: path},
+	}, vars)
+}
+
+func TestParseEnvFileDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env")
+	require.NoError(t, os.WriteFile(path, []byte("API_KEY=secret\nCUDA_HOME=/cuda\n"), 0o644))
+	_, err := ParseEnvFile(path)
+	require.ErrorContains(t, err, path+`:2: environment variable "CUDA_HOME" is not allowed`)
+
+	require.NoError(t, os.WriteFile(path, []byte("MY VAR=value\n"), 0o644))
+	_, err = ParseEnvFile(path)
+	require.ErrorContains(t, err, "contains whitespace")
+}
+
+func TestMergeEnv(t *testing.T) {
+	merged := MergeEnv(
+		[]EnvVar{{Name: "A", Value: "1", Source: "cog.yaml"}, {Name: "B", Value: "2", Source: "cog.yaml"}},
+		[]EnvVar{{Name: "B", Value: "3", Source: ".cog.env"}, {Name: "C", Value: "4", Source: ".cog.env"}},
+	)
+	require.Equal(t, []EnvVar{
+		{Name: "A", Value: "1", Source: "cog.yaml"},
+		{Name: "B", Value: "3", Source: ".cog.env"},
+		{Name: "C", Value: "4", Source: ".cog.env"},
+	}, merged)
+}
@@ -35,9 +35,9 @@ var EnvironmentVariableDenyList = []string{
 	"KUBERNETES_*",
 }
 
-// validateEnvName checks if the given environment variable name is allowed.
+// ValidateEnvName checks if the given environment variable name is allowed.
 // Returns an error if the name matches any of the restricted patterns.
-func validateEnvName(name string) error {
+func ValidateEnvName(name string) error {
 	for _, pattern := range EnvironmentVariableDenyList {
 		// Check for exact match
 		if pattern == name {
@@ -64,7 +64,7 @@ func parseAndValidateEnvironment(input []string) (map[string]string, error) {
 		if len(parts) != 2 || parts[0] == "" {
 			return nil, fmt.Errorf("environment variable %q is not in the KEY=VALUE format", input)
 		}
-		if err := validateEnvName(parts[0]); err != nil {
+		if err := ValidateEnvName(parts[0]); err != nil {
 			return nil, err
 		}
 		if _, ok := env[parts[0]]; ok {
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LockFilename is the name of the file in a project that `cog lock` writes
+// the resolved build environment to, and `cog build --locked` builds from.
+const LockFilename = "cog.lock"
+
+// LockVersion is the version of the lock file format.
+const LockVersion = 1
+
+// Lock is the build environment of a model resolved at the time `cog lock`
+// was run: the base image digest, the versions of the system and Python
+// packages that were installed, the cog wheel, and the CUDA/cuDNN versions.
+type Lock struct {
+	Version int `json:"version"`
+	// ConfigHash is a hash of the build section of cog.yaml and the Python
+	// requirements, to find out whether the lock is out of date
+	ConfigHash     string                `json:"config_hash"`
+	CogVersion     string                `json:"cog_version"`
+	CogWheel       string                `json:"cog_wheel,omitempty"`
+	Platform       string                `json:"platform"`
+	CUDA           string                `json:"cuda,omitempty"`
+	CuDNN          string                `json:"cudnn,omitempty"`
+	BaseImage      LockedImage           `json:"base_image"`
+	SystemPackages []LockedSystemPackage `json:"system_packages"`
+	PythonPackages []LockedPythonPackage `json:"python_packages"`
+}
+
+type LockedImage struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// Reference returns the image reference pinned to the digest, like
+// python:3.12-slim@sha256:...
+func (i LockedImage) Reference() string {
+	if i.Digest == "" {
+		return i.Name
+	}
+	return i.Name + "@" + i.Digest
+}
+
+type LockedSystemPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type LockedPythonPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// URL is set for packages installed from a URL instead of an index
+	URL    string   `json:"url,omitempty"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// Requirement returns the package as a line of a requirements file, like
+// torch==2.5.0 or cog @ https://...
+func (p LockedPythonPackage) Requirement() string {
+	if p.URL != "" {
+		return p.Name + " @ " + p.URL
+	}
+	return p.Name + "==" + p.Version
+}
+
+// ReadLock reads the lock file from the project directory.
+func ReadLock(projectDir string) (*Lock, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, LockFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s not found, run `cog lock` to create it", LockFilename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", LockFilename, err)
+	}
+	lock := &Lock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", LockFilename, err)
+	}
+	if lock.Version != LockVersion {
+		return nil, fmt.Errorf("%s has version %d, but this version of Cog reads version %d, run `cog lock` to update it", LockFilename, lock.Version, LockVersion)
+	}
+	return lock, nil
+}
+
+// Write writes the lock file to the project directory.
+func (l *Lock) Write(projectDir string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(filepath.Join(projectDir, LockFilename), data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", LockFilename, err)
+	}
+	return nil
+}
+
+// Check returns an error if cfg has changed since the lock was written.
+func (l *Lock) Check(cfg *Config) error {
+	if cfg.Build.CUDA != l.CUDA || cfg.Build.CuDNN != l.CuDNN {
+		return fmt.Errorf("%s was written for CUDA %q and cuDNN %q, but the build now uses CUDA %q and cuDNN %q, run `cog lock` to update it", LockFilename, l.CUDA, l.CuDNN, cfg.Build.CUDA, cfg.Build.CuDNN)
+	}
+	hash, err := cfg.LockHash()
+	if err != nil {
+		return err
+	}
+	if hash != l.ConfigHash {
+		return fmt.Errorf("%s is out of date with the build section of cog.yaml or the Python requirements, run `cog lock` to update it", LockFilename)
+	}
+	return nil
+}
+
+// SystemPackage returns the locked version of a system package.
+func (l *Lock) SystemPackage(name string) (string, bool) {
+	for _, pkg := range l.SystemPackages {
+		if pkg.Name == name {
+			return pkg.Version, true
+		}
+	}
+	return "", false
+}
+
+// CheckSystemPackages returns an error if the versions of the system packages
+// about to be installed, including dependencies, are different from the locked
+// ones.
+func (l *Lock) CheckSystemPackages(packages []LockedSystemPackage) error {
+	drift := []string{}
+	for _, pkg := range packages {
+		locked, ok := l.SystemPackage(pkg.Name)
+		if !ok {
+			drift = append(drift, fmt.Sprintf("%s %s would be installed, but isn't locked", pkg.Name, pkg.Version))
+		} else if locked != pkg.Version {
+			drift = append(drift, fmt.Sprintf("%s %s would be installed, but %s is locked", pkg.Name, pkg.Version, locked))
+		}
+	}
+	if len(drift) > 0 {
+		return fmt.Errorf("The system packages apt would install are different from %s:\n%s\nThe Linux distribution has probably updated them since it was written, run `cog lock` to update it", LockFilename, strings.Join(drift, "\n"))
+	}
+	return nil
+}
+
+// PythonRequirements returns the locked Python packages as a requirements
+// file. Hashes are only included if every package has them, because pip
+// requires hashes for all packages once one has them.
+func (l *Lock) PythonRequirements() string {
+	withHashes := len(l.PythonPackages) > 0
+	for _, pkg := range l.PythonPackages {
+		if len(pkg.Hashes) == 0 {
+			withHashes = false
+			break
+		}
+	}
+
+	lines := []string{}
+	for _, pkg := range l.PythonPackages {
+		line := pkg.Requirement()
+		if withHashes {
+			for _, hash := range pkg.Hashes {
+				line += " --hash=" + hash
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckPipFreeze returns an error if the packages in the output of pip freeze
+// are different from the locked Python packages.
+func (l *Lock) CheckPipFreeze(pipFreeze string) error {
+	installed, err := ParsePipFreeze(pipFreeze)
+	if err != nil {
+		return err
+	}
+	locked := map[string]LockedPythonPackage{}
+	for _, pkg := range l.PythonPackages {
+		locked[normalizePackageName(pkg.Name)] = pkg
+	}
+
+	drift := []string{}
+	for _, pkg := range installed {
+		name := normalizePackageName(pkg.Name)
+		lockedPkg, ok := locked[name]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("%s is installed, but not locked", pkg.Requirement()))
+		} else if lockedPkg.Version != pkg.Version || lockedPkg.URL != pkg.URL {
+			drift = append(drift, fmt.Sprintf("%s is installed, but %s is locked", pkg.Requirement(), lockedPkg.Requirement()))
+		}
+		delete(locked, name)
+	}
+	for _, lockedPkg := range locked {
+		drift = append(drift, fmt.Sprintf("%s is locked, but not installed", lockedPkg.Requirement()))
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		return fmt.Errorf("The Python packages in the image are different from %s:\n%s", LockFilename, strings.Join(drift, "\n"))
+	}
+	return nil
+}
+
+// ParsePipFreeze parses the output of pip freeze. Editable installs and cog
+// itself, which is locked as the cog wheel, are skipped.
+func ParsePipFreeze(pipFreeze string) ([]LockedPythonPackage, error) {
+	packages := []LockedPythonPackage{}
+	scanner := bufio.NewScanner(strings.NewReader(pipFreeze))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-e ") {
+			continue
+		}
+
+		var pkg LockedPythonPackage
+		if name, url, ok := strings.Cut(line, " @ "); ok {
+			pkg = LockedPythonPackage{Name: strings.TrimSpace(name), URL: strings.TrimSpace(url)}
+		} else if name, version, ok := strings.Cut(line, "=="); ok {
+			pkg = LockedPythonPackage{Name: name, Version: version}
+		} else {
+			return nil, fmt.Errorf("Failed to parse pip freeze line: %s", line)
+		}
+		if name := normalizePackageName(pkg.Name); name == "cog" || name == "coglet" {
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, scanner.Err()
+}
+
+// LockHash returns a hash of the build section of cog.yaml and the Python
+// requirements, which changes if anything the lock was resolved from changes.
+func (c *Config) LockHash() (string, error) {
+	data, err := json.Marshal(struct {
+		Build        *Build   `json:"build"`
+		Requirements []string `json:"requirements"`
+	}{c.Build, c.Build.pythonRequirementsContent})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+var packageNameSeparatorRegex = regexp.MustCompile(`[-_.]+`)
+
+// normalizePackageName normalizes a Python package name as described in PEP
+// 503, so names that pip considers the same compare equal.
+func normalizePackageName(name string) string {
+	return packageNameSeparatorRegex.ReplaceAllString(strings.ToLower(name), "-")
+}
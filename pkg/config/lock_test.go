@@ -0,0 +1,120 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePipFreeze(t *testing.T) {
+	packages, err := ParsePipFreeze(`# Editable install with no version control (foo==0.1)
+-e /src
+cog @ file:///tmp/cog-0.14.0-py3-none-any.whl
+Flask==3.0.0
+pydantic==2.9.2
+torch @ https://download.pytorch.org/whl/cu121/torch-2.5.0%2Bcu121-cp311-cp311-linux_x86_64.whl
+`)
+	require.NoError(t, err)
+	require.Equal(t, []LockedPythonPackage{
+		{Name: "Flask", Version: "3.0.0"},
+		{Name: "pydantic", Version: "2.9.2"},
+		{Name: "torch", URL: "https://download.pytorch.org/whl/cu121/torch-2.5.0%2Bcu121-cp311-cp311-linux_x86_64.whl"},
+	}, packages)
+
+	_, err = ParsePipFreeze("flask>=3\n")
+	require.ErrorContains(t, err, "Failed to parse pip freeze line: flask>=3")
+}
+
+func TestLockPythonRequirements(t *testing.T) {
+	lock := &Lock{PythonPackages: []LockedPythonPackage{
+		{Name: "flask", Version: "3.0.0", Hashes: []string{"sha256:aaa", "sha256:bbb"}},
+		{Name: "pydantic", Version: "2.9.2", Hashes: []string{"sha256:ccc"}},
+	}}
+	require.Equal(t, "flask==3.0.0 --hash=sha256:aaa --hash=sha256:bbb\npydantic==2.9.2 --hash=sha256:ccc", lock.PythonRequirements())
+
+	// pip requires hashes for every package once one has them
+	lock.PythonPackages = append(lock.PythonPackages, LockedPythonPackage{Name: "torch", Version: "2.5.0+cu121"})
+	require.Equal(t, "flask==3.0.0\npydantic==2.9.2\ntorch==2.5.0+cu121", lock.PythonRequirements())
+}
+
+func TestLockCheckPipFreeze(t *testing.T) {
+	lock := &Lock{PythonPackages: []LockedPythonPackage{
+		{Name: "Flask", Version: "3.0.0"},
+		{Name: "typing_extensions", Version: "4.12.2"},
+		{Name: "numpy", Version: "2.1.0"},
+	}}
+	require.NoError(t, lock.CheckPipFreeze("cog==0.14.0\nflask==3.0.0\ntyping-extensions==4.12.2\nnumpy==2.1.0\n"))
+
+	err := lock.CheckPipFreeze("flask==3.0.1\ntyping-extensions==4.12.2\nrequests==2.32.3\n")
+	require.EqualError(t, err, `The Python packages in the image are different from cog.lock:
+flask==3.0.1 is installed, but Flask==3.0.0 is locked
+numpy==2.1.0 is locked, but not installed
+requests==2.32.3 is installed, but not locked`)
+}
+
+func TestLockCheckSystemPackages(t *testing.T) {
+	lock := &Lock{SystemPackages: []LockedSystemPackage{
+		{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "libavcodec59", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "libc6", Version: "2.36-9+deb12u9"},
+	}}
+	require.NoError(t, lock.CheckSystemPackages([]LockedSystemPackage{
+		{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "libavcodec59", Version: "7:5.1.6-0+deb12u1"},
+	}))
+
+	// Dependencies are checked as well as the packages in cog.yaml
+	err := lock.CheckSystemPackages([]LockedSystemPackage{
+		{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "libavcodec59", Version: "7:5.1.7-0+deb12u1"},
+		{Name: "libx264-164", Version: "2:0.164.3095+gitbaee400-3"},
+	})
+	require.ErrorContains(t, err, "run `cog lock` to update it")
+	require.ErrorContains(t, err, `libavcodec59 7:5.1.7-0+deb12u1 would be installed, but 7:5.1.6-0+deb12u1 is locked
+libx264-164 2:0.164.3095+gitbaee400-3 would be installed, but isn't locked`)
+}
+
+func TestLockReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	_, err := ReadLock(dir)
+	require.EqualError(t, err, "cog.lock not found, run `cog lock` to create it")
+
+	lock := &Lock{
+		Version:        LockVersion,
+		ConfigHash:     "sha256:abc",
+		CogVersion:     "0.14.0",
+		Platform:       "linux/amd64",
+		BaseImage:      LockedImage{Name: "python:3.12-slim", Digest: "sha256:def"},
+		SystemPackages: []LockedSystemPackage{{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"}},
+		PythonPackages: []LockedPythonPackage{{Name: "flask", Version: "3.0.0"}},
+	}
+	require.NoError(t, lock.Write(dir))
+	read, err := ReadLock(dir)
+	require.NoError(t, err)
+	require.Equal(t, lock, read)
+	require.Equal(t, "python:3.12-slim@sha256:def", read.BaseImage.Reference())
+	version, ok := read.SystemPackage("ffmpeg")
+	require.True(t, ok)
+	require.Equal(t, "7:5.1.6-0+deb12u1", version)
+}
+
+func TestLockCheck(t *testing.T) {
+	cfg, err := FromYAML([]byte(`build:
+  python_version: "3.12"
+  system_packages:
+    - ffmpeg
+`))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(""))
+	hash, err := cfg.LockHash()
+	require.NoError(t, err)
+
+	lock := &Lock{ConfigHash: hash}
+	require.NoError(t, lock.Check(cfg))
+
+	cfg.Build.SystemPackages = append(cfg.Build.SystemPackages, "libsndfile1")
+	require.ErrorContains(t, lock.Check(cfg), "cog.lock is out of date")
+
+	lock.CUDA = "12.1"
+	require.ErrorContains(t, lock.Check(cfg), `cog.lock was written for CUDA "12.1"`)
+}
@@ -5,13 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
@@ -25,7 +25,6 @@ import (
 	buildkitclient "github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/term"
-	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/replicate/go/types/ptr"
@@ -42,6 +41,10 @@ func NewAPIClient(ctx context.Context, opts ...Option) (*apiClient, error) {
 		opt(clientOptions)
 	}
 
+	if clientOptions.builder == "" {
+		clientOptions.builder = os.Getenv("BUILDKIT_HOST")
+	}
+
 	if clientOptions.host == "" {
 		host, err := determineDockerHost()
 		if err != nil {
@@ -85,12 +88,16 @@ func NewAPIClient(ctx context.Context, opts ...Option) (*apiClient, error) {
 		authConfig[opt.ServerAddress] = opt
 	}
 
-	return &apiClient{client, authConfig}, nil
+	return &apiClient{client, authConfig, clientOptions.builder, clientOptions.builderTLS}, nil
 }
 
 type apiClient struct {
 	client     *dc.Client
 	authConfig map[string]registry.AuthConfig
+	// builder is the address of the BuildKit daemon images are built on, or
+	// empty to build on the Docker daemon's embedded BuildKit
+	builder    string
+	builderTLS builderTLS
 }
 
 func (c *apiClient) Pull(ctx context.Context, imageRef string, force bool) (*image.InspectResponse, error) {
@@ -160,7 +167,29 @@ func (c *apiClient) ContainerInspect(ctx context.Context, containerID string) (*
 	return &resp, nil
 }
 
-func (c *apiClient) ContainerLogs(ctx context.Context, containerID string, w io.Writer) error {
+func (c *apiClient) ContainerList(ctx context.Context, labels map[string]string) ([]string, error) {
+	console.Debugf("=== APIClient.ContainerList %v", labels)
+
+	args := filters.NewArgs()
+	for key, value := range labels {
+		if value == "" {
+			args.Add("label", key)
+		} else {
+			args.Add("label", key+"="+value)
+		}
+	}
+	containers, err := c.client.ContainerList(ctx, container.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	ids := make([]string, len(containers))
+	for i, cont := range containers {
+		ids[i] = cont.ID
+	}
+	return ids, nil
+}
+
+func (c *apiClient) ContainerLogs(ctx context.Context, containerID string, w io.Writer, follow bool) error {
 	console.Debugf("=== APIClient.ContainerLogs %s", containerID)
 
 	// First inspect the container to check if it has TTY enabled
@@ -172,7 +201,7 @@ func (c *apiClient) ContainerLogs(ctx context.Context, containerID string, w io.
 	logs, err := c.client.ContainerLogs(ctx, containerID, container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
-		Follow:     true,
+		Follow:     follow,
 	})
 	if err != nil {
 		if client.IsErrNotFound(err) {
@@ -291,12 +320,11 @@ func (c *apiClient) ImageBuild(ctx context.Context, options command.ImageBuildOp
 	}
 	defer os.RemoveAll(buildDir)
 
-	bc, err := buildkitclient.New(ctx, "",
-		// Connect to Docker Engine's embedded Buildkit.
-		buildkitclient.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
-			return c.client.DialHijack(ctx, "/grpc", "h2c", map[string][]string{})
-		}),
-	)
+	builder := c.builder
+	if options.EmbeddedBuilder {
+		builder = ""
+	}
+	bc, err := c.buildkitClient(ctx, builder)
 	if err != nil {
 		return err
 	}
@@ -318,15 +346,39 @@ func (c *apiClient) ImageBuild(ctx context.Context, options command.ImageBuildOp
 
 	// run the build in a goroutine
 	eg.Go(func() error {
-		options, err := solveOptFromImageOptions(buildDir, options)
+		solveOpt, err := solveOptFromImageOptions(buildDir, options)
 		if err != nil {
 			return err
 		}
 
+		var load *io.PipeWriter
+		if builder != "" {
+			// A builder other than Docker's can't see the local image store, so
+			// local images are sent to it, and the image is sent back and loaded
+			// into Docker.
+			if err := c.addLocalImages(ctx, buildDir, options.LocalImages, &solveOpt); err != nil {
+				return err
+			}
+			if options.Output == nil {
+				var pr *io.PipeReader
+				pr, load = io.Pipe()
+				solveOpt.Exports = []buildkitclient.ExportEntry{dockerLoadExport(solveOpt.Exports[0].Attrs, load)}
+				eg.Go(func() error {
+					defer pr.Close()
+					_, err := c.imageLoad(ctx, pr)
+					return err
+				})
+			}
+		}
+
 		// run the display in a goroutine _after_ we've built SolveOpt
 		eg.Go(newDisplay(statusCh, displayMode))
 
-		res, err = bc.Solve(ctx, nil, options, statusCh)
+		res, err = bc.Solve(ctx, nil, solveOpt, statusCh)
+		if load != nil {
+			// stop loading the image if the build failed before it was exported
+			load.CloseWithError(err)
+		}
 		if err != nil {
 			return err
 		}
@@ -344,6 +396,49 @@ func (c *apiClient) ImageBuild(ctx context.Context, options command.ImageBuildOp
 	return nil
 }
 
+func (c *apiClient) ImageLoad(ctx context.Context, path string) (string, error) {
+	console.Debugf("=== APIClient.ImageLoad %s", path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image tarball: %w", err)
+	}
+	defer f.Close()
+
+	name, err := c.imageLoad(ctx, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to load image from %s: %w", path, err)
+	}
+	return name, nil
+}
+
+func (c *apiClient) ImageExportSupported(ctx context.Context) (bool, error) {
+	console.Debugf("=== APIClient.ImageExportSupported")
+
+	// Images are exported by the Docker daemon's embedded BuildKit, even with
+	// a builder, since they are exported from the local image store
+	info, err := c.client.Info(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get docker info: %w", err)
+	}
+	return usesContainerdImageStore(info.DriverStatus), nil
+}
+
+func (c *apiClient) imageLoad(ctx context.Context, r io.Reader) (string, error) {
+	resp, err := c.client.ImageLoad(ctx, r, client.ImageLoadWithQuiet(true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// the response is a json stream of the same messages docker load prints
+	var out strings.Builder
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, &out, 0, false, nil); err != nil {
+		return "", fmt.Errorf("error during image load: %w", err)
+	}
+	return loadedImageName(out.String())
+}
+
 func (c *apiClient) containerRun(ctx context.Context, options command.RunOptions) (string, error) {
 	console.Debugf("=== APIClient.containerRun %s", options.Image)
 
@@ -365,6 +460,7 @@ func (c *apiClient) containerRun(ctx context.Context, options command.RunOptions
 		OpenStdin:    attachStdin,
 		StdinOnce:    attachStdin,
 		Tty:          tty,
+		Labels:       options.Labels,
 	}
 
 	// Set working directory if specified
@@ -385,8 +481,9 @@ func (c *apiClient) containerRun(ctx context.Context, options command.RunOptions
 		AutoRemove: true,
 		// https://github.com/pytorch/pytorch/issues/2244
 		// https://github.com/replicate/cog/issues/1293
-		ShmSize:   6 * 1024 * 1024 * 1024, // 6GB
-		Resources: container.Resources{},
+		ShmSize:    6 * 1024 * 1024 * 1024, // 6GB
+		Resources:  container.Resources{},
+		ExtraHosts: options.ExtraHosts,
 	}
 
 	if options.GPUs != "" {
@@ -423,10 +520,13 @@ func (c *apiClient) containerRun(ctx context.Context, options command.RunOptions
 		EndpointsConfig: map[string]*network.EndpointSettings{},
 	}
 
-	platform := &ocispec.Platform{
-		// force platform to linux/amd64
-		Architecture: "amd64",
-		OS:           "linux",
+	runPlatform, err := runPlatform(ctx, c, options)
+	if err != nil {
+		return "", err
+	}
+	platform, err := ocispecPlatform(runPlatform)
+	if err != nil {
+		return "", err
 	}
 
 	runContainer, err := c.client.ContainerCreate(ctx,
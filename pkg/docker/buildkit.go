@@ -3,8 +3,10 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/docker/docker/api/types/registry"
@@ -13,6 +15,7 @@ import (
 	"github.com/moby/buildkit/session/auth"
 	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/moby/buildkit/util/progress/progressui"
+	"github.com/tonistiigi/go-csvvalue"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -45,9 +48,9 @@ func solveOptFromImageOptions(buildDir string, opts command.ImageBuildOptions) (
 		// TODO[md]: support multi-stage target
 		// target is the name of a stage in a multi-stage Dockerfile
 		// "target": opts.Target,
-		// Replicate only supports linux/amd64, but local Docker Engine could be running on ARM,
-		// including Apple Silicon. Force it to linux/amd64 for now.
-		"platform": "linux/amd64",
+		// Replicate runs models on linux/amd64, but local Docker Engine could be running on ARM,
+		// including Apple Silicon. Default to linux/amd64 unless another platform is requested.
+		"platform": platformOrDefault(opts.Platform),
 	}
 
 	// disable cache if requested
@@ -105,17 +108,30 @@ func solveOptFromImageOptions(buildDir string, opts command.ImageBuildOptions) (
 		exporterAttrs["rewrite-timestamp"] = "true"
 	}
 
+	// Docker Engine's worker only supports three exporters.
+	// "moby" exporter works best for cog, since we want to keep images in
+	// Docker Engine's image store. The others are exporting images to somewhere else.
+	// https://github.com/moby/moby/blob/v20.10.24/builder/builder-next/worker/worker.go#L221
+	export := buildkitclient.ExportEntry{Type: "moby", Attrs: exporterAttrs}
+	if opts.Output != nil {
+		// Exporting to a tarball instead needs the "oci" or "docker" exporter, which
+		// Docker Engine supports when it uses the containerd image store. The
+		// exporter streams the tarball back over the session to dest.
+		dest := opts.Output.Dest
+		export = buildkitclient.ExportEntry{
+			Type:  opts.Output.Type,
+			Attrs: exporterAttrs,
+			Output: func(map[string]string) (io.WriteCloser, error) {
+				return os.Create(dest)
+			},
+		}
+	}
+
 	solveOpts := buildkitclient.SolveOpt{
 		Frontend:      "dockerfile.v0",
 		FrontendAttrs: frontendAttrs,
 		LocalDirs:     localDirs,
-		// Docker Engine's worker only supports three exporters.
-		// "moby" exporter works best for cog, since we want to keep images in
-		// Docker Engine's image store. The others are exporting images to somewhere else.
-		// https://github.com/moby/moby/blob/v20.10.24/builder/builder-next/worker/worker.go#L221
-		Exports: []buildkitclient.ExportEntry{
-			{Type: "moby", Attrs: exporterAttrs},
-		},
+		Exports:       []buildkitclient.ExportEntry{export},
 	}
 
 	// add auth provider to the session so the local engine can pull and push images
@@ -135,21 +151,93 @@ func solveOptFromImageOptions(buildDir string, opts command.ImageBuildOptions) (
 	}
 
 	// Set cache imports/exports to match DockerCommand logic
-	// If cogconfig.BuildXCachePath is set, use local cache; otherwise, use inline
+	cacheFrom, cacheTo := cacheOptions(opts)
+	for _, cache := range cacheFrom {
+		entry, err := parseCacheOption(cache, false)
+		if err != nil {
+			return buildkitclient.SolveOpt{}, err
+		}
+		solveOpts.CacheImports = append(solveOpts.CacheImports, entry)
+	}
+	for _, cache := range cacheTo {
+		entry, err := parseCacheOption(cache, true)
+		if err != nil {
+			return buildkitclient.SolveOpt{}, err
+		}
+		solveOpts.CacheExports = append(solveOpts.CacheExports, entry)
+	}
+
+	return solveOpts, nil
+}
+
+// cacheOptions returns the caches to import and export in the form of docker
+// buildx build --cache-from and --cache-to. Without caches in options, it
+// uses the local cache at cogconfig.BuildXCachePath if it is set, and
+// otherwise exports an inline cache.
+func cacheOptions(opts command.ImageBuildOptions) (cacheFrom []string, cacheTo []string) {
+	cacheFrom = opts.CacheFrom
+	cacheTo = opts.CacheTo
 	if cogconfig.BuildXCachePath != "" {
-		solveOpts.CacheImports = []buildkitclient.CacheOptionsEntry{
-			{Type: "local", Attrs: map[string]string{"src": cogconfig.BuildXCachePath}},
+		if len(cacheFrom) == 0 {
+			cacheFrom = []string{"type=local,src=" + cogconfig.BuildXCachePath}
+		}
+		if len(cacheTo) == 0 {
+			cacheTo = []string{"type=local,dest=" + cogconfig.BuildXCachePath}
 		}
-		solveOpts.CacheExports = []buildkitclient.CacheOptionsEntry{
-			{Type: "local", Attrs: map[string]string{"dest": cogconfig.BuildXCachePath}},
+	}
+	if len(cacheTo) == 0 {
+		cacheTo = []string{"type=inline"}
+	}
+	return cacheFrom, cacheTo
+}
+
+// parseCacheOption parses a cache in the form of docker buildx build
+// --cache-from or --cache-to, like "type=registry,ref=r8.im/user/model:cache".
+// A cache to import can also be an image ref, which is a registry cache.
+func parseCacheOption(cache string, export bool) (buildkitclient.CacheOptionsEntry, error) {
+	if !export && !strings.Contains(cache, "=") {
+		return buildkitclient.CacheOptionsEntry{Type: "registry", Attrs: map[string]string{"ref": cache}}, nil
+	}
+
+	fields, err := csvvalue.Fields(cache, nil)
+	if err != nil {
+		return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Failed to parse cache %q: %w", cache, err)
+	}
+	entry := buildkitclient.CacheOptionsEntry{Attrs: map[string]string{}}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Invalid cache %q, field %q must be a key=value pair", cache, field)
 		}
-	} else {
-		solveOpts.CacheExports = []buildkitclient.CacheOptionsEntry{
-			{Type: "inline"},
+		key = strings.ToLower(key)
+		if key == "type" {
+			entry.Type = value
+		} else {
+			entry.Attrs[key] = value
 		}
 	}
 
-	return solveOpts, nil
+	switch entry.Type {
+	case "registry":
+		if entry.Attrs["ref"] == "" {
+			return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Invalid cache %q, a registry cache needs a ref", cache)
+		}
+	case "local":
+		key := "src"
+		if export {
+			key = "dest"
+		}
+		if entry.Attrs[key] == "" {
+			return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Invalid cache %q, a local cache needs %s", cache, key)
+		}
+	case "inline":
+		if !export {
+			return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Invalid cache %q, an inline cache is imported from an image ref", cache)
+		}
+	case "":
+		return buildkitclient.CacheOptionsEntry{}, fmt.Errorf("Invalid cache %q, type is required", cache)
+	}
+	return entry, nil
 }
 
 func newDisplay(statusCh chan *buildkitclient.SolveStatus, displayMode string) func() error {
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	buildkitclient "github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+
+	cogconfig "github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker/command"
+)
+
+func TestSolveOptFromImageOptionsLoadsIntoDocker(t *testing.T) {
+	solveOpt, err := solveOptFromImageOptions(t.TempDir(), command.ImageBuildOptions{
+		DockerfileContents: "FROM scratch\n",
+		ImageName:          "my-model",
+	})
+	require.NoError(t, err)
+	require.Len(t, solveOpt.Exports, 1)
+	require.Equal(t, "moby", solveOpt.Exports[0].Type)
+	require.Equal(t, "my-model", solveOpt.Exports[0].Attrs["name"])
+	require.Nil(t, solveOpt.Exports[0].Output)
+}
+
+func TestSolveOptFromImageOptionsExportsTarball(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "model.tar")
+	solveOpt, err := solveOptFromImageOptions(t.TempDir(), command.ImageBuildOptions{
+		DockerfileContents: "FROM scratch\n",
+		ImageName:          "my-model",
+		Output:             &command.ImageBuildOutput{Type: command.ImageBuildOutputOCI, Dest: dest},
+	})
+	require.NoError(t, err)
+	require.Len(t, solveOpt.Exports, 1)
+	require.Equal(t, "oci", solveOpt.Exports[0].Type)
+	require.Equal(t, "my-model", solveOpt.Exports[0].Attrs["name"])
+
+	w, err := solveOpt.Exports[0].Output(nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("tarball"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	contents, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "tarball", string(contents))
+}
+
+func TestSolveOptFromImageOptionsCaches(t *testing.T) {
+	solveOpt, err := solveOptFromImageOptions(t.TempDir(), command.ImageBuildOptions{
+		DockerfileContents: "FROM scratch\n",
+		ImageName:          "my-model",
+		CacheFrom:          []string{"r8.im/user/model:cache", "type=local,src=/tmp/cache"},
+		CacheTo:            []string{"type=registry,ref=r8.im/user/model:cache,mode=max"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []buildkitclient.CacheOptionsEntry{
+		{Type: "registry", Attrs: map[string]string{"ref": "r8.im/user/model:cache"}},
+		{Type: "local", Attrs: map[string]string{"src": "/tmp/cache"}},
+	}, solveOpt.CacheImports)
+	require.Equal(t, []buildkitclient.CacheOptionsEntry{
+		{Type: "registry", Attrs: map[string]string{"ref": "r8.im/user/model:cache", "mode": "max"}},
+	}, solveOpt.CacheExports)
+}
+
+func TestCacheOptions(t *testing.T) {
+	cacheFrom, cacheTo := cacheOptions(command.ImageBuildOptions{})
+	require.Empty(t, cacheFrom)
+	require.Equal(t, []string{"type=inline"}, cacheTo)
+
+	cacheFrom, cacheTo = cacheOptions(command.ImageBuildOptions{CacheFrom: []string{"r8.im/user/model:cache"}})
+	require.Equal(t, []string{"r8.im/user/model:cache"}, cacheFrom)
+	require.Equal(t, []string{"type=inline"}, cacheTo)
+
+	cogconfig.BuildXCachePath = "/tmp/buildx-cache"
+	t.Cleanup(func() { cogconfig.BuildXCachePath = "" })
+
+	cacheFrom, cacheTo = cacheOptions(command.ImageBuildOptions{})
+	require.Equal(t, []string{"type=local,src=/tmp/buildx-cache"}, cacheFrom)
+	require.Equal(t, []string{"type=local,dest=/tmp/buildx-cache"}, cacheTo)
+
+	cacheFrom, cacheTo = cacheOptions(command.ImageBuildOptions{CacheTo: []string{"type=inline"}})
+	require.Equal(t, []string{"type=local,src=/tmp/buildx-cache"}, cacheFrom)
+	require.Equal(t, []string{"type=inline"}, cacheTo)
+}
+
+func TestParseCacheOptionInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		cache  string
+		export bool
+	}{
+		{"type=registry", false},
+		{"type=local,dest=/tmp/cache", false},
+		{"type=local,src=/tmp/cache", true},
+		{"type=inline", false},
+		{"ref=r8.im/user/model:cache", true},
+		{"r8.im/user/model:cache", true},
+	} {
+		_, err := parseCacheOption(tc.cache, tc.export)
+		require.Error(t, err, tc.cache)
+	}
+}
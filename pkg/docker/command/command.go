@@ -17,11 +17,23 @@ type Command interface {
 	LoadUserInformation(ctx context.Context, registryHost string) (*UserInfo, error)
 	Inspect(ctx context.Context, ref string) (*image.InspectResponse, error)
 	ImageExists(ctx context.Context, ref string) (bool, error)
-	ContainerLogs(ctx context.Context, containerID string, w io.Writer) error
+	// ContainerLogs writes the logs of a container to w. When follow is true, it
+	// keeps writing new logs until the container stops.
+	ContainerLogs(ctx context.Context, containerID string, w io.Writer, follow bool) error
+	// ContainerList returns the IDs of the running containers that have all of
+	// labels. An empty label value matches any value.
+	ContainerList(ctx context.Context, labels map[string]string) ([]string, error)
 	ContainerInspect(ctx context.Context, id string) (*container.InspectResponse, error)
 	ContainerStop(ctx context.Context, containerID string) error
 
 	ImageBuild(ctx context.Context, options ImageBuildOptions) error
+	// ImageLoad loads an image from a tarball written by docker save or an OCI
+	// image layout tarball, and returns the name of the loaded image.
+	ImageLoad(ctx context.Context, path string) (string, error)
+	// ImageExportSupported reports whether built images can be exported to
+	// tarballs, which Docker Engine only supports when it uses the containerd
+	// image store.
+	ImageExportSupported(ctx context.Context) (bool, error)
 	Run(ctx context.Context, options RunOptions) error
 	ContainerStart(ctx context.Context, options RunOptions) (string, error)
 }
@@ -40,11 +52,37 @@ type ImageBuildOptions struct {
 	ContextDir     string
 	BuildContexts  map[string]string
 	Labels         map[string]string
+	// Platform to build the image for, like linux/arm64. Defaults to linux/amd64
+	Platform string
+	// Output exports the image to a tarball instead of loading it into the
+	// local image store
+	Output *ImageBuildOutput
+	// LocalImages are images in the local image store the Dockerfile is built
+	// FROM. They are sent to builders that can't see the local image store
+	LocalImages []string
+	// EmbeddedBuilder builds on the Docker daemon's embedded BuildKit even if
+	// a builder is set, for small builds FROM images in the local image store
+	// that would otherwise be sent to the builder and back
+	EmbeddedBuilder bool
+	// CacheFrom are caches to import, like "type=registry,ref=r8.im/user/model:cache",
+	// "type=local,src=/tmp/cache" or an image ref, as in docker buildx build --cache-from
+	CacheFrom []string
+	// CacheTo are caches to export, like "type=registry,ref=r8.im/user/model:cache,mode=max",
+	// "type=local,dest=/tmp/cache" or "type=inline". Defaults to inline
+	CacheTo []string
 
 	// only supported on buildkit client, not cli client
 	BuildArgs map[string]*string
 }
 
+// ImageBuildOutput is a tarball a built image is exported to.
+type ImageBuildOutput struct {
+	// Type is ImageBuildOutputOCI or ImageBuildOutputDocker
+	Type string
+	// Dest is the path of the tarball
+	Dest string
+}
+
 type RunOptions struct {
 	Detach  bool
 	Args    []string
@@ -54,9 +92,15 @@ type RunOptions struct {
 	Ports   []Port
 	Volumes []Volume
 	Workdir string
-	Stdin   io.Reader
-	Stdout  io.Writer
-	Stderr  io.Writer
+	// ExtraHosts are additional hostname mappings in the form "host:ip"
+	ExtraHosts []string
+	Labels     map[string]string
+	// Platform of the image to run, like linux/arm64. Defaults to the platform
+	// of the image, or linux/amd64 if it isn't in the local image store
+	Platform string
+	Stdin    io.Reader
+	Stdout   io.Writer
+	Stderr   io.Writer
 }
 
 type Port struct {
@@ -22,3 +22,7 @@ var CogVersionLabelKey = global.LabelNamespace + "version"
 var CogOpenAPISchemaLabelKey = global.LabelNamespace + "openapi_schema"
 var CogWeightsManifestLabelKey = global.LabelNamespace + "r8_weights_manifest"
 var CogModelDependenciesLabelKey = global.LabelNamespace + "r8_model_dependencies"
+var CogSessionLabelKey = global.LabelNamespace + "session"
+var CogProjectDirLabelKey = global.LabelNamespace + "project_dir"
+var CogConfigHashLabelKey = global.LabelNamespace + "config_hash"
+var CogPortLabelKey = global.LabelNamespace + "port"
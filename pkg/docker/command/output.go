@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ImageBuildOutputOCI is an OCI image layout tarball
+	ImageBuildOutputOCI = "oci"
+	// ImageBuildOutputDocker is a tarball that can be loaded with docker load
+	ImageBuildOutputDocker = "docker"
+)
+
+// ParseImageBuildOutput parses an output in the form of
+// "type=oci,dest=model.tar", like docker buildx build --output.
+func ParseImageBuildOutput(s string) (*ImageBuildOutput, error) {
+	output := &ImageBuildOutput{}
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid output %q, expected type=oci,dest=model.tar", s)
+		}
+		switch key {
+		case "type":
+			output.Type = value
+		case "dest":
+			output.Dest = value
+		default:
+			return nil, fmt.Errorf("Invalid output %q, unknown key %q", s, key)
+		}
+	}
+	if output.Type != ImageBuildOutputOCI && output.Type != ImageBuildOutputDocker {
+		return nil, fmt.Errorf("Invalid output %q, type must be %s or %s", s, ImageBuildOutputOCI, ImageBuildOutputDocker)
+	}
+	if output.Dest == "" {
+		return nil, fmt.Errorf("Invalid output %q, dest is required", s)
+	}
+	return output, nil
+}
+
+// String returns the output in the form accepted by docker buildx build
+// --output.
+func (o *ImageBuildOutput) String() string {
+	return "type=" + o.Type + ",dest=" + o.Dest
+}
@@ -0,0 +1,30 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageBuildOutput(t *testing.T) {
+	output, err := ParseImageBuildOutput("type=oci,dest=model.tar")
+	require.NoError(t, err)
+	require.Equal(t, &ImageBuildOutput{Type: ImageBuildOutputOCI, Dest: "model.tar"}, output)
+	require.Equal(t, "type=oci,dest=model.tar", output.String())
+
+	output, err = ParseImageBuildOutput("dest=/tmp/model.tar, type=docker")
+	require.NoError(t, err)
+	require.Equal(t, &ImageBuildOutput{Type: ImageBuildOutputDocker, Dest: "/tmp/model.tar"}, output)
+}
+
+func TestParseImageBuildOutputInvalid(t *testing.T) {
+	for _, s := range []string{
+		"model.tar",
+		"type=local,dest=out",
+		"type=oci",
+		"type=oci,dest=model.tar,compression=zstd",
+	} {
+		_, err := ParseImageBuildOutput(s)
+		require.Error(t, err, s)
+	}
+}
@@ -2,8 +2,11 @@ package docker
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
+	"github.com/docker/docker/api/types/registry"
+
 	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
@@ -17,5 +20,14 @@ func NewClient(ctx context.Context, opts ...Option) (command.Command, error) {
 	}
 
 	console.Debugf("Docker client: cli")
+	clientOptions := &clientOptions{
+		authConfigs: make(map[string]registry.AuthConfig),
+	}
+	for _, opt := range opts {
+		opt(clientOptions)
+	}
+	if clientOptions.builder != "" {
+		return nil, fmt.Errorf("A BuildKit builder can't be set when COG_DOCKER_SDK_CLIENT=0, create a buildx builder with 'docker buildx create --driver remote %s' instead", clientOptions.builder)
+	}
 	return NewDockerCommand(), nil
 }
@@ -234,7 +234,7 @@ func runDockerClientTests(t *testing.T, dockerClient command.Command) {
 			defer testcontainers.CleanupContainer(t, container)
 
 			var buf bytes.Buffer
-			err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf)
+			err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf, true)
 			require.NoError(t, err, "Failed to get container logs")
 
 			assert.Equal(t, "1\n2\n3\n4\n5\n", buf.String())
@@ -257,7 +257,7 @@ func runDockerClientTests(t *testing.T, dockerClient command.Command) {
 			assert.Equal(t, state.Running, false)
 
 			var buf bytes.Buffer
-			err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf)
+			err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf, true)
 			require.NoError(t, err, "Failed to get container logs")
 
 			assert.Equal(t, "1\n2\n3\n", buf.String())
@@ -280,7 +280,7 @@ func runDockerClientTests(t *testing.T, dockerClient command.Command) {
 				defer testcontainers.CleanupContainer(t, container)
 
 				var buf bytes.Buffer
-				err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf)
+				err = dockerClient.ContainerLogs(t.Context(), container.ID, &buf, true)
 				require.NoError(t, err, "Failed to get container logs")
 				return buf.String()
 			}
@@ -297,7 +297,7 @@ func runDockerClientTests(t *testing.T, dockerClient command.Command) {
 		t.Run("ContainerDoesNotExist", func(t *testing.T) {
 			t.Parallel()
 
-			err := dockerClient.ContainerLogs(t.Context(), "containerid-that-does-not-exist", &bytes.Buffer{})
+			err := dockerClient.ContainerLogs(t.Context(), "containerid-that-does-not-exist", &bytes.Buffer{}, true)
 			require.ErrorIs(t, err, &command.NotFoundError{})
 		})
 	})
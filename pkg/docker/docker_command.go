@@ -20,8 +20,6 @@ import (
 	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
-
-	cogconfig "github.com/replicate/cog/pkg/config"
 )
 
 type DockerCommand struct{}
@@ -138,14 +136,40 @@ func (c *DockerCommand) ImageExists(ctx context.Context, ref string) (bool, erro
 	return true, nil
 }
 
-func (c *DockerCommand) ContainerLogs(ctx context.Context, containerID string, w io.Writer) error {
+func (c *DockerCommand) ContainerList(ctx context.Context, labels map[string]string) ([]string, error) {
+	console.Debugf("=== DockerCommand.ContainerList %v", labels)
+
+	args := []string{
+		"container",
+		"ls",
+		"--quiet",
+		"--no-trunc",
+	}
+	for key, value := range labels {
+		if value == "" {
+			args = append(args, "--filter", "label="+key)
+		} else {
+			args = append(args, "--filter", "label="+key+"="+value)
+		}
+	}
+
+	output, err := c.execCaptured(ctx, nil, "", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+func (c *DockerCommand) ContainerLogs(ctx context.Context, containerID string, w io.Writer, follow bool) error {
 	console.Debugf("=== DockerCommand.ContainerLogs %s", containerID)
 
 	args := []string{
 		"container",
 		"logs",
 		containerID,
-		"--follow",
+	}
+	if follow {
+		args = append(args, "--follow")
 	}
 
 	err := c.exec(ctx, nil, w, nil, "", args)
@@ -215,10 +239,10 @@ func (c *DockerCommand) ImageBuild(ctx context.Context, options command.ImageBui
 		"--provenance", "false",
 		// Fixes "WARNING: The requested image's platform (linux/amd64) does not match the detected host platform (linux/arm64/v8) and no specific platform was requested"
 		// We do this regardless of the host platform so windows/*. linux/arm64, etc work as well
-		"--platform", "linux/amd64",
+		"--platform", platformOrDefault(options.Platform),
 	}
 
-	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
+	if options.Output == nil && util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
 		args = append(args,
 			// buildx doesn't load images by default, so we tell it to load here. _however_, the
 			// --output type=docker,rewrite-timestamp=true flag also loads the image, this may not be necessary
@@ -243,21 +267,26 @@ func (c *DockerCommand) ImageBuild(ctx context.Context, options command.ImageBui
 	// Base Images are special, we force timestamp rewriting to epoch. This requires some consideration on the output
 	// format. It's generally safe to override to --output type=docker,rewrite-timestamp=true as the use of `--load` is
 	// equivalent to `--output type=docker`
+	// When exporting to a tarball, the same applies to the exporter of the tarball.
 	if options.Epoch != nil && *options.Epoch >= 0 {
+		output := "type=docker"
+		if options.Output != nil {
+			output = options.Output.String()
+		}
 		args = append(args,
 			"--build-arg", fmt.Sprintf("SOURCE_DATE_EPOCH=%d", options.Epoch),
-			"--output", "type=docker,rewrite-timestamp=true")
+			"--output", output+",rewrite-timestamp=true")
 		console.Infof("Forcing timestamp rewriting to epoch %d", options.Epoch)
+	} else if options.Output != nil {
+		args = append(args, "--output", options.Output.String())
 	}
 
-	if cogconfig.BuildXCachePath != "" {
-		args = append(
-			args,
-			"--cache-from", "type=local,src="+cogconfig.BuildXCachePath,
-			"--cache-to", "type=local,dest="+cogconfig.BuildXCachePath,
-		)
-	} else {
-		args = append(args, "--cache-to", "type=inline")
+	cacheFrom, cacheTo := cacheOptions(options)
+	for _, cache := range cacheFrom {
+		args = append(args, "--cache-from", cache)
+	}
+	for _, cache := range cacheTo {
+		args = append(args, "--cache-to", cache)
 	}
 
 	for name, dir := range options.BuildContexts {
@@ -284,6 +313,30 @@ func (c *DockerCommand) ImageBuild(ctx context.Context, options command.ImageBui
 	return c.exec(ctx, in, nil, nil, options.WorkingDir, args)
 }
 
+func (c *DockerCommand) ImageLoad(ctx context.Context, path string) (string, error) {
+	console.Debugf("=== DockerCommand.ImageLoad %s", path)
+
+	out, err := c.execCaptured(ctx, nil, "", []string{"load", "--input", path})
+	if err != nil {
+		return "", fmt.Errorf("failed to load image from %s: %w", path, err)
+	}
+	return loadedImageName(out)
+}
+
+func (c *DockerCommand) ImageExportSupported(ctx context.Context) (bool, error) {
+	console.Debugf("=== DockerCommand.ImageExportSupported")
+
+	out, err := c.execCaptured(ctx, nil, "", []string{"info", "--format", "{{json .DriverStatus}}"})
+	if err != nil {
+		return false, fmt.Errorf("failed to get docker info: %w", err)
+	}
+	var driverStatus [][2]string
+	if err := json.Unmarshal([]byte(out), &driverStatus); err != nil {
+		return false, fmt.Errorf("error unmarshaling docker info: %w", err)
+	}
+	return usesContainerdImageStore(driverStatus), nil
+}
+
 func (c *DockerCommand) ContainerStart(ctx context.Context, options command.RunOptions) (string, error) {
 	console.Debugf("=== DockerCommand.ContainerStart %s %v", options.Image, options.Args)
 
@@ -321,14 +374,17 @@ func (c *DockerCommand) containerRun(ctx context.Context, options command.RunOpt
 		}
 	}
 
+	platform, err := runPlatform(ctx, c, options)
+	if err != nil {
+		return err
+	}
 	args := []string{
 		"run",
 		"--rm",
 		// https://github.com/pytorch/pytorch/issues/2244
 		// https://github.com/replicate/cog/issues/1293
 		"--shm-size", "6G",
-		// force platform to linux/amd64
-		"--platform", "linux/amd64",
+		"--platform", platform,
 	}
 
 	for _, env := range options.Env {
@@ -359,11 +415,17 @@ func (c *DockerCommand) containerRun(ctx context.Context, options command.RunOpt
 	if options.Workdir != "" {
 		args = append(args, "--workdir", options.Workdir)
 	}
+	for _, host := range options.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+	for key, value := range options.Labels {
+		args = append(args, "--label", key+"="+value)
+	}
 
 	args = append(args, options.Image)
 	args = append(args, options.Args...)
 
-	err := c.exec(ctx, options.Stdin, options.Stdout, options.Stderr, "", args)
+	err = c.exec(ctx, options.Stdin, options.Stdout, options.Stderr, "", args)
 	if err != nil {
 		if isMissingDeviceDriverError(err) {
 			return ErrMissingDeviceDriver
@@ -98,17 +98,74 @@ func (_c *MockCommand2_ContainerInspect_Call) RunAndReturn(run func(ctx context.
 	return _c
 }
 
+// ContainerList provides a mock function for the type MockCommand2
+func (_mock *MockCommand2) ContainerList(ctx context.Context, labels map[string]string) ([]string, error) {
+	ret := _mock.Called(ctx, labels)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ContainerList")
+	}
+
+	var r0 []string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, map[string]string) ([]string, error)); ok {
+		return returnFunc(ctx, labels)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, map[string]string) []string); ok {
+		r0 = returnFunc(ctx, labels)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, map[string]string) error); ok {
+		r1 = returnFunc(ctx, labels)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCommand2_ContainerList_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ContainerList'
+type MockCommand2_ContainerList_Call struct {
+	*mock.Call
+}
+
+// ContainerList is a helper method to define mock.On call
+//   - ctx
+//   - labels
+func (_e *MockCommand2_Expecter) ContainerList(ctx interface{}, labels interface{}) *MockCommand2_ContainerList_Call {
+	return &MockCommand2_ContainerList_Call{Call: _e.mock.On("ContainerList", ctx, labels)}
+}
+
+func (_c *MockCommand2_ContainerList_Call) Run(run func(ctx context.Context, labels map[string]string)) *MockCommand2_ContainerList_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(map[string]string))
+	})
+	return _c
+}
+
+func (_c *MockCommand2_ContainerList_Call) Return(strings []string, err error) *MockCommand2_ContainerList_Call {
+	_c.Call.Return(strings, err)
+	return _c
+}
+
+func (_c *MockCommand2_ContainerList_Call) RunAndReturn(run func(ctx context.Context, labels map[string]string) ([]string, error)) *MockCommand2_ContainerList_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ContainerLogs provides a mock function for the type MockCommand2
-func (_mock *MockCommand2) ContainerLogs(ctx context.Context, containerID string, w io.Writer) error {
-	ret := _mock.Called(ctx, containerID, w)
+func (_mock *MockCommand2) ContainerLogs(ctx context.Context, containerID string, w io.Writer, follow bool) error {
+	ret := _mock.Called(ctx, containerID, w, follow)
 
 	if len(ret) == 0 {
 		panic("no return value specified for ContainerLogs")
 	}
 
 	var r0 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, string, io.Writer) error); ok {
-		r0 = returnFunc(ctx, containerID, w)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, io.Writer, bool) error); ok {
+		r0 = returnFunc(ctx, containerID, w, follow)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -124,13 +181,14 @@ type MockCommand2_ContainerLogs_Call struct {
 //   - ctx
 //   - containerID
 //   - w
-func (_e *MockCommand2_Expecter) ContainerLogs(ctx interface{}, containerID interface{}, w interface{}) *MockCommand2_ContainerLogs_Call {
-	return &MockCommand2_ContainerLogs_Call{Call: _e.mock.On("ContainerLogs", ctx, containerID, w)}
+//   - follow
+func (_e *MockCommand2_Expecter) ContainerLogs(ctx interface{}, containerID interface{}, w interface{}, follow interface{}) *MockCommand2_ContainerLogs_Call {
+	return &MockCommand2_ContainerLogs_Call{Call: _e.mock.On("ContainerLogs", ctx, containerID, w, follow)}
 }
 
-func (_c *MockCommand2_ContainerLogs_Call) Run(run func(ctx context.Context, containerID string, w io.Writer)) *MockCommand2_ContainerLogs_Call {
+func (_c *MockCommand2_ContainerLogs_Call) Run(run func(ctx context.Context, containerID string, w io.Writer, follow bool)) *MockCommand2_ContainerLogs_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(io.Writer))
+		run(args[0].(context.Context), args[1].(string), args[2].(io.Writer), args[3].(bool))
 	})
 	return _c
 }
@@ -140,7 +198,7 @@ func (_c *MockCommand2_ContainerLogs_Call) Return(err error) *MockCommand2_Conta
 	return _c
 }
 
-func (_c *MockCommand2_ContainerLogs_Call) RunAndReturn(run func(ctx context.Context, containerID string, w io.Writer) error) *MockCommand2_ContainerLogs_Call {
+func (_c *MockCommand2_ContainerLogs_Call) RunAndReturn(run func(ctx context.Context, containerID string, w io.Writer, follow bool) error) *MockCommand2_ContainerLogs_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -470,6 +528,115 @@ func (_c *MockCommand2_ImageExists_Call) RunAndReturn(run func(ctx context.Conte
 	return _c
 }
 
+// ImageLoad provides a mock function for the type MockCommand2
+func (_mock *MockCommand2) ImageLoad(ctx context.Context, path string) (string, error) {
+	ret := _mock.Called(ctx, path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImageLoad")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return returnFunc(ctx, path)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = returnFunc(ctx, path)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = returnFunc(ctx, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCommand2_ImageLoad_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImageLoad'
+type MockCommand2_ImageLoad_Call struct {
+	*mock.Call
+}
+
+// ImageLoad is a helper method to define mock.On call
+//   - ctx
+//   - path
+func (_e *MockCommand2_Expecter) ImageLoad(ctx interface{}, path interface{}) *MockCommand2_ImageLoad_Call {
+	return &MockCommand2_ImageLoad_Call{Call: _e.mock.On("ImageLoad", ctx, path)}
+}
+
+func (_c *MockCommand2_ImageLoad_Call) Run(run func(ctx context.Context, path string)) *MockCommand2_ImageLoad_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockCommand2_ImageLoad_Call) Return(s string, err error) *MockCommand2_ImageLoad_Call {
+	_c.Call.Return(s, err)
+	return _c
+}
+
+func (_c *MockCommand2_ImageLoad_Call) RunAndReturn(run func(ctx context.Context, path string) (string, error)) *MockCommand2_ImageLoad_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ImageExportSupported provides a mock function for the type MockCommand2
+func (_mock *MockCommand2) ImageExportSupported(ctx context.Context) (bool, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImageExportSupported")
+	}
+
+	var r0 bool
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (bool, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) bool); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCommand2_ImageExportSupported_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImageExportSupported'
+type MockCommand2_ImageExportSupported_Call struct {
+	*mock.Call
+}
+
+// ImageExportSupported is a helper method to define mock.On call
+//   - ctx
+func (_e *MockCommand2_Expecter) ImageExportSupported(ctx interface{}) *MockCommand2_ImageExportSupported_Call {
+	return &MockCommand2_ImageExportSupported_Call{Call: _e.mock.On("ImageExportSupported", ctx)}
+}
+
+func (_c *MockCommand2_ImageExportSupported_Call) Run(run func(ctx context.Context)) *MockCommand2_ImageExportSupported_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockCommand2_ImageExportSupported_Call) Return(b bool, err error) *MockCommand2_ImageExportSupported_Call {
+	_c.Call.Return(b, err)
+	return _c
+}
+
+func (_c *MockCommand2_ImageExportSupported_Call) RunAndReturn(run func(ctx context.Context) (bool, error)) *MockCommand2_ImageExportSupported_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Inspect provides a mock function for the type MockCommand2
 func (_mock *MockCommand2) Inspect(ctx context.Context, ref string) (*image.InspectResponse, error) {
 	ret := _mock.Called(ctx, ref)
@@ -83,7 +83,11 @@ func (c *MockCommand) ImageExists(ctx context.Context, ref string) (bool, error)
 	panic("not implemented")
 }
 
-func (c *MockCommand) ContainerLogs(ctx context.Context, containerID string, w io.Writer) error {
+func (c *MockCommand) ContainerList(ctx context.Context, labels map[string]string) ([]string, error) {
+	panic("not implemented")
+}
+
+func (c *MockCommand) ContainerLogs(ctx context.Context, containerID string, w io.Writer, follow bool) error {
 	panic("not implemented")
 }
 
@@ -99,6 +103,14 @@ func (c *MockCommand) ImageBuild(ctx context.Context, options command.ImageBuild
 	panic("not implemented")
 }
 
+func (c *MockCommand) ImageLoad(ctx context.Context, path string) (string, error) {
+	panic("not implemented")
+}
+
+func (c *MockCommand) ImageExportSupported(ctx context.Context) (bool, error) {
+	panic("not implemented")
+}
+
 func (c *MockCommand) Run(ctx context.Context, options command.RunOptions) error {
 	// hack to handle generating tar files for monobase
 	if options.Args[0] == "/opt/r8/monobase/tar.sh" || options.Args[0] == "/opt/r8/monobase/apt.sh" {
@@ -0,0 +1,16 @@
+package docker
+
+// containerdSnapshotterDriverType is the driver-type in the driver status of
+// Docker Engine when it uses the containerd image store.
+const containerdSnapshotterDriverType = "io.containerd.snapshotter.v1"
+
+// usesContainerdImageStore returns whether the driver status from docker info
+// is that of the containerd image store.
+func usesContainerdImageStore(driverStatus [][2]string) bool {
+	for _, status := range driverStatus {
+		if status[0] == "driver-type" && status[1] == containerdSnapshotterDriverType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsesContainerdImageStore(t *testing.T) {
+	require.True(t, usesContainerdImageStore([][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}))
+	require.False(t, usesContainerdImageStore([][2]string{
+		{"Backing Filesystem", "extfs"},
+		{"Supports d_type", "true"},
+	}))
+	require.False(t, usesContainerdImageStore(nil))
+}
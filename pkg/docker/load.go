@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// loadedImageName returns the name of the image docker load loaded from its
+// output, or the image ID if the tarball doesn't name the image.
+func loadedImageName(output string) (string, error) {
+	imageID := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "Loaded image: "); ok {
+			return name, nil
+		}
+		if id, ok := strings.CutPrefix(line, "Loaded image ID: "); ok && imageID == "" {
+			imageID = id
+		}
+	}
+	if imageID == "" {
+		return "", fmt.Errorf("Failed to find the loaded image in the output of docker load: %s", output)
+	}
+	return imageID, nil
+}
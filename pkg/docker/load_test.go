@@ -0,0 +1,20 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadedImageName(t *testing.T) {
+	name, err := loadedImageName("Loaded image: r8.im/user/model:latest\n")
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/user/model:latest", name)
+
+	name, err = loadedImageName("Loaded image ID: sha256:abc123\n")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:abc123", name)
+
+	_, err = loadedImageName("open model.tar: no such file or directory\n")
+	require.Error(t, err)
+}
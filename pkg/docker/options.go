@@ -5,6 +5,20 @@ import "github.com/docker/docker/api/types/registry"
 type clientOptions struct {
 	authConfigs map[string]registry.AuthConfig
 	host        string
+	builder     string
+	builderTLS  builderTLS
+}
+
+// builderTLS are the paths of the certificates used to connect to a builder
+// over TLS
+type builderTLS struct {
+	caCert string
+	cert   string
+	key    string
+}
+
+func (t builderTLS) enabled() bool {
+	return t.caCert != "" || t.cert != "" || t.key != ""
 }
 
 type Option func(*clientOptions)
@@ -20,3 +34,22 @@ func WithHost(host string) Option {
 		o.host = host
 	}
 }
+
+// WithBuilder builds images on the BuildKit daemon at address, like
+// tcp://buildkitd:1234 or docker-container://buildkitd, instead of the Docker
+// daemon's embedded BuildKit. Defaults to $BUILDKIT_HOST.
+func WithBuilder(address string) Option {
+	return func(o *clientOptions) {
+		o.builder = address
+	}
+}
+
+// WithBuilderTLS connects to the builder over TLS. caCert is the CA
+// certificate the builder's certificate is verified with, and defaults to the
+// system's. cert and key are the client certificate and key, for builders
+// that require them.
+func WithBuilderTLS(caCert, cert, key string) Option {
+	return func(o *clientOptions) {
+		o.builderTLS = builderTLS{caCert: caCert, cert: cert, key: key}
+	}
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/image"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
+)
+
+// platformOrDefault returns platform, or linux/amd64 to match production if
+// it is empty.
+func platformOrDefault(platform string) string {
+	if platform == "" {
+		return registry.DefaultPlatform.String()
+	}
+	return platform
+}
+
+func ocispecPlatform(platform string) (*ocispec.Platform, error) {
+	p, err := registry.ParsePlatform(platformOrDefault(platform))
+	if err != nil {
+		return nil, err
+	}
+	return &ocispec.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant}, nil
+}
+
+// runPlatform returns the platform a container of options.Image is run on. It
+// is options.Platform if set, or else the platform of the image, so images
+// built for the host, like linux/arm64 on Apple Silicon, aren't run under
+// emulation. Images that aren't in the local image store yet are pulled for
+// linux/amd64 to match production.
+func runPlatform(ctx context.Context, c command.Command, options command.RunOptions) (string, error) {
+	if options.Platform != "" {
+		return options.Platform, nil
+	}
+	resp, err := c.Inspect(ctx, options.Image)
+	if command.IsNotFoundError(err) {
+		return registry.DefaultPlatform.String(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return imagePlatform(resp), nil
+}
+
+// imagePlatform returns the platform of an inspected image, or linux/amd64 if
+// the image doesn't record one.
+func imagePlatform(resp *image.InspectResponse) string {
+	if resp.Os == "" || resp.Architecture == "" {
+		return registry.DefaultPlatform.String()
+	}
+	return registry.Platform{OS: resp.Os, Architecture: resp.Architecture, Variant: resp.Variant}.String()
+}
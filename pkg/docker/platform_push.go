@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	dc "github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/web"
+)
+
+// PlatformPush pushes the images of a multi-platform build, then an index of
+// them as image, so hosts pull the image for their platform. The image of each
+// platform is pushed by digest, so the registry only has the tag of the index.
+func PlatformPush(ctx context.Context, image string, platformImages []string, dockerClient command.Command, registryClient registry.Client, buildInfo BuildInfo, client *http.Client) error {
+	webClient := web.NewClient(dockerClient, client)
+	if err := webClient.PostPushStart(ctx, buildInfo.BuildID, buildInfo.BuildTime); err != nil {
+		console.Warnf("Failed to send build timings to server: %v", err)
+	}
+
+	ref, err := name.ParseReference(image, name.Insecure)
+	if err != nil {
+		return fmt.Errorf("Failed to parse image name %s: %w", image, err)
+	}
+	digestRefs := []string{}
+	for _, platformImage := range platformImages {
+		console.Infof("Pushing image '%s'...", platformImage)
+		img, err := localImage(ctx, platformImage)
+		if err != nil {
+			return err
+		}
+		digestRef, err := pushByDigest(ctx, ref.Context(), img)
+		if err != nil {
+			return fmt.Errorf("Failed to push image %s: %w", platformImage, err)
+		}
+		digestRefs = append(digestRefs, digestRef)
+	}
+
+	console.Infof("Pushing multi-platform image index '%s'...", image)
+	return registryClient.PushIndex(ctx, image, digestRefs)
+}
+
+// localImage returns an image in the local image store of the Docker daemon.
+// Its layers are read from the daemon as they are pushed, rather than held in
+// memory.
+func localImage(ctx context.Context, image string) (v1.Image, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse image name %s: %w", image, err)
+	}
+	host, err := determineDockerHost()
+	if err != nil {
+		return nil, fmt.Errorf("error determining docker host: %w", err)
+	}
+	client, err := dc.NewClientWithOpts(
+		dc.WithTLSClientConfigFromEnv(),
+		dc.WithVersionFromEnv(),
+		dc.WithAPIVersionNegotiation(),
+		dc.WithHost(host),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating docker client: %w", err)
+	}
+	img, err := daemon.Image(ref, daemon.WithContext(ctx), daemon.WithClient(client), daemon.WithUnbufferedOpener())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read image %s from Docker: %w", image, err)
+	}
+	return img, nil
+}
+
+// pushByDigest pushes img to repository without tagging it, and returns its
+// reference by digest, like r8.im/user/model@sha256:...
+func pushByDigest(ctx context.Context, repository name.Repository, img v1.Image) (string, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	ref := repository.Digest(digest.String())
+	if err := remote.Write(ref, img,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+	); err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushByDigest(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	repository, err := name.NewRepository(strings.TrimPrefix(server.URL, "http://")+"/user/model", name.Insecure)
+	require.NoError(t, err)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+
+	digestRef, err := pushByDigest(t.Context(), repository, img)
+	require.NoError(t, err)
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	require.Equal(t, repository.String()+"@"+digest.String(), digestRef)
+
+	ref, err := name.ParseReference(digestRef, name.Insecure)
+	require.NoError(t, err)
+	_, err = remote.Head(ref)
+	require.NoError(t, err)
+	tags, err := remote.List(repository)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+}
@@ -0,0 +1,14 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagePlatform(t *testing.T) {
+	require.Equal(t, "linux/arm64/v8", imagePlatform(&image.InspectResponse{Os: "linux", Architecture: "arm64", Variant: "v8"}))
+	require.Equal(t, "linux/amd64", imagePlatform(&image.InspectResponse{Os: "linux", Architecture: "amd64"}))
+	require.Equal(t, "linux/amd64", imagePlatform(&image.InspectResponse{}))
+}
@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/distribution/reference"
+	buildkitclient "github.com/moby/buildkit/client"
+	// Registers docker-container:// builder addresses, for buildkitd running in a local container
+	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// buildkitClient connects to the BuildKit daemon at builder, or to the Docker
+// daemon's embedded BuildKit if builder is empty.
+func (c *apiClient) buildkitClient(ctx context.Context, builder string) (*buildkitclient.Client, error) {
+	if builder != "" {
+		opts, err := c.builderTLS.clientOpts(builder)
+		if err != nil {
+			return nil, err
+		}
+		bc, err := buildkitclient.New(ctx, builder, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to BuildKit builder at %s: %w", builder, err)
+		}
+		return bc, nil
+	}
+
+	return buildkitclient.New(ctx, "",
+		// Connect to Docker Engine's embedded Buildkit.
+		buildkitclient.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return c.client.DialHijack(ctx, "/grpc", "h2c", map[string][]string{})
+		}),
+	)
+}
+
+// clientOpts returns the BuildKit client options to connect to builder over
+// TLS, if it is enabled. The builder's certificate is verified against the
+// host name of its address.
+func (t builderTLS) clientOpts(builder string) ([]buildkitclient.ClientOpt, error) {
+	if !t.enabled() {
+		return nil, nil
+	}
+	if (t.cert == "") != (t.key == "") {
+		return nil, errors.New("Both a client certificate and key must be set to connect to the builder with them")
+	}
+	u, err := url.Parse(builder)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse builder address %s: %w", builder, err)
+	}
+
+	opts := []buildkitclient.ClientOpt{}
+	if t.caCert != "" {
+		opts = append(opts, buildkitclient.WithServerConfig(u.Hostname(), t.caCert))
+	} else {
+		opts = append(opts, buildkitclient.WithServerConfigSystem(u.Hostname()))
+	}
+	if t.cert != "" {
+		opts = append(opts, buildkitclient.WithCredentials(t.cert, t.key))
+	}
+	return opts, nil
+}
+
+// dockerLoadExport returns an export entry that writes the image to w as a
+// tarball in the format of docker save, to be loaded into the Docker daemon.
+func dockerLoadExport(attrs map[string]string, w io.WriteCloser) buildkitclient.ExportEntry {
+	return buildkitclient.ExportEntry{
+		Type:  buildkitclient.ExporterDocker,
+		Attrs: attrs,
+		Output: func(map[string]string) (io.WriteCloser, error) {
+			return w, nil
+		},
+	}
+}
+
+// addLocalImages saves images from the local image store as OCI layouts in
+// dir, and adds them to solveOpt as named contexts, so the Dockerfile can be
+// built FROM them on a builder that can't see the local image store. The
+// layouts are sent to the builder over the session.
+func (c *apiClient) addLocalImages(ctx context.Context, dir string, images []string, solveOpt *buildkitclient.SolveOpt) error {
+	for i, image := range images {
+		layoutDir := filepath.Join(dir, fmt.Sprintf("local-image-%d", i))
+		digest, err := c.saveOCILayout(ctx, image, layoutDir)
+		if err != nil {
+			return fmt.Errorf("Failed to send local image %s to the builder: %w", image, err)
+		}
+		store, err := local.NewStore(layoutDir)
+		if err != nil {
+			return err
+		}
+		name, err := namedContextName(image)
+		if err != nil {
+			return err
+		}
+
+		storeID := fmt.Sprintf("cog-local-image-%d", i)
+		if solveOpt.OCIStores == nil {
+			solveOpt.OCIStores = map[string]content.Store{}
+		}
+		solveOpt.OCIStores[storeID] = store
+		solveOpt.FrontendAttrs["context:"+name] = "oci-layout://" + storeID + "@" + digest
+	}
+	return nil
+}
+
+// saveOCILayout saves image into dir as an OCI layout, and returns the digest
+// of its manifest.
+func (c *apiClient) saveOCILayout(ctx context.Context, image string, dir string) (string, error) {
+	rc, err := c.client.ImageSave(ctx, []string{image})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	if err := extractTar(rc, dir); err != nil {
+		return "", err
+	}
+
+	// docker save writes an OCI layout since Docker 25
+	data, err := os.ReadFile(filepath.Join(dir, ocispec.ImageIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.New("Docker didn't save the image as an OCI layout, which requires Docker 25 or later")
+	}
+	if err != nil {
+		return "", err
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("Failed to parse %s: %w", ocispec.ImageIndexFile, err)
+	}
+	if len(index.Manifests) == 0 {
+		return "", fmt.Errorf("%s has no manifests", ocispec.ImageIndexFile)
+	}
+	return index.Manifests[0].Digest.String(), nil
+}
+
+// namedContextName returns the name of the named context the Dockerfile
+// frontend uses for FROM image, like my-model for my-model:latest.
+func namedContextName(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse image name %s: %w", image, err)
+	}
+	return strings.TrimSuffix(reference.FamiliarString(named), ":latest"), nil
+}
+
+// extractTar extracts the directories and regular files of a tarball into
+// dir. Other entries, like the symlinks of the legacy layout of docker save,
+// are skipped.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, header.Name) // #nosec G305
+		if target != filepath.Clean(dir) && !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("Illegal path in tarball: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr) // #nosec G110
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
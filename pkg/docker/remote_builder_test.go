@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestNamedContextName(t *testing.T) {
+	for image, expected := range map[string]string{
+		"my-model":                 "my-model",
+		"my-model:latest":          "my-model",
+		"my-model-weights:v1":      "my-model-weights:v1",
+		"r8.im/user/model":         "r8.im/user/model",
+		"docker.io/library/alpine": "alpine",
+		"localhost:5000/model:v2":  "localhost:5000/model:v2",
+	} {
+		name, err := namedContextName(image)
+		require.NoError(t, err)
+		require.Equal(t, expected, name, image)
+	}
+}
+
+func TestExtractTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "blobs/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "index.json", Typeflag: tar.TypeReg, Mode: 0o644, Size: 2}))
+	_, err := tw.Write([]byte("{}"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "abc/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../blobs/sha256/abc"}))
+	require.NoError(t, tw.Close())
+
+	dir := t.TempDir()
+	require.NoError(t, extractTar(&buf, dir))
+	contents, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(contents))
+	require.DirExists(t, filepath.Join(dir, "blobs"))
+	require.NoFileExists(t, filepath.Join(dir, "abc", "layer.tar"))
+}
+
+func TestExtractTarRejectsPathsOutsideDir(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}))
+	require.NoError(t, tw.Close())
+
+	require.ErrorContains(t, extractTar(&buf, t.TempDir()), "Illegal path")
+}
+
+func TestBuilderTLSClientOpts(t *testing.T) {
+	opts, err := builderTLS{}.clientOpts("tcp://buildkitd:1234")
+	require.NoError(t, err)
+	require.Empty(t, opts)
+
+	opts, err = builderTLS{caCert: "ca.pem"}.clientOpts("tcp://buildkitd:1234")
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+
+	opts, err = builderTLS{caCert: "ca.pem", cert: "cert.pem", key: "key.pem"}.clientOpts("tcp://buildkitd:1234")
+	require.NoError(t, err)
+	require.Len(t, opts, 2)
+
+	_, err = builderTLS{cert: "cert.pem"}.clientOpts("tcp://buildkitd:1234")
+	require.ErrorContains(t, err, "Both a client certificate and key")
+}
+
+func TestRemoteBuilder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping remote builder tests in short mode")
+	}
+
+	dockerHelper := dockertest.NewHelperClient(t)
+	builder := startBuildkitd(t)
+
+	apiClient, err := NewAPIClient(t.Context(), WithBuilder(builder))
+	require.NoError(t, err, "Failed to create docker api client")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0o644))
+	extraDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(extraDir, "world.txt"), []byte("world"), 0o644))
+	t.Setenv("COG_TEST_SECRET", "secret")
+
+	// The context, build contexts and secrets are sent to the builder
+	baseRef := dockertest.NewRef(t).String()
+	dockerHelper.CleanupImage(t, baseRef)
+	err = apiClient.ImageBuild(t.Context(), command.ImageBuildOptions{
+		WorkingDir: dir,
+		DockerfileContents: `FROM alpine:3.21
+COPY hello.txt /hello.txt
+COPY --from=extra world.txt /world.txt
+RUN --mount=type=secret,id=test-secret test "$(cat /run/secrets/test-secret)" = secret
+`,
+		ImageName:      baseRef,
+		ContextDir:     ".",
+		BuildContexts:  map[string]string{"extra": extraDir},
+		Secrets:        []string{"id=test-secret,env=COG_TEST_SECRET"},
+		ProgressOutput: "plain",
+	})
+	require.NoError(t, err, "Failed to build image on remote builder")
+	base := dockerHelper.InspectImage(t, baseRef)
+
+	// Images in the local image store are sent to the builder
+	ref := dockertest.NewRef(t).String()
+	dockerHelper.CleanupImage(t, ref)
+	err = apiClient.ImageBuild(t.Context(), command.ImageBuildOptions{
+		WorkingDir:         dir,
+		DockerfileContents: "FROM " + baseRef + "\nCOPY hello.txt /hello-again.txt\n",
+		ImageName:          ref,
+		ContextDir:         ".",
+		LocalImages:        []string{baseRef},
+		ProgressOutput:     "plain",
+	})
+	require.NoError(t, err, "Failed to build image from local image on remote builder")
+	img := dockerHelper.InspectImage(t, ref)
+	require.Equal(t, base.RootFS.Layers, img.RootFS.Layers[:len(base.RootFS.Layers)])
+	require.Len(t, img.RootFS.Layers, len(base.RootFS.Layers)+1)
+}
+
+// startBuildkitd starts a buildkitd container and returns its address.
+func startBuildkitd(t *testing.T) string {
+	t.Helper()
+
+	buildkitd, err := testcontainers.GenericContainer(t.Context(), testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "moby/buildkit:v0.22.0",
+			Cmd:          []string{"--addr", "tcp://0.0.0.0:1234"},
+			ExposedPorts: []string{"1234/tcp"},
+			HostConfigModifier: func(hostConfig *container.HostConfig) {
+				hostConfig.Privileged = true
+			},
+			WaitingFor: wait.ForListeningPort("1234/tcp").WithStartupTimeout(30 * time.Second),
+		},
+		Started: true,
+	})
+	testcontainers.CleanupContainer(t, buildkitd)
+	require.NoError(t, err, "Failed to start buildkitd")
+
+	endpoint, err := buildkitd.PortEndpoint(t.Context(), "1234/tcp", "")
+	require.NoError(t, err, "Failed to get buildkitd endpoint")
+	return fmt.Sprintf("tcp://%s", endpoint)
+}
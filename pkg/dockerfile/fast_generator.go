@@ -19,6 +19,7 @@ import (
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/requirements"
 	"github.com/replicate/cog/pkg/weights"
 )
@@ -91,9 +92,16 @@ func (g *FastGenerator) IsUsingCogBaseImage() bool {
 func (g *FastGenerator) SetPrecompile(precompile bool) {
 }
 
+// SetLock is a no-op, because fast builds can't be built from cog.lock.
+func (g *FastGenerator) SetLock(lock *config.Lock) {
+}
+
 func (g *FastGenerator) SetStrip(strip bool) {
 }
 
+func (g *FastGenerator) SetPlatform(platform registry.Platform) {
+}
+
 func (g *FastGenerator) SetUseCogBaseImage(useCogBaseImage bool) {
 }
 
@@ -3,6 +3,8 @@ package dockerfile
 import (
 	"context"
 
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/weights"
 )
 
@@ -13,7 +15,9 @@ type Generator interface {
 	GenerateModelBaseWithSeparateWeights(ctx context.Context, imageName string) (string, string, string, error)
 	Cleanup() error
 	SetStrip(bool)
+	SetLock(*config.Lock)
 	SetPrecompile(bool)
+	SetPlatform(registry.Platform)
 	SetUseCudaBaseImage(string)
 	IsUsingCogBaseImage() bool
 	BaseImage(ctx context.Context) (string, error)
@@ -2,17 +2,19 @@ package dockerfile
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/dockercontext"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/slices"
@@ -20,6 +22,14 @@ import (
 	"github.com/replicate/cog/pkg/weights"
 )
 
+// ExcludedProjectFiles are the paths in the project directory that hold files
+// of the user rather than the model. They're added to .dockerignore while the
+// model is built, so they're never sent to Docker or copied into the image.
+var ExcludedProjectFiles = []string{
+	path.Join(global.CogBuildArtifactsFolder, "predictions"),
+	config.EnvFilename,
+}
+
 const DockerignoreHeader = `# generated by replicate/cog
 __pycache__
 *.pyc
@@ -48,11 +58,18 @@ const CFlags = "ENV CFLAGS=\"-O3 -funroll-loops -fno-strict-aliasing -flto -S\""
 const PrecompilePythonCommand = "RUN find / -type f -name \"*.py[co]\" -delete && find / -type f -name \"*.py\" -exec touch -t 197001010000 {} \\; && find / -type f -name \"*.py\" -printf \"%h\\n\" | sort -u | /usr/bin/python3 -m compileall --invalidation-mode timestamp -o 2 -j 0"
 const STANDARD_GENERATOR_NAME = "STANDARD_GENERATOR"
 
+// multiarchTuples are the directories in /usr/lib that Debian puts the
+// libraries of each architecture in.
+var multiarchTuples = map[string]string{
+	"amd64": "x86_64-linux-gnu",
+	"arm64": "aarch64-linux-gnu",
+}
+
 type StandardGenerator struct {
 	Config *config.Config
 	Dir    string
 
-	// these are here to make this type testable
+	// the platform the image is built for, which are fields to make this type testable
 	GOOS   string
 	GOARCH string
 
@@ -75,6 +92,9 @@ type StandardGenerator struct {
 	command                    command.Command
 	client                     registry.Client
 	requiresCog                bool
+
+	// lock pins the base image, packages and cog wheel to the versions in cog.lock
+	lock *config.Lock
 }
 
 func NewStandardGenerator(config *config.Config, dir string, command command.Command, client registry.Client, requiresCog bool) (*StandardGenerator, error) {
@@ -91,8 +111,8 @@ func NewStandardGenerator(config *config.Config, dir string, command command.Com
 	return &StandardGenerator{
 		Config:           config,
 		Dir:              dir,
-		GOOS:             runtime.GOOS,
-		GOARCH:           runtime.GOOS,
+		GOOS:             registry.DefaultPlatform.OS,
+		GOARCH:           registry.DefaultPlatform.Architecture,
 		tmpDir:           tmpDir,
 		relativeTmpDir:   relativeTmpDir,
 		fileWalker:       filepath.Walk,
@@ -128,6 +148,19 @@ func (g *StandardGenerator) IsUsingCogBaseImage() bool {
 	return true
 }
 
+// SetPlatform sets the platform to build the image for.
+func (g *StandardGenerator) SetPlatform(platform registry.Platform) {
+	g.GOOS = platform.OS
+	g.GOARCH = platform.Architecture
+}
+
+// SetLock sets the lock to build from. The generated Dockerfile installs the
+// locked base image and Python packages, and fails to generate if the build
+// has drifted from them. System packages are checked after the build.
+func (g *StandardGenerator) SetLock(lock *config.Lock) {
+	g.lock = lock
+}
+
 func (g *StandardGenerator) SetStrip(strip bool) {
 	g.strip = strip
 }
@@ -137,10 +170,17 @@ func (g *StandardGenerator) SetPrecompile(precompile bool) {
 }
 
 func (g *StandardGenerator) GenerateInitialSteps(ctx context.Context) (string, error) {
+	if err := g.validatePlatform(); err != nil {
+		return "", err
+	}
 	baseImage, err := g.BaseImage(ctx)
 	if err != nil {
 		return "", err
 	}
+	baseImage, err = g.lockedBaseImage(baseImage)
+	if err != nil {
+		return "", err
+	}
 	installPython, err := g.installPython()
 	if err != nil {
 		return "", err
@@ -297,7 +337,13 @@ func makeDockerignoreForWeights(dirs, files []string) string {
 	for _, p := range files {
 		contents += fmt.Sprintf("%[1]s\n", p)
 	}
-	return DockerignoreHeader + contents
+	return DockerignoreHeader + contents + DockerignoreExcludedProjectFiles()
+}
+
+// DockerignoreExcludedProjectFiles returns the .dockerignore lines that exclude
+// ExcludedProjectFiles.
+func DockerignoreExcludedProjectFiles() string {
+	return strings.Join(ExcludedProjectFiles, "\n") + "\n"
 }
 
 func (g *StandardGenerator) Cleanup() error {
@@ -326,6 +372,17 @@ func (g *StandardGenerator) BaseImage(ctx context.Context) (string, error) {
 	return "python:" + g.Config.Build.PythonVersion + "-slim", nil
 }
 
+// lockedBaseImage pins baseImage to the digest in the lock.
+func (g *StandardGenerator) lockedBaseImage(baseImage string) (string, error) {
+	if g.lock == nil {
+		return baseImage, nil
+	}
+	if g.lock.BaseImage.Name != baseImage {
+		return "", fmt.Errorf("%s was written for base image %s, but the build now uses %s, run `cog lock` to update it", config.LockFilename, g.lock.BaseImage.Name, baseImage)
+	}
+	return g.lock.BaseImage.Reference(), nil
+}
+
 func (g *StandardGenerator) Name() string {
 	return STANDARD_GENERATOR_NAME
 }
@@ -341,10 +398,24 @@ func (g *StandardGenerator) BuildContexts() (map[string]string, error) {
 func (g *StandardGenerator) preamble() string {
 	return `ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
-ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/` + multiarchTuples[g.GOARCH] + `:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ENV NVIDIA_DRIVER_CAPABILITIES=all`
 }
 
+// validatePlatform returns an error if the image can't be built for the
+// platform.
+func (g *StandardGenerator) validatePlatform() error {
+	platform := registry.Platform{OS: g.GOOS, Architecture: g.GOARCH}
+	if _, ok := multiarchTuples[g.GOARCH]; !ok || g.GOOS != "linux" {
+		return fmt.Errorf("Cog can't build images for %s, only for linux/amd64 and linux/arm64", platform)
+	}
+	// Replicate and the CUDA packages Cog installs only support GPUs on amd64
+	if g.Config.Build.GPU && platform != registry.DefaultPlatform {
+		return fmt.Errorf("Models that use a GPU can only be built for %s, not %s", registry.DefaultPlatform, platform)
+	}
+	return nil
+}
+
 func (g *StandardGenerator) installTini() string {
 	// Install tini as the image entrypoint to provide signal handling and process
 	// reaping appropriate for PID 1.
@@ -377,6 +448,17 @@ func (g *StandardGenerator) aptInstalls() (string, error) {
 		})
 	}
 
+	if g.lock != nil {
+		// The Debian and Ubuntu mirrors drop old versions of packages after
+		// security updates, so the locked versions aren't installed by version.
+		// The versions apt would install are checked before the build instead.
+		for _, pkg := range packages {
+			if _, ok := g.lock.SystemPackage(pkg); !ok {
+				return "", fmt.Errorf("System package %s is not in %s, run `cog lock` to update it", pkg, config.LockFilename)
+			}
+		}
+	}
+
 	return "RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy " +
 		strings.Join(packages, " ") +
 		" && rm -rf /var/lib/apt/lists/*", nil
@@ -448,14 +530,14 @@ func (g *StandardGenerator) installCog() (string, error) {
 		if !CheckMajorMinorOnly(g.Config.Build.PythonVersion) {
 			return "", fmt.Errorf("Python version must be <major>.<minor>")
 		}
-		m, err := NewMonobaseMatrix(http.DefaultClient)
+		cogletURL, err := g.CogWheel()
 		if err != nil {
 			return "", err
 		}
 		cmds := []string{
 			"ENV R8_COG_VERSION=coglet",
 			"ENV R8_PYTHON_VERSION=" + g.Config.Build.PythonVersion,
-			"RUN pip install " + m.LatestCoglet.URL,
+			"RUN pip install " + cogletURL,
 		}
 		return strings.Join(cmds, "\n"), nil
 	}
@@ -469,6 +551,9 @@ func (g *StandardGenerator) installCog() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if g.lock != nil && g.lock.CogWheel != cogWheelName(filename, data) {
+		return "", fmt.Errorf("%s was written for cog wheel %s, but this version of Cog installs %s, run `cog lock` to update it", config.LockFilename, g.lock.CogWheel, cogWheelName(filename, data))
+	}
 	lines, containerPath, err := g.writeTemp(filename, data)
 	if err != nil {
 		return "", err
@@ -483,6 +568,37 @@ func (g *StandardGenerator) installCog() (string, error) {
 	return strings.Join(lines, "\n"), nil
 }
 
+// CogWheel returns the cog wheel installed in the image: the URL of the
+// coglet wheel for cog_runtime, or the filename and hash of the cog wheel
+// embedded in this binary. It is empty if cog isn't installed.
+func (g *StandardGenerator) CogWheel() (string, error) {
+	if g.Config.ContainsCoglet() || !g.requiresCog {
+		return "", nil
+	}
+	if g.Config.Build.CogRuntime {
+		if g.lock != nil {
+			return g.lock.CogWheel, nil
+		}
+		m, err := NewMonobaseMatrix(http.DefaultClient)
+		if err != nil {
+			return "", err
+		}
+		return m.LatestCoglet.URL, nil
+	}
+	data, filename, err := ReadWheelFile()
+	if err != nil {
+		return "", err
+	}
+	return cogWheelName(filename, data), nil
+}
+
+// cogWheelName returns the filename of a wheel with its hash, like
+// cog-0.14.0-py3-none-any.whl#sha256=...
+func cogWheelName(filename string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return filename + "#sha256=" + hex.EncodeToString(sum[:])
+}
+
 func (g *StandardGenerator) pipInstalls() (string, error) {
 	var err error
 	includePackages := []string{}
@@ -502,6 +618,9 @@ func (g *StandardGenerator) pipInstalls() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if g.lock != nil {
+		g.pythonRequirementsContents = lockedPythonRequirements(g.pythonRequirementsContents, g.lock)
+	}
 
 	if strings.Trim(g.pythonRequirementsContents, "") == "" {
 		return "", nil
@@ -525,6 +644,21 @@ func (g *StandardGenerator) pipInstalls() (string, error) {
 	}, "\n"), nil
 }
 
+// lockedPythonRequirements replaces the packages in requirements with the
+// locked packages, keeping the options for where packages are found.
+func lockedPythonRequirements(requirements string, lock *config.Lock) string {
+	lines := []string{}
+	for _, line := range strings.Split(requirements, "\n") {
+		if strings.HasPrefix(line, "--find-links ") || strings.HasPrefix(line, "--extra-index-url ") {
+			lines = append(lines, line)
+		}
+	}
+	if locked := lock.PythonRequirements(); locked != "" {
+		lines = append(lines, locked)
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (g *StandardGenerator) runCommands() (string, error) {
 	runCommands := g.Config.Build.Run
 
@@ -646,6 +780,14 @@ func (g *StandardGenerator) determineBaseImageName(ctx context.Context) (string,
 		return "", err
 	}
 	baseImage := BaseImageName(imageGenerator.cudaVersion, imageGenerator.pythonVersion, imageGenerator.torchVersion)
+
+	// Cog base images may not be built for every platform
+	platform := registry.Platform{OS: g.GOOS, Architecture: g.GOARCH}
+	if platform != registry.DefaultPlatform {
+		if _, err := g.client.Inspect(ctx, baseImage, &platform); err != nil {
+			return "", fmt.Errorf("Cog base image %s is not available for %s: %w", baseImage, platform, err)
+		}
+	}
 	return baseImage, nil
 }
 
@@ -12,6 +12,7 @@ import (
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker/dockertest"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/registry/registrytest"
 )
 
@@ -461,6 +462,8 @@ checkpoints/**/*
 models
 models/**/*
 root-large
+.cog/predictions
+.cog.env
 `
 	require.Equal(t, expected, dockerignore)
 }
@@ -500,6 +503,89 @@ COPY . /src`
 	require.Equal(t, expected, actual)
 }
 
+func TestGenerateDockerfileForARM(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.12"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	command := dockertest.NewMockCommand()
+	client := registrytest.NewMockRegistryClient()
+	// The Cog base image isn't built for arm64, so the python image is used instead
+	client.AddMockImageForPlatforms(BaseImageName("", "3.12", ""), registry.DefaultPlatform)
+	gen, err := NewStandardGenerator(conf, tmpDir, command, client, true)
+	require.NoError(t, err)
+	gen.SetPlatform(registry.Platform{OS: "linux", Architecture: "arm64"})
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.NoError(t, err)
+
+	expected := `#syntax=docker/dockerfile:1.4
+FROM python:3.12-slim
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/aarch64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+ENV NVIDIA_DRIVER_CAPABILITIES=all
+` + testTini() + testInstallCog(gen.relativeTmpDir, gen.strip) + `
+RUN find / -type f -name "*python*.so" -printf "%h\n" | sort -u > /etc/ld.so.conf.d/cog.conf && ldconfig
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+
+	require.Equal(t, expected, actual)
+}
+
+func TestGenerateDockerfileForARMWithCogBaseImage(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.12"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	command := dockertest.NewMockCommand()
+	client := registrytest.NewMockRegistryClient()
+	arm64 := registry.Platform{OS: "linux", Architecture: "arm64"}
+	client.AddMockImageForPlatforms(BaseImageName("", "3.12", ""), registry.DefaultPlatform, arm64)
+	gen, err := NewStandardGenerator(conf, tmpDir, command, client, true)
+	require.NoError(t, err)
+	gen.SetPlatform(arm64)
+	baseImage, err := gen.BaseImage(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/cog-base:python3.12", baseImage)
+}
+
+func TestGenerateDockerfileForUnsupportedPlatform(t *testing.T) {
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  python_version: "3.12"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	command := dockertest.NewMockCommand()
+	client := registrytest.NewMockRegistryClient()
+	gen, err := NewStandardGenerator(conf, t.TempDir(), command, client, true)
+	require.NoError(t, err)
+
+	gen.SetPlatform(registry.Platform{OS: "linux", Architecture: "arm64"})
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.ErrorContains(t, err, "Models that use a GPU can only be built for linux/amd64, not linux/arm64")
+
+	gen.SetPlatform(registry.Platform{OS: "linux", Architecture: "s390x"})
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.ErrorContains(t, err, "Cog can't build images for linux/s390x")
+}
+
 func TestGenerateEmptyCPUWithCogBaseImage(t *testing.T) {
 	tmpDir := t.TempDir()
 	conf, err := config.FromYAML([]byte(`
@@ -898,3 +984,88 @@ torch==2.3.1
 pandas==2.0.3
 coglet @ https://github.com/replicate/cog-runtime/releases/download/v0.1.0-alpha31/coglet-0.1.0a31-py3-none-any.whl`, string(requirements))
 }
+
+func TestGenerateWithLock(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.12"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - torch==2.3.0
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	command := dockertest.NewMockCommand()
+	client := registrytest.NewMockRegistryClient()
+	gen, err := NewStandardGenerator(conf, tmpDir, command, client, true)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	cogWheel, err := gen.CogWheel()
+	require.NoError(t, err)
+	gen.SetLock(&config.Lock{
+		CogWheel:       cogWheel,
+		BaseImage:      config.LockedImage{Name: "python:3.12-slim", Digest: "sha256:abc"},
+		SystemPackages: []config.LockedSystemPackage{{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"}},
+		PythonPackages: []config.LockedPythonPackage{
+			{Name: "torch", Version: "2.3.0+cpu"},
+			{Name: "numpy", Version: "2.1.0"},
+		},
+	})
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "\nFROM python:3.12-slim@sha256:abc\n")
+	require.Contains(t, actual, "apt-get install -qqy ffmpeg &&")
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, `--extra-index-url https://download.pytorch.org/whl/cpu
+torch==2.3.0+cpu
+numpy==2.1.0`, string(requirements))
+}
+
+func TestGenerateWithLockDrift(t *testing.T) {
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.12"
+  system_packages:
+    - ffmpeg
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	newGenerator := func(lock *config.Lock) *StandardGenerator {
+		gen, err := NewStandardGenerator(conf, t.TempDir(), dockertest.NewMockCommand(), registrytest.NewMockRegistryClient(), true)
+		require.NoError(t, err)
+		gen.SetUseCogBaseImage(false)
+		cogWheel, err := gen.CogWheel()
+		require.NoError(t, err)
+		if lock.CogWheel == "" {
+			lock.CogWheel = cogWheel
+		}
+		gen.SetLock(lock)
+		return gen
+	}
+
+	gen := newGenerator(&config.Lock{BaseImage: config.LockedImage{Name: "python:3.11-slim", Digest: "sha256:abc"}})
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.ErrorContains(t, err, "cog.lock was written for base image python:3.11-slim, but the build now uses python:3.12-slim")
+
+	gen = newGenerator(&config.Lock{BaseImage: config.LockedImage{Name: "python:3.12-slim", Digest: "sha256:abc"}})
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.ErrorContains(t, err, "System package ffmpeg is not in cog.lock")
+
+	gen = newGenerator(&config.Lock{
+		CogWheel:       "cog-0.0.1-py3-none-any.whl#sha256=abc",
+		BaseImage:      config.LockedImage{Name: "python:3.12-slim", Digest: "sha256:abc"},
+		SystemPackages: []config.LockedSystemPackage{{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"}},
+	})
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights(t.Context())
+	require.ErrorContains(t, err, "cog.lock was written for cog wheel cog-0.0.1-py3-none-any.whl#sha256=abc")
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/replicate/cog/pkg/config"
@@ -57,10 +58,27 @@ func Build(
 	localImage bool,
 	dockerCommand command.Command,
 	client registry.Client,
-	pipelinesImage bool) error {
+	pipelinesImage bool,
+	platform registry.Platform,
+	output *command.ImageBuildOutput,
+	lock *config.Lock) error {
 	console.Infof("Building Docker image from environment in cog.yaml as %s...", imageName)
 	if fastFlag {
 		console.Info("Fast build enabled.")
+		if platform != registry.DefaultPlatform {
+			return fmt.Errorf("Fast builds can only be built for %s", registry.DefaultPlatform)
+		}
+	}
+	if lock != nil {
+		if dockerfileFile != "" || fastFlag {
+			return fmt.Errorf("%s can't be used with --dockerfile or fast builds", config.LockFilename)
+		}
+		if lock.Platform != platform.String() {
+			return fmt.Errorf("%s was written for %s, but the image is built for %s, run `cog lock --platform %s` to update it", config.LockFilename, lock.Platform, platform, platform)
+		}
+		if err := checkLockedSystemPackages(ctx, dockerCommand, lock, cfg.Build.SystemPackages, platform); err != nil {
+			return err
+		}
 	}
 
 	if pipelinesImage {
@@ -98,8 +116,13 @@ func Build(
 			ProgressOutput:     progressOutput,
 			Epoch:              &config.BuildSourceEpochTimestamp,
 			ContextDir:         dockercontext.StandardBuildDirectory,
+			Platform:           platform.String(),
+			CacheFrom:          config.BuildCacheFrom,
+			CacheTo:            config.BuildCacheTo,
 		}
-		if err := dockerCommand.ImageBuild(ctx, buildOpts); err != nil {
+		if err := buildWithoutExcludedProjectFiles(func() error {
+			return dockerCommand.ImageBuild(ctx, buildOpts)
+		}); err != nil {
 			return fmt.Errorf("Failed to build Docker image: %w", err)
 		}
 	} else {
@@ -122,10 +145,14 @@ func Build(
 		}()
 		generator.SetStrip(strip)
 		generator.SetPrecompile(precompile)
+		generator.SetPlatform(platform)
 		generator.SetUseCudaBaseImage(useCudaBaseImage)
 		if useCogBaseImage != nil {
 			generator.SetUseCogBaseImage(*useCogBaseImage)
 		}
+		if lock != nil {
+			generator.SetLock(lock)
+		}
 
 		if generator.IsUsingCogBaseImage() {
 			cogBaseImageName, err = generator.BaseImage(ctx)
@@ -151,7 +178,7 @@ func Build(
 			cachedManifest, _ := weights.LoadManifest(weightsManifestPath)
 			changed := cachedManifest == nil || !weightsManifest.Equal(cachedManifest)
 			if changed {
-				if err := buildWeightsImage(ctx, dockerCommand, dir, weightsDockerfile, imageName+"-weights", secrets, noCache, progressOutput, contextDir, buildContexts); err != nil {
+				if err := buildWeightsImage(ctx, dockerCommand, dir, weightsDockerfile, imageName+"-weights", secrets, noCache, progressOutput, contextDir, buildContexts, platform); err != nil {
 					return fmt.Errorf("Failed to build model weights Docker image: %w", err)
 				}
 				err := weightsManifest.Save(weightsManifestPath)
@@ -162,7 +189,7 @@ func Build(
 				console.Info("Weights unchanged, skip rebuilding and use cached image...")
 			}
 
-			if err := buildRunnerImage(ctx, dockerCommand, dir, runnerDockerfile, dockerignore, imageName, secrets, noCache, progressOutput, contextDir, buildContexts); err != nil {
+			if err := buildRunnerImage(ctx, dockerCommand, dir, runnerDockerfile, dockerignore, imageName, secrets, noCache, progressOutput, contextDir, buildContexts, platform); err != nil {
 				return fmt.Errorf("Failed to build runner Docker image: %w", err)
 			}
 		} else {
@@ -181,9 +208,14 @@ func Build(
 				Epoch:              &config.BuildSourceEpochTimestamp,
 				ContextDir:         contextDir,
 				BuildContexts:      buildContexts,
+				Platform:           platform.String(),
+				CacheFrom:          config.BuildCacheFrom,
+				CacheTo:            config.BuildCacheTo,
 			}
 
-			if err := dockerCommand.ImageBuild(ctx, buildOpts); err != nil {
+			if err := buildWithoutExcludedProjectFiles(func() error {
+				return dockerCommand.ImageBuild(ctx, buildOpts)
+			}); err != nil {
 				return fmt.Errorf("Failed to build Docker image: %w", err)
 			}
 		}
@@ -200,7 +232,7 @@ func Build(
 		schemaJSON = data
 	} else {
 		console.Info("Validating model schema...")
-		schema, err := GenerateOpenAPISchema(ctx, dockerCommand, imageName, cfg.Build.GPU)
+		schema, err := GenerateOpenAPISchema(ctx, dockerCommand, imageName, cfg.Build.GPU, platform)
 		if err != nil {
 			return fmt.Errorf("Failed to get type signature: %w", err)
 		}
@@ -239,12 +271,17 @@ func Build(
 		return fmt.Errorf("Failed to convert config to JSON: %w", err)
 	}
 
-	pipFreeze, err := GeneratePipFreeze(ctx, dockerCommand, imageName, fastFlag)
+	pipFreeze, err := GeneratePipFreeze(ctx, dockerCommand, imageName, fastFlag, platform)
 	if err != nil {
 		return fmt.Errorf("Failed to generate pip freeze from image: %w", err)
 	}
+	if lock != nil {
+		if err := lock.CheckPipFreeze(pipFreeze); err != nil {
+			return err
+		}
+	}
 
-	modelDependencies, err := GenerateModelDependencies(ctx, dockerCommand, imageName, cfg)
+	modelDependencies, err := GenerateModelDependencies(ctx, dockerCommand, imageName, cfg, platform)
 	if err != nil {
 		return fmt.Errorf("Failed to generate model dependencies from image: %w", err)
 	}
@@ -268,7 +305,7 @@ func Build(
 			return fmt.Errorf("Failed to parse cog base image reference: %w", err)
 		}
 
-		img, err := remote.Image(ref)
+		img, err := remote.Image(ref, remote.WithPlatform(v1.Platform{OS: platform.OS, Architecture: platform.Architecture, Variant: platform.Variant}))
 		if err != nil {
 			return fmt.Errorf("Failed to fetch cog base image: %w", err)
 		}
@@ -311,7 +348,7 @@ func Build(
 		labels[key] = val
 	}
 
-	if err := BuildAddLabelsAndSchemaToImage(ctx, dockerCommand, imageName, labels, bundledSchemaFile, progressOutput); err != nil {
+	if err := BuildAddLabelsAndSchemaToImage(ctx, dockerCommand, imageName, labels, bundledSchemaFile, progressOutput, platform, output); err != nil {
 		return fmt.Errorf("Failed to add labels to image: %w", err)
 	}
 	return nil
@@ -319,8 +356,9 @@ func Build(
 
 // BuildAddLabelsAndSchemaToImage builds a cog model with labels and schema.
 //
-// The new image is based on the provided image with the labels and schema file appended to it.
-func BuildAddLabelsAndSchemaToImage(ctx context.Context, dockerClient command.Command, image string, labels map[string]string, bundledSchemaFile string, progressOutput string) error {
+// The new image is based on the provided image with the labels and schema file appended to it,
+// and replaces it. If output is set, the new image is also exported to a tarball.
+func BuildAddLabelsAndSchemaToImage(ctx context.Context, dockerClient command.Command, image string, labels map[string]string, bundledSchemaFile string, progressOutput string, platform registry.Platform, output *command.ImageBuildOutput) error {
 	dockerfile := "FROM " + image + "\n"
 	dockerfile += "COPY " + bundledSchemaFile + " .cog\n"
 
@@ -329,8 +367,21 @@ func BuildAddLabelsAndSchemaToImage(ctx context.Context, dockerClient command.Co
 		ImageName:          image,
 		Labels:             labels,
 		ProgressOutput:     progressOutput,
+		Platform:           platform.String(),
+		// The image is already in the local image store, so it's labeled
+		// there rather than sent to a builder and back
+		EmbeddedBuilder: true,
+	}
+
+	if output != nil {
+		// Export the image before it is replaced, so the image in the local
+		// image store is then built from the cache of the export
+		exportOpts := buildOpts
+		exportOpts.Output = output
+		if err := dockerClient.ImageBuild(ctx, exportOpts); err != nil {
+			return fmt.Errorf("Failed to export image to %s: %w", output.Dest, err)
+		}
 	}
-
 	if err := dockerClient.ImageBuild(ctx, buildOpts); err != nil {
 		return fmt.Errorf("Failed to add labels and schema to image: %w", err)
 	}
@@ -439,7 +490,7 @@ func gitTag(ctx context.Context, dir string) (string, error) {
 	return "", fmt.Errorf("Failed to find ref name: %w", errGit)
 }
 
-func buildWeightsImage(ctx context.Context, dockerClient command.Command, dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string, contextDir string, buildContexts map[string]string) error {
+func buildWeightsImage(ctx context.Context, dockerClient command.Command, dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string, contextDir string, buildContexts map[string]string, platform registry.Platform) error {
 	if err := makeDockerignoreForWeightsImage(); err != nil {
 		return fmt.Errorf("Failed to create .dockerignore file: %w", err)
 	}
@@ -453,6 +504,7 @@ func buildWeightsImage(ctx context.Context, dockerClient command.Command, dir, d
 		Epoch:              &config.BuildSourceEpochTimestamp,
 		ContextDir:         contextDir,
 		BuildContexts:      buildContexts,
+		Platform:           platform.String(),
 	}
 	if err := dockerClient.ImageBuild(ctx, buildOpts); err != nil {
 		return fmt.Errorf("Failed to build Docker image for model weights: %w", err)
@@ -460,7 +512,7 @@ func buildWeightsImage(ctx context.Context, dockerClient command.Command, dir, d
 	return nil
 }
 
-func buildRunnerImage(ctx context.Context, dockerClient command.Command, dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string, contextDir string, buildContexts map[string]string) error {
+func buildRunnerImage(ctx context.Context, dockerClient command.Command, dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string, contextDir string, buildContexts map[string]string, platform registry.Platform) error {
 	if err := writeDockerignore(dockerignoreContents); err != nil {
 		return fmt.Errorf("Failed to write .dockerignore file with weights included: %w", err)
 	}
@@ -474,6 +526,10 @@ func buildRunnerImage(ctx context.Context, dockerClient command.Command, dir, do
 		Epoch:              &config.BuildSourceEpochTimestamp,
 		ContextDir:         contextDir,
 		BuildContexts:      buildContexts,
+		Platform:           platform.String(),
+		LocalImages:        []string{imageName + "-weights"},
+		CacheFrom:          config.BuildCacheFrom,
+		CacheTo:            config.BuildCacheTo,
 	}
 	if err := dockerClient.ImageBuild(ctx, buildOpts); err != nil {
 		return fmt.Errorf("Failed to build Docker image: %w", err)
@@ -484,6 +540,22 @@ func buildRunnerImage(ctx context.Context, dockerClient command.Command, dir, do
 	return nil
 }
 
+// buildWithoutExcludedProjectFiles runs build with .dockerignore extended to
+// exclude dockerfile.ExcludedProjectFiles, and restores it afterwards.
+func buildWithoutExcludedProjectFiles(build func() error) error {
+	if err := backupDockerignore(); err != nil {
+		return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
+	}
+	if err := writeDockerignore(dockerfile.DockerignoreExcludedProjectFiles()); err != nil {
+		return fmt.Errorf("Failed to write .dockerignore file: %w", err)
+	}
+	buildErr := build()
+	if err := restoreDockerignore(); err != nil {
+		return errors.Join(buildErr, fmt.Errorf("Failed to restore backup .dockerignore file: %w", err))
+	}
+	return buildErr
+}
+
 func makeDockerignoreForWeightsImage() error {
 	if err := backupDockerignore(); err != nil {
 		return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
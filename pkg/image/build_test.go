@@ -2,6 +2,7 @@ package image
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -117,3 +118,23 @@ func TestGitTag(t *testing.T) {
 		require.Equal(t, "", tag)
 	})
 }
+
+func TestBuildWithoutExcludedProjectFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(".dockerignore", []byte("data\n"), 0o644))
+
+	err := buildWithoutExcludedProjectFiles(func() error {
+		contents, err := os.ReadFile(".dockerignore")
+		require.NoError(t, err)
+		require.Equal(t, "data\n\n.cog/predictions\n.cog.env\n", string(contents))
+		return errors.New("build failed")
+	})
+	require.ErrorContains(t, err, "build failed")
+
+	// The .dockerignore of the project is restored even if the build fails
+	contents, err := os.ReadFile(".dockerignore")
+	require.NoError(t, err)
+	require.Equal(t, "data\n", string(contents))
+	_, err = os.Stat(dockerignoreBackupPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,271 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// pypiURL is the base URL of the PyPI JSON API, which hashes of Python
+// packages are looked up in
+var pypiURL = "https://pypi.org/pypi"
+
+// Lock resolves the build environment of a model, by building its base image
+// and recording what was installed in it.
+func Lock(ctx context.Context, dockerClient command.Command, cfg *config.Config, dir string, useCudaBaseImage string, useCogBaseImage *bool, progressOutput string, client registry.Client, platform registry.Platform) (*config.Lock, error) {
+	configHash, err := cfg.LockHash()
+	if err != nil {
+		return nil, err
+	}
+
+	generator, err := dockerfile.NewStandardGenerator(cfg, dir, dockerClient, client, true)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	generator.SetPlatform(platform)
+	generator.SetUseCudaBaseImage(useCudaBaseImage)
+	if useCogBaseImage != nil {
+		generator.SetUseCogBaseImage(*useCogBaseImage)
+	}
+
+	baseImage, err := generator.BaseImage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get base image name: %w", err)
+	}
+	baseImageDigest, err := imageDigest(ctx, baseImage)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve digest of base image %s: %w", baseImage, err)
+	}
+	cogWheel, err := generator.CogWheel()
+	if err != nil {
+		return nil, err
+	}
+
+	dockerfileContents, err := generator.GenerateModelBase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate Dockerfile: %w", err)
+	}
+	contextDir, err := generator.BuildDir()
+	if err != nil {
+		return nil, err
+	}
+	buildContexts, err := generator.BuildContexts()
+	if err != nil {
+		return nil, err
+	}
+	imageName := config.BaseDockerImageName(dir)
+	console.Info("Building Docker image from environment in cog.yaml...")
+	if err := dockerClient.ImageBuild(ctx, command.ImageBuildOptions{
+		WorkingDir:         dir,
+		DockerfileContents: dockerfileContents,
+		ImageName:          imageName,
+		ProgressOutput:     progressOutput,
+		Epoch:              &config.BuildSourceEpochTimestamp,
+		ContextDir:         contextDir,
+		BuildContexts:      buildContexts,
+		Platform:           platform.String(),
+	}); err != nil {
+		return nil, fmt.Errorf("Failed to build Docker image: %w", err)
+	}
+
+	console.Info("Resolving installed packages...")
+	systemPackages, err := systemPackageVersions(ctx, dockerClient, imageName, platform)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get system package versions from image: %w", err)
+	}
+	pipFreeze, err := GeneratePipFreeze(ctx, dockerClient, imageName, false, platform)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate pip freeze from image: %w", err)
+	}
+	pythonPackages, err := config.ParsePipFreeze(pipFreeze)
+	if err != nil {
+		return nil, err
+	}
+	// Packages from other indexes may have the same versions as on PyPI, but
+	// different files, so hashes are only locked if everything is from PyPI
+	requirements, err := cfg.PythonRequirementsForArch(platform.OS, platform.Architecture, nil)
+	if err != nil {
+		return nil, err
+	}
+	onlyPyPI := !strings.Contains("\n"+requirements, "\n-")
+	for i, pkg := range pythonPackages {
+		if pkg.URL != "" || !onlyPyPI {
+			continue
+		}
+		pythonPackages[i].Hashes, err = pypiHashes(ctx, http.DefaultClient, pkg.Name, pkg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get hashes of %s: %w", pkg.Requirement(), err)
+		}
+	}
+
+	return &config.Lock{
+		Version:        config.LockVersion,
+		ConfigHash:     configHash,
+		CogVersion:     global.Version,
+		CogWheel:       cogWheel,
+		Platform:       platform.String(),
+		CUDA:           cfg.Build.CUDA,
+		CuDNN:          cfg.Build.CuDNN,
+		BaseImage:      config.LockedImage{Name: baseImage, Digest: baseImageDigest},
+		SystemPackages: systemPackages,
+		PythonPackages: pythonPackages,
+	}, nil
+}
+
+// imageDigest returns the digest the tag of an image points to in its
+// registry. For multi-platform images, this is the digest of the index.
+func imageDigest(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	desc, err := remote.Head(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest.String(), nil
+}
+
+// systemPackageVersions returns the versions of every system package installed
+// in an image, including the dependencies of the system packages in cog.yaml
+// and those that came with the base image.
+func systemPackageVersions(ctx context.Context, dockerClient command.Command, imageName string, platform registry.Platform) ([]config.LockedSystemPackage, error) {
+	var stdout, stderr bytes.Buffer
+	if err := docker.RunWithIO(ctx, dockerClient, command.RunOptions{
+		Image:    imageName,
+		Args:     []string{"dpkg-query", "--show", "--showformat=${Package}=${Version}\\n"},
+		Platform: platform.String(),
+	}, nil, &stdout, &stderr); err != nil {
+		console.Info(stderr.String())
+		return nil, err
+	}
+	return parseDpkgQuery(stdout.String()), nil
+}
+
+// checkLockedSystemPackages finds out which versions of the system packages
+// and their dependencies apt would install on the locked base image, and
+// returns an error if they aren't the locked ones. It runs before the model is
+// built, so a build that can't match the lock fails straight away.
+func checkLockedSystemPackages(ctx context.Context, dockerClient command.Command, lock *config.Lock, packages []string, platform registry.Platform) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	console.Infof("Checking system packages against %s...", config.LockFilename)
+	// The packages are passed as arguments of the script, so they aren't
+	// interpreted by the shell
+	args := append([]string{"sh", "-c", `apt-get update -qq && apt-get install --simulate -q "$@"`, "sh"}, packages...)
+	var stdout, stderr bytes.Buffer
+	if err := docker.RunWithIO(ctx, dockerClient, command.RunOptions{
+		Image:    lock.BaseImage.Reference(),
+		Args:     args,
+		Platform: platform.String(),
+	}, nil, &stdout, &stderr); err != nil {
+		console.Info(stderr.String())
+		return fmt.Errorf("Failed to resolve system packages: %w", err)
+	}
+	return lock.CheckSystemPackages(parseAptSimulation(stdout.String()))
+}
+
+// aptSimulationInstallRegexp matches the packages apt-get install --simulate
+// would install or upgrade, like "Inst libc6 [2.36-9] (2.36-9+deb12u4 ...".
+var aptSimulationInstallRegexp = regexp.MustCompile(`^Inst (\S+) (?:\[\S+\] )?\((\S+) `)
+
+// parseAptSimulation parses the packages and versions apt-get install
+// --simulate would install.
+func parseAptSimulation(output string) []config.LockedSystemPackage {
+	packages := []config.LockedSystemPackage{}
+	for _, line := range strings.Split(output, "\n") {
+		match := aptSimulationInstallRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		name, _, _ := strings.Cut(match[1], ":")
+		packages = append(packages, config.LockedSystemPackage{Name: name, Version: match[2]})
+	}
+	return packages
+}
+
+// parseDpkgQuery parses lines of package=version from dpkg-query. Packages
+// installed for more than one architecture are only listed once.
+func parseDpkgQuery(output string) []config.LockedSystemPackage {
+	versions := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		name, version, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && name != "" {
+			versions[name] = version
+		}
+	}
+
+	packages := []config.LockedSystemPackage{}
+	for name, version := range versions {
+		packages = append(packages, config.LockedSystemPackage{Name: name, Version: version})
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+	return packages
+}
+
+// pypiHashes returns the sha256 hashes of the files of a release of a Python
+// package on PyPI. Packages that aren't on PyPI, like those installed from
+// other indexes, have no hashes.
+func pypiHashes(ctx context.Context, client *http.Client, packageName string, version string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pypiURL+"/"+url.PathEscape(packageName)+"/"+url.PathEscape(version)+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PyPI returned status %s", resp.Status)
+	}
+
+	var release struct {
+		URLs []struct {
+			Digests struct {
+				SHA256 string `json:"sha256"`
+			} `json:"digests"`
+		} `json:"urls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("Failed to parse PyPI response: %w", err)
+	}
+	hashes := []string{}
+	for _, file := range release.URLs {
+		if file.Digests.SHA256 != "" {
+			hashes = append(hashes, "sha256:"+file.Digests.SHA256)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
@@ -0,0 +1,67 @@
+package image
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestParseDpkgQuery(t *testing.T) {
+	packages := parseDpkgQuery("ffmpeg=7:5.1.6-0+deb12u1\nlibgl1=1.6.0-1\nlibgl1=1.6.0-1\n\n")
+	require.Equal(t, []config.LockedSystemPackage{
+		{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "libgl1", Version: "1.6.0-1"},
+	}, packages)
+}
+
+func TestParseAptSimulation(t *testing.T) {
+	packages := parseAptSimulation(`Reading package lists...
+The following NEW packages will be installed:
+  ffmpeg libavcodec59
+Inst libc6 [2.36-9] (2.36-9+deb12u9 Debian:12.9/stable [amd64])
+Inst libavcodec59 (7:5.1.6-0+deb12u1 Debian:12.9/stable, Debian-Security:12/stable-security [amd64])
+Inst ffmpeg (7:5.1.6-0+deb12u1 Debian:12.9/stable [amd64])
+Conf libc6 (2.36-9+deb12u9 Debian:12.9/stable [amd64])
+Conf ffmpeg (7:5.1.6-0+deb12u1 Debian:12.9/stable [amd64])
+`)
+	require.Equal(t, []config.LockedSystemPackage{
+		{Name: "libc6", Version: "2.36-9+deb12u9"},
+		{Name: "libavcodec59", Version: "7:5.1.6-0+deb12u1"},
+		{Name: "ffmpeg", Version: "7:5.1.6-0+deb12u1"},
+	}, packages)
+}
+
+func TestPyPIHashes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flask/3.0.0/json":
+			_, _ = w.Write([]byte(`{"urls": [
+				{"filename": "flask-3.0.0.tar.gz", "digests": {"md5": "abc", "sha256": "bbb"}},
+				{"filename": "flask-3.0.0-py3-none-any.whl", "digests": {"md5": "def", "sha256": "aaa"}}
+			]}`))
+		case "/torch/2.3.0+cpu/json":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	oldPyPIURL := pypiURL
+	pypiURL = server.URL
+	t.Cleanup(func() { pypiURL = oldPyPIURL })
+
+	hashes, err := pypiHashes(t.Context(), server.Client(), "flask", "3.0.0")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sha256:aaa", "sha256:bbb"}, hashes)
+
+	hashes, err = pypiHashes(t.Context(), server.Client(), "torch", "2.3.0+cpu")
+	require.NoError(t, err)
+	require.Empty(t, hashes)
+
+	_, err = pypiHashes(t.Context(), server.Client(), "numpy", "2.1.0")
+	require.ErrorContains(t, err, "PyPI returned status 500")
+}
@@ -10,10 +10,11 @@ import (
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func GenerateModelDependencies(ctx context.Context, dockerClient command.Command, imageName string, cfg *config.Config) (string, error) {
+func GenerateModelDependencies(ctx context.Context, dockerClient command.Command, imageName string, cfg *config.Config, platform registry.Platform) (string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
@@ -21,8 +22,9 @@ func GenerateModelDependencies(ctx context.Context, dockerClient command.Command
 
 	args := []string{"python", "-m", "cog.command.call_graph", filepath.Join("/src", stubComponents[0])}
 	err := docker.RunWithIO(ctx, dockerClient, command.RunOptions{
-		Image: imageName,
-		Args:  args,
+		Image:    imageName,
+		Args:     args,
+		Platform: platform.String(),
 	}, nil, &stdout, &stderr)
 
 	if err != nil {
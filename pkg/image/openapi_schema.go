@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/getkin/kin-openapi/openapi3"
 
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
 // GenerateOpenAPISchema by running the image and executing Cog
 // This will be run as part of the build process then added as a label to the image. It can be retrieved more efficiently with the label by using GetOpenAPISchema
-func GenerateOpenAPISchema(ctx context.Context, dockerClient command.Command, imageName string, enableGPU bool) (map[string]any, error) {
+func GenerateOpenAPISchema(ctx context.Context, dockerClient command.Command, imageName string, enableGPU bool, platform registry.Platform) (map[string]any, error) {
 	console.Debugf("=== image.GenerateOpenAPISchema %s", imageName)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -28,14 +33,15 @@ func GenerateOpenAPISchema(ctx context.Context, dockerClient command.Command, im
 		Args: []string{
 			"python", "-m", "cog.command.openapi_schema",
 		},
-		GPUs: gpus,
+		GPUs:     gpus,
+		Platform: platform.String(),
 	}, nil, &stdout, &stderr)
 
 	if enableGPU && err == docker.ErrMissingDeviceDriver {
 		console.Debug(stdout.String())
 		console.Debug(stderr.String())
 		console.Debug("Missing device driver, re-trying without GPU")
-		return GenerateOpenAPISchema(ctx, dockerClient, imageName, false)
+		return GenerateOpenAPISchema(ctx, dockerClient, imageName, false, platform)
 	}
 
 	if err != nil {
@@ -54,19 +60,24 @@ func GenerateOpenAPISchema(ctx context.Context, dockerClient command.Command, im
 	return schema, nil
 }
 
-// // TODO[md]: this is unused, remove it
-// func GetOpenAPISchema(ctx context.Context, dockerClient command.Command, imageName string) (*openapi3.T, error) {
-// 	manifest, err := dockerClient.Inspect(ctx, imageName)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
-// 	}
-// 	schemaString := manifest.Config.Labels[command.CogOpenAPISchemaLabelKey]
-// 	if schemaString == "" {
-// 		// Deprecated. Remove for 1.0.
-// 		schemaString = manifest.Config.Labels["org.cogmodel.openapi_schema"]
-// 	}
-// 	if schemaString == "" {
-// 		return nil, fmt.Errorf("Image %s does not appear to be a Cog model", imageName)
-// 	}
-// 	return openapi3.NewLoader().LoadFromData([]byte(schemaString))
-// }
+// OpenAPISchemaFromManifest returns the OpenAPI schema in the labels of an
+// image, or nil if the image has none, like the base images models are run
+// from source on. It lets inputs be checked before the model is started.
+func OpenAPISchemaFromManifest(manifest *image.InspectResponse) (*openapi3.T, error) {
+	if manifest.Config == nil {
+		return nil, nil
+	}
+	schemaString := manifest.Config.Labels[command.CogOpenAPISchemaLabelKey]
+	if schemaString == "" {
+		// Deprecated. Remove for 1.0.
+		schemaString = manifest.Config.Labels["org.cogmodel.openapi_schema"]
+	}
+	if schemaString == "" {
+		return nil, nil
+	}
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(schemaString))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse OpenAPI schema from %s: %w", friendlyName(manifest), err)
+	}
+	return schema, nil
+}
@@ -0,0 +1,29 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestOpenAPISchemaFromManifest(t *testing.T) {
+	schema, err := OpenAPISchemaFromManifest(&image.InspectResponse{
+		Config: &container.Config{Labels: map[string]string{command.CogOpenAPISchemaLabelKey: dockertest.MockOpenAPISchema}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, schema)
+
+	schema, err = OpenAPISchemaFromManifest(&image.InspectResponse{Config: &container.Config{}})
+	require.NoError(t, err)
+	require.Nil(t, schema)
+
+	_, err = OpenAPISchemaFromManifest(&image.InspectResponse{
+		Config: &container.Config{Labels: map[string]string{command.CogOpenAPISchemaLabelKey: "not json"}},
+	})
+	require.Error(t, err)
+}
@@ -6,12 +6,13 @@ import (
 
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
 // GeneratePipFreeze by running a pip freeze on the image.
 // This will be run as part of the build process then added as a label to the image.
-func GeneratePipFreeze(ctx context.Context, dockerClient command.Command, imageName string, fastFlag bool) (string, error) {
+func GeneratePipFreeze(ctx context.Context, dockerClient command.Command, imageName string, fastFlag bool, platform registry.Platform) (string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
@@ -24,9 +25,10 @@ func GeneratePipFreeze(ctx context.Context, dockerClient command.Command, imageN
 		env = []string{"VIRTUAL_ENV=/root/.venv"}
 	}
 	err := docker.RunWithIO(ctx, dockerClient, command.RunOptions{
-		Image: imageName,
-		Args:  args,
-		Env:   env,
+		Image:    imageName,
+		Args:     args,
+		Env:      env,
+		Platform: platform.String(),
 	}, nil, &stdout, &stderr)
 
 	if err != nil {
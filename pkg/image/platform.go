@@ -0,0 +1,26 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/replicate/cog/pkg/registry"
+)
+
+// PlatformImageName returns the name of the image built for one platform of a
+// multi-platform build, which is imageName with the platform added to its
+// tag, like r8.im/user/model:latest-linux-arm64.
+func PlatformImageName(imageName string, platform registry.Platform) (string, error) {
+	tag, err := name.NewTag(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	repository := imageName
+	// A colon after the last slash separates the tag, rather than a registry port
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		repository = imageName[:i]
+	}
+	return repository + ":" + tag.TagStr() + "-" + strings.ReplaceAll(platform.String(), "/", "-"), nil
+}
@@ -0,0 +1,31 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/registry"
+)
+
+func TestPlatformImageName(t *testing.T) {
+	arm64 := registry.Platform{OS: "linux", Architecture: "arm64"}
+	for imageName, expected := range map[string]string{
+		"cog-hotdog":                 "cog-hotdog:latest-linux-arm64",
+		"r8.im/user/hotdog":          "r8.im/user/hotdog:latest-linux-arm64",
+		"r8.im/user/hotdog:v2":       "r8.im/user/hotdog:v2-linux-arm64",
+		"localhost:5000/hotdog":      "localhost:5000/hotdog:latest-linux-arm64",
+		"localhost:5000/hotdog:test": "localhost:5000/hotdog:test-linux-arm64",
+	} {
+		actual, err := PlatformImageName(imageName, arm64)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	actual, err := PlatformImageName("hotdog", registry.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+	require.NoError(t, err)
+	require.Equal(t, "hotdog:latest-linux-arm-v7", actual)
+
+	_, err = PlatformImageName("r8.im/user/hotdog@sha256:abc", arm64)
+	require.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package predict
+
+import (
+	"reflect"
+	"strings"
+)
+
+// eventTracker turns successive states of a prediction into events. Webhooks
+// carry the full prediction state rather than the event that caused them, so
+// events are derived by comparing each state to the previous one.
+type eventTracker struct {
+	onEvent func(Event)
+	started bool
+	logs    string
+	output  any
+}
+
+func (t *eventTracker) update(response *Response) {
+	if t.onEvent == nil {
+		return
+	}
+
+	if !t.started {
+		t.started = true
+		t.onEvent(Event{Type: EventStart, Response: response})
+	}
+
+	if response.Logs != t.logs {
+		t.onEvent(Event{Type: EventLogs, Response: response, Logs: strings.TrimPrefix(response.Logs, t.logs)})
+		t.logs = response.Logs
+	}
+
+	if response.Output != nil && !reflect.DeepEqual(*response.Output, t.output) {
+		event := Event{Type: EventOutput, Response: response}
+		// Iterator outputs grow by appending items
+		if items, ok := (*response.Output).([]any); ok {
+			previous, _ := t.output.([]any)
+			if len(items) > len(previous) && (len(previous) == 0 || reflect.DeepEqual(items[:len(previous)], previous)) {
+				event.NewOutput = append([]any{}, items[len(previous):]...)
+			}
+		}
+		t.output = *response.Output
+		t.onEvent(event)
+	}
+
+	if response.Status.Terminal() {
+		t.onEvent(Event{Type: EventCompleted, Response: response})
+	}
+}
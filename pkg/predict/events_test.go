@@ -0,0 +1,30 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTracker(t *testing.T) {
+	events := []Event{}
+	tracker := eventTracker{onEvent: func(e Event) { events = append(events, e) }}
+
+	output := func(v any) *any { return &v }
+
+	tracker.update(&Response{Status: "processing"})
+	tracker.update(&Response{Status: "processing", Logs: "loading\n"})
+	tracker.update(&Response{Status: "processing", Logs: "loading\ngenerating\n", Output: output([]any{"a"})})
+	tracker.update(&Response{Status: "processing", Logs: "loading\ngenerating\n", Output: output([]any{"a"})})
+	tracker.update(&Response{Status: "succeeded", Logs: "loading\ngenerating\n", Output: output([]any{"a", "b"})})
+
+	types := []EventType{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []EventType{EventStart, EventLogs, EventLogs, EventOutput, EventOutput, EventCompleted}, types)
+	require.Equal(t, "loading\n", events[1].Logs)
+	require.Equal(t, "generating\n", events[2].Logs)
+	require.Equal(t, []any{"a"}, events[3].NewOutput)
+	require.Equal(t, []any{"b"}, events[4].NewOutput)
+}
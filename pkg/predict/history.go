@@ -0,0 +1,390 @@
+package predict
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/go/uuid"
+
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+const (
+	recordFilename  = "record.json"
+	recordInputsDir = "inputs"
+	// Input files larger than this are hashed and referred to where they are,
+	// rather than copied into the history.
+	maxCopiedInputSize = 100 * 1024 * 1024
+)
+
+// Record is a prediction or training kept in the history of a project, with
+// everything needed to run it again.
+type Record struct {
+	ID        string `json:"id"`
+	IsTrain   bool   `json:"is_train,omitempty"`
+	Image     string `json:"image,omitempty"`
+	ImageID   string `json:"image_id,omitempty"`
+	ServerURL string `json:"server_url,omitempty"`
+	// SourceDir is mounted at /src when the image doesn't contain the model
+	SourceDir string `json:"source_dir,omitempty"`
+	GPUs      string `json:"gpus,omitempty"`
+	// Env is how the environment of the model was set. Env files are read
+	// again when the prediction is rerun, so their values aren't recorded.
+	Env *RecordEnv `json:"env,omitempty"`
+	// Inputs are the JSON values of the inputs, as they were sent. Files are
+	// @ followed by their path, relative to the record if they were copied
+	// into it.
+	Inputs map[string]json.RawMessage `json:"inputs"`
+	// InputFiles are the names of the inputs that are files, and of the
+	// items of array inputs that are files as name[index]
+	InputFiles []string `json:"input_files,omitempty"`
+	// InputHashes are the sha256 hashes of input files, by path
+	InputHashes map[string]string `json:"input_hashes,omitempty"`
+	Output      any               `json:"output,omitempty"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Metrics     map[string]any    `json:"metrics,omitempty"`
+	StartedAt   string            `json:"started_at,omitempty"`
+	CompletedAt string            `json:"completed_at,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	RerunOf     string            `json:"rerun_of,omitempty"`
+}
+
+// RecordEnv is the environment a prediction was run with, as it was passed
+// to cog predict or cog train.
+type RecordEnv struct {
+	// Vars are the variables passed with -e
+	Vars []string `json:"vars,omitempty"`
+	// Files are the absolute paths of the files passed with --env-file
+	Files     []string `json:"files,omitempty"`
+	NoEnvFile bool     `json:"no_env_file,omitempty"`
+}
+
+// SaveRecord saves a prediction to the history in dir, copying its input files
+// so it can be run again after they have changed. output is the output as it
+// was presented, with files replaced by the paths they were written to.
+func (p *Predictor) SaveRecord(ctx context.Context, dir string, inputs Inputs, response *Response, output any, env *RecordEnv, rerunOf string) (*Record, error) {
+	id := response.ID
+	if id == "" {
+		generated, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+		id = generated.String()
+	}
+
+	record := &Record{
+		ID:          id,
+		IsTrain:     p.isTrain,
+		Image:       p.runOptions.Image,
+		ServerURL:   p.serverURL,
+		GPUs:        p.runOptions.GPUs,
+		Env:         env,
+		Inputs:      map[string]json.RawMessage{},
+		InputHashes: map[string]string{},
+		Output:      output,
+		Status:      string(response.Status),
+		Error:       response.Error,
+		Metrics:     response.Metrics,
+		StartedAt:   response.StartedAt,
+		CompletedAt: response.CompletedAt,
+		CreatedAt:   time.Now().UTC(),
+		RerunOf:     rerunOf,
+	}
+	for _, volume := range p.runOptions.Volumes {
+		if volume.Destination == "/src" {
+			record.SourceDir = volume.Source
+		}
+	}
+	if p.dockerClient != nil && p.serverURL == "" {
+		image, err := p.dockerClient.Inspect(ctx, p.runOptions.Image)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to inspect image %q: %w", p.runOptions.Image, err)
+		}
+		record.ImageID = image.ID
+	}
+
+	recordDir := filepath.Join(dir, id)
+	if err := os.MkdirAll(recordDir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to save prediction: %w", err)
+	}
+
+	saveFile := func(name string, path string) (string, error) {
+		saved, hash, err := saveInputFile(recordDir, name, path)
+		if err != nil {
+			return "", fmt.Errorf("Failed to save input %s: %w", name, err)
+		}
+		record.InputHashes[saved] = hash
+		return "@" + saved, nil
+	}
+	for key, input := range inputs {
+		var value any
+		switch {
+		case input.File != nil:
+			saved, err := saveFile(key, *input.File)
+			if err != nil {
+				return nil, err
+			}
+			record.InputFiles = append(record.InputFiles, key)
+			value = saved
+		case input.Array != nil:
+			items := make([]any, len(*input.Array))
+			for i, item := range *input.Array {
+				items[i] = item
+				if str, ok := item.(string); ok && strings.HasPrefix(str, "@") {
+					saved, err := saveFile(key+"-"+strconv.Itoa(i), str[1:])
+					if err != nil {
+						return nil, err
+					}
+					record.InputFiles = append(record.InputFiles, arrayItemName(key, i))
+					items[i] = saved
+				}
+			}
+			value = items
+		case input.Json != nil:
+			if !json.Valid(*input.Json) {
+				return nil, fmt.Errorf("Failed to save input %s: invalid JSON", key)
+			}
+			value = *input.Json
+		case input.String != nil:
+			value = *input.String
+		default:
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to save input %s: %w", key, err)
+		}
+		record.Inputs[key] = data
+	}
+	sort.Strings(record.InputFiles)
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to save prediction: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(recordDir, recordFilename), data, 0o644); err != nil {
+		return nil, fmt.Errorf("Failed to save prediction: %w", err)
+	}
+	return record, nil
+}
+
+// saveInputFile copies the input file at path into recordDir, unless it is too
+// large, and returns the path it can be read from and its hash.
+func saveInputFile(recordDir string, name string, path string) (string, string, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	if info.Size() > maxCopiedInputSize {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", "", err
+		}
+		return absPath, hash, nil
+	}
+
+	saved := filepath.Join(recordInputsDir, name+"-"+filepath.Base(path))
+	if err := os.MkdirAll(filepath.Join(recordDir, recordInputsDir), 0o755); err != nil {
+		return "", "", err
+	}
+	if err := files.CopyFile(path, filepath.Join(recordDir, saved)); err != nil {
+		return "", "", err
+	}
+	return saved, hash, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ListRecords returns the records in the history in dir, newest first.
+func ListRecords(dir string) ([]*Record, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read prediction history: %w", err)
+	}
+
+	records := []*Record{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record, err := readRecord(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].ID > records[j].ID
+		}
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+// LoadRecord returns the record in the history in dir with the given ID, or the
+// only one whose ID starts with it.
+func LoadRecord(dir string, id string) (*Record, error) {
+	records, err := ListRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	var found *Record
+	for _, record := range records {
+		if record.ID == id {
+			return record, nil
+		}
+		if id != "" && strings.HasPrefix(record.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("Prediction ID %q is ambiguous, it matches %s and %s", id, found.ID, record.ID)
+			}
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("Prediction %q not found in %s", id, dir)
+	}
+	return found, nil
+}
+
+func readRecord(recordDir string) (*Record, error) {
+	data, err := os.ReadFile(filepath.Join(recordDir, recordFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read prediction history: %w", err)
+	}
+	record := &Record{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("Failed to read prediction %s: %w", filepath.Base(recordDir), err)
+	}
+	return record, nil
+}
+
+// RerunInputs returns the inputs of a record in the history in dir, checking
+// that its input files haven't changed.
+func (r *Record) RerunInputs(dir string) (Inputs, error) {
+	recordDir := filepath.Join(dir, r.ID)
+	resolve := func(value string) (string, error) {
+		path := strings.TrimPrefix(value, "@")
+		fullPath := path
+		if !filepath.IsAbs(fullPath) {
+			fullPath = filepath.Join(recordDir, path)
+		}
+		if expected, ok := r.InputHashes[path]; ok {
+			hash, err := hashFile(fullPath)
+			if err != nil {
+				return "", fmt.Errorf("Failed to read input file: %w", err)
+			}
+			if hash != expected {
+				return "", fmt.Errorf("Input file %s has changed since the prediction was run", fullPath)
+			}
+		}
+		return fullPath, nil
+	}
+
+	isFile := map[string]bool{}
+	for _, name := range r.InputFiles {
+		isFile[name] = true
+	}
+
+	inputs := Inputs{}
+	for key, value := range r.Inputs {
+		if isFile[key] {
+			var recorded string
+			if err := json.Unmarshal(value, &recorded); err != nil {
+				return nil, fmt.Errorf("Failed to read input %s: %w", key, err)
+			}
+			path, err := resolve(recorded)
+			if err != nil {
+				return nil, err
+			}
+			inputs[key] = Input{File: &path}
+			continue
+		}
+
+		var items []json.RawMessage
+		if json.Unmarshal(value, &items) != nil || !containsFileItem(isFile, key, len(items)) {
+			// Other values are sent exactly as they were recorded
+			raw := value
+			inputs[key] = Input{Json: &raw}
+			continue
+		}
+		array := make([]any, len(items))
+		for i, item := range items {
+			if isFile[arrayItemName(key, i)] {
+				var recorded string
+				if err := json.Unmarshal(item, &recorded); err != nil {
+					return nil, fmt.Errorf("Failed to read input %s: %w", key, err)
+				}
+				path, err := resolve(recorded)
+				if err != nil {
+					return nil, err
+				}
+				array[i] = "@" + path
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(item))
+			decoder.UseNumber()
+			if err := decoder.Decode(&array[i]); err != nil {
+				return nil, fmt.Errorf("Failed to read input %s: %w", key, err)
+			}
+		}
+		inputs[key] = Input{Array: &array}
+	}
+	return inputs, nil
+}
+
+func arrayItemName(key string, index int) string {
+	return fmt.Sprintf("%s[%d]", key, index)
+}
+
+func containsFileItem(isFile map[string]bool, key string, length int) bool {
+	for i := 0; i < length; i++ {
+		if isFile[arrayItemName(key, i)] {
+			return true
+		}
+	}
+	return false
+}
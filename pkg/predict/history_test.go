@@ -0,0 +1,132 @@
+package predict
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveRecord(t *testing.T) {
+	dir := t.TempDir()
+	historyDir := filepath.Join(dir, "predictions")
+	imagePath := filepath.Join(dir, "cat.png")
+	require.NoError(t, os.WriteFile(imagePath, []byte("cat"), 0o644))
+
+	prompt := "a cat"
+	steps := json.RawMessage(`50`)
+	masks := []any{"@" + imagePath, "plain"}
+	inputs := Inputs{
+		"image":  Input{File: &imagePath},
+		"prompt": Input{String: &prompt},
+		"steps":  Input{Json: &steps},
+		"masks":  Input{Array: &masks},
+	}
+	var output any = "output.png"
+	p := &Predictor{}
+
+	saved, err := p.SaveRecord(t.Context(), historyDir, inputs, &Response{ID: "0198-abc", Status: "succeeded", Metrics: map[string]any{"predict_time": 1.5}}, output, nil, "")
+	require.NoError(t, err)
+	require.Len(t, saved.Inputs, 4)
+	require.JSONEq(t, `"@inputs/image-cat.png"`, string(saved.Inputs["image"]))
+	require.JSONEq(t, `"a cat"`, string(saved.Inputs["prompt"]))
+	require.JSONEq(t, `50`, string(saved.Inputs["steps"]))
+	require.JSONEq(t, `["@inputs/masks-0-cat.png", "plain"]`, string(saved.Inputs["masks"]))
+	require.Equal(t, []string{"image", "masks[0]"}, saved.InputFiles)
+
+	// The original file can change, the record has its own copy
+	require.NoError(t, os.WriteFile(imagePath, []byte("dog"), 0o644))
+
+	record, err := LoadRecord(historyDir, "0198")
+	require.NoError(t, err)
+	require.Equal(t, "succeeded", record.Status)
+	require.Equal(t, "output.png", record.Output)
+
+	rerun, err := record.RerunInputs(historyDir)
+	require.NoError(t, err)
+	content, err := os.ReadFile(*rerun["image"].File)
+	require.NoError(t, err)
+	require.Equal(t, "cat", string(content))
+	require.JSONEq(t, `"a cat"`, string(*rerun["prompt"].Json))
+	require.JSONEq(t, "50", string(*rerun["steps"].Json))
+	masks = *rerun["masks"].Array
+	require.Len(t, masks, 2)
+	require.Equal(t, "@"+filepath.Join(historyDir, "0198-abc", "inputs", "masks-0-cat.png"), masks[0])
+	require.Equal(t, "plain", masks[1])
+
+	// Copies that have been tampered with are rejected
+	require.NoError(t, os.WriteFile(*rerun["image"].File, []byte("dog"), 0o644))
+	_, err = record.RerunInputs(historyDir)
+	require.ErrorContains(t, err, "has changed")
+}
+
+func TestRerunInputsKeepValuesExactly(t *testing.T) {
+	dir := t.TempDir()
+	historyDir := filepath.Join(dir, "predictions")
+	imagePath := filepath.Join(dir, "cat.png")
+	require.NoError(t, os.WriteFile(imagePath, []byte("cat"), 0o644))
+
+	seed := json.RawMessage(`9007199254740993`)
+	weights := json.RawMessage(`[0.1, 2, 12345678901234567]`)
+	boxes := json.RawMessage(`[{"x": 1, "y": 2.5}, {"x": 3, "y": 4}]`)
+	handle := "@someone"
+	images := []any{"@" + imagePath, int64(7), map[string]any{"crop": true}}
+	inputs := Inputs{
+		"seed":    Input{Json: &seed},
+		"weights": Input{Json: &weights},
+		"boxes":   Input{Json: &boxes},
+		"handle":  Input{String: &handle},
+		"images":  Input{Array: &images},
+	}
+	env := &RecordEnv{Vars: []string{"MODE=fast"}, Files: []string{"/tmp/model.env"}}
+	p := &Predictor{}
+
+	_, err := p.SaveRecord(t.Context(), historyDir, inputs, &Response{ID: "rerun", Status: "succeeded"}, nil, env, "")
+	require.NoError(t, err)
+	record, err := LoadRecord(historyDir, "rerun")
+	require.NoError(t, err)
+	require.Equal(t, env, record.Env)
+
+	rerun, err := record.RerunInputs(historyDir)
+	require.NoError(t, err)
+	require.Equal(t, "9007199254740993", string(*rerun["seed"].Json))
+	require.JSONEq(t, `[0.1, 2, 12345678901234567]`, string(*rerun["weights"].Json))
+	require.JSONEq(t, `[{"x": 1, "y": 2.5}, {"x": 3, "y": 4}]`, string(*rerun["boxes"].Json))
+	// Strings that start with @ are only files if they were recorded as files
+	require.Nil(t, rerun["handle"].File)
+	require.JSONEq(t, `"@someone"`, string(*rerun["handle"].Json))
+
+	values, err := rerun.toMap()
+	require.NoError(t, err)
+	data, err := json.Marshal(values["images"])
+	require.NoError(t, err)
+	require.JSONEq(t, `["data:image/png;base64,Y2F0", 7, {"crop": true}]`, string(data))
+}
+
+func TestLoadRecord(t *testing.T) {
+	historyDir := t.TempDir()
+	p := &Predictor{}
+	for _, id := range []string{"abc-1", "abc-2"} {
+		_, err := p.SaveRecord(t.Context(), historyDir, Inputs{}, &Response{ID: id, Status: "succeeded"}, nil, nil, "")
+		require.NoError(t, err)
+	}
+
+	records, err := ListRecords(historyDir)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "abc-2", records[0].ID)
+
+	_, err = LoadRecord(historyDir, "abc")
+	require.ErrorContains(t, err, "ambiguous")
+	_, err = LoadRecord(historyDir, "xyz")
+	require.ErrorContains(t, err, "not found")
+	record, err := LoadRecord(historyDir, "abc-1")
+	require.NoError(t, err)
+	require.Equal(t, "abc-1", record.ID)
+
+	records, err = ListRecords(filepath.Join(historyDir, "missing"))
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
@@ -114,7 +114,7 @@ func (inputs *Inputs) toMap() (map[string]any, error) {
 			keyVals[key] = dataURL
 		case input.Array != nil:
 			// Handle array, potentially containing file paths
-			dataURLs := make([]string, len(*input.Array))
+			items := make([]any, len(*input.Array))
 			for i, elem := range *input.Array {
 				if str, ok := elem.(string); ok && strings.HasPrefix(str, "@") {
 					filePath := str[1:] // Remove '@' prefix
@@ -122,13 +122,13 @@ func (inputs *Inputs) toMap() (map[string]any, error) {
 					if err != nil {
 						return keyVals, err
 					}
-					dataURLs[i] = dataURL
-				} else if ok {
-					// Directly use the string if it's not a file path
-					dataURLs[i] = str
+					items[i] = dataURL
+				} else {
+					// Directly use the value if it's not a file path
+					items[i] = elem
 				}
 			}
-			keyVals[key] = dataURLs
+			keyVals[key] = items
 		case input.Json != nil:
 			keyVals[key] = *input.Json
 		}
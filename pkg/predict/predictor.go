@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 
+	"github.com/replicate/go/uuid"
+
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/docker/command"
 	"github.com/replicate/cog/pkg/global"
@@ -20,6 +25,11 @@ import (
 
 type status string
 
+// Terminal returns true if the prediction has finished, successfully or not.
+func (s status) Terminal() bool {
+	return s == "succeeded" || s == "failed" || s == "canceled"
+}
+
 type HealthcheckResponse struct {
 	Status string `json:"status"`
 }
@@ -29,17 +39,51 @@ type RequestContext struct {
 }
 
 type Request struct {
+	ID string `json:"id,omitempty"`
 	// TODO: could this be Inputs?
 	Input   map[string]interface{} `json:"input"`
 	Context RequestContext         `json:"context"`
+	Webhook string                 `json:"webhook,omitempty"`
+	// OutputFilePrefix is the URL synchronous predictions upload output files to
+	OutputFilePrefix string `json:"output_file_prefix,omitempty"`
 }
 
 type Response struct {
+	ID     string       `json:"id,omitempty"`
 	Status status       `json:"status"`
 	Output *interface{} `json:"output"`
+	Logs   string       `json:"logs,omitempty"`
 	Error  string       `json:"error"`
+	// Metrics recorded by the server, such as predict_time in seconds
+	Metrics map[string]any `json:"metrics,omitempty"`
+	// Timestamps are passed through as the server formats them
+	StartedAt   string `json:"started_at,omitempty"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+type EventType string
+
+// These match the webhook events defined in python/cog/schema.py
+const (
+	EventStart     EventType = "start"
+	EventOutput    EventType = "output"
+	EventLogs      EventType = "logs"
+	EventCompleted EventType = "completed"
+)
+
+// Event is a change in the state of an asynchronous prediction.
+type Event struct {
+	Type     EventType
+	Response *Response
+	// Logs are the log lines produced since the previous event
+	Logs string
+	// NewOutput are the items an iterator output produced since the previous event
+	NewOutput []any
 }
 
+// ErrNoPrediction is returned by Cancel when no prediction is running.
+var ErrNoPrediction = errors.New("No prediction is running")
+
 type ValidationErrorResponse struct {
 	Detail []struct {
 		Location []string `json:"loc"`
@@ -52,13 +96,65 @@ type Predictor struct {
 	runOptions   command.RunOptions
 	isTrain      bool
 	dockerClient command.Command
+	async        bool
+	stream       bool
+	sessionPath  string
+	fileTransfer FileTransfer
+	// uploadOutputs has the model upload output files to the host
+	uploadOutputs bool
+	// serverURL is the address of a Cog server that was started elsewhere
+	serverURL string
+	// schema is the OpenAPI schema of the model, if it is known before the
+	// container is started
+	schema *openapi3.T
 
 	// Running state
 	containerID string
 	port        int
+	receiver    *webhookReceiver
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+type Option func(*Predictor)
+
+// WithAsync runs a webhook receiver next to the container, which is required
+// to run predictions with PredictAsync.
+func WithAsync() Option {
+	return func(p *Predictor) {
+		p.async = true
+	}
+}
+
+// WithStreaming is like WithAsync, but also has the server send a webhook for
+// every output item and log line as soon as it is produced.
+func WithStreaming() Option {
+	return func(p *Predictor) {
+		p.async = true
+		p.stream = true
+	}
+}
+
+// WithKeepWarm records the container in the session file at path, so it can
+// be left running after the predictor is done with it. The next predictor with
+// the same image and options reuses the container instead of starting a new one.
+func WithKeepWarm(path string) Option {
+	return func(p *Predictor) {
+		p.sessionPath = path
+	}
+}
+
+// WithSchema uses schema, like the one in the labels of the image, instead of
+// getting it from the running model. Inputs can then be validated before the
+// container is started.
+func WithSchema(schema *openapi3.T) Option {
+	return func(p *Predictor) {
+		p.schema = schema
+	}
 }
 
-func NewPredictor(ctx context.Context, runOptions command.RunOptions, isTrain bool, fastFlag bool, dockerCommand command.Command) (*Predictor, error) {
+func NewPredictor(ctx context.Context, runOptions command.RunOptions, isTrain bool, fastFlag bool, dockerCommand command.Command, opts ...Option) (*Predictor, error) {
 	if fastFlag {
 		console.Info("Fast predictor enabled.")
 	}
@@ -74,10 +170,27 @@ func NewPredictor(ctx context.Context, runOptions command.RunOptions, isTrain bo
 		return nil, err
 	}
 
-	return &Predictor{
+	p := &Predictor{
 		runOptions:   runOptions,
 		isTrain:      isTrain,
 		dockerClient: dockerCommand,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// NewRemotePredictor returns a predictor that runs predictions on a Cog server
+// that is already running at serverURL, instead of starting a container.
+func NewRemotePredictor(serverURL string, isTrain bool) (*Predictor, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Invalid server URL %q, expected a URL such as http://localhost:5000", serverURL)
+	}
+	return &Predictor{
+		isTrain:   isTrain,
+		serverURL: strings.TrimSuffix(serverURL, "/"),
 	}, nil
 }
 
@@ -85,6 +198,54 @@ func (p *Predictor) Start(ctx context.Context, logsWriter io.Writer, timeout tim
 	var err error
 	containerPort := 5000
 
+	if p.serverURL != "" {
+		if p.async || p.sessionPath != "" {
+			return fmt.Errorf("Asynchronous predictions and warm containers can't be used with a server URL")
+		}
+		return p.waitForContainerReady(ctx, timeout)
+	}
+
+	if p.async || p.servesFiles() || p.uploadsOutputs() {
+		p.receiver, err = newWebhookReceiver()
+		if err != nil {
+			return err
+		}
+		p.runOptions.ExtraHosts = append(p.runOptions.ExtraHosts, containerHostname+":host-gateway")
+	}
+
+	sessionKey := ""
+	if p.sessionPath != "" {
+		if p.async {
+			return fmt.Errorf("Warm containers can't be used with asynchronous predictions")
+		}
+		sessionKey, err = p.sessionKey(ctx)
+		if err != nil {
+			return err
+		}
+		resumed, err := p.resumeSession(ctx, sessionKey)
+		if err != nil {
+			return err
+		}
+		if resumed {
+			console.Infof("Reusing warm container %s", p.containerID)
+			return nil
+		}
+		if p.runOptions.Labels == nil {
+			p.runOptions.Labels = map[string]string{}
+		}
+		p.runOptions.Labels[command.CogSessionLabelKey] = sessionKey
+	}
+
+	if p.async && p.uploadsOutputs() {
+		// Files are only uploaded for asynchronous predictions, and only when the
+		// server is started with an upload URL.
+		p.runOptions.Args = serverArgs(p.runOptions.Args, "--upload-url", p.receiver.uploadURL())
+	}
+	if p.stream {
+		// Webhooks are throttled to one every 500ms by default
+		p.runOptions.Env = append(p.runOptions.Env, "COG_THROTTLE_RESPONSE_INTERVAL=0")
+	}
+
 	p.runOptions.Ports = append(p.runOptions.Ports, command.Port{HostPort: 0, ContainerPort: containerPort})
 
 	p.containerID, err = docker.RunDaemon(ctx, p.dockerClient, p.runOptions, logsWriter)
@@ -98,7 +259,7 @@ func (p *Predictor) Start(ctx context.Context, logsWriter io.Writer, timeout tim
 	}
 
 	go func() {
-		if err := p.dockerClient.ContainerLogs(ctx, p.containerID, logsWriter); err != nil {
+		if err := p.dockerClient.ContainerLogs(ctx, p.containerID, logsWriter, true); err != nil {
 			// if user hits ctrl-c we expect an error signal
 			if !strings.Contains(err.Error(), "signal: interrupt") {
 				console.Warnf("Error getting container logs: %s", err)
@@ -106,50 +267,34 @@ func (p *Predictor) Start(ctx context.Context, logsWriter io.Writer, timeout tim
 		}
 	}()
 
-	return p.waitForContainerReady(ctx, timeout)
+	if err := p.waitForContainerReady(ctx, timeout); err != nil {
+		return err
+	}
+
+	if p.sessionPath != "" {
+		return writeSession(p.sessionPath, &session{Key: sessionKey, ContainerID: p.containerID, Port: p.port})
+	}
+	return nil
 }
 
 func (p *Predictor) waitForContainerReady(ctx context.Context, timeout time.Duration) error {
-	url := fmt.Sprintf("http://localhost:%d/health-check", p.port)
-
 	start := time.Now()
+	busy := false
 	for {
-		if time.Since(start) > timeout {
+		if !busy && time.Since(start) > timeout {
 			return fmt.Errorf("Timed out")
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		time.Sleep(100 * time.Millisecond)
 
-		cont, err := p.dockerClient.ContainerInspect(ctx, p.containerID)
-		if err != nil {
-			return fmt.Errorf("Failed to get container status: %w", err)
-		}
-		if cont.State != nil && (cont.State.Status == "exited" || cont.State.Status == "dead") {
-			return fmt.Errorf("Container exited unexpectedly")
+		if err := p.checkContainerRunning(ctx); err != nil {
+			return err
 		}
 
-		healthcheck, err := func() (*HealthcheckResponse, error) {
-			ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
-			defer cancel()
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
-			}
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return nil, nil
-			}
-			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusOK {
-				return nil, nil
-			}
-			healthcheck := &HealthcheckResponse{}
-			if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
-				return nil, fmt.Errorf("Container healthcheck returned invalid response: %w", err)
-			}
-			return healthcheck, nil
-		}()
+		healthcheck, err := p.healthCheck(ctx)
 		if err != nil {
 			return err
 		}
@@ -165,43 +310,277 @@ func (p *Predictor) waitForContainerReady(ctx context.Context, timeout time.Dura
 			return fmt.Errorf("Model setup failed")
 		case "READY":
 			return nil
+		case "BUSY":
+			if p.serverURL == "" {
+				return fmt.Errorf("Container healthcheck returned unexpected status: %s", healthcheck.Status)
+			}
+			// A shared server may be running someone else's prediction. It has
+			// finished setup, so wait for the prediction without a timeout.
+			if !busy {
+				console.Info("Cog server is busy with another prediction, waiting for it to finish...")
+				busy = true
+			}
+			time.Sleep(400 * time.Millisecond)
+			continue
 		default:
 			return fmt.Errorf("Container healthcheck returned unexpected status: %s", healthcheck.Status)
 		}
 	}
 }
 
+// healthCheck returns the health of the Cog server, or nil if it isn't accepting requests yet.
+func (p *Predictor) healthCheck(ctx context.Context) (*HealthcheckResponse, error) {
+	url := p.baseURL() + "/health-check"
+
+	ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	healthcheck := &HealthcheckResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
+		return nil, fmt.Errorf("Container healthcheck returned invalid response: %w", err)
+	}
+	return healthcheck, nil
+}
+
+func (p *Predictor) checkContainerRunning(ctx context.Context) error {
+	if p.serverURL != "" {
+		// There is no container to check, requests to the server fail if it goes away
+		return nil
+	}
+	cont, err := p.dockerClient.ContainerInspect(ctx, p.containerID)
+	if err != nil {
+		return fmt.Errorf("Failed to get container status: %w", err)
+	}
+	if cont.State != nil && (cont.State.Status == "exited" || cont.State.Status == "dead") {
+		return fmt.Errorf("Container exited unexpectedly")
+	}
+	return nil
+}
+
 func (p *Predictor) Stop(ctx context.Context) error {
+	if p.receiver != nil {
+		if err := p.receiver.close(ctx); err != nil {
+			console.Debugf("Failed to stop webhook receiver: %s", err)
+		}
+	}
+	if p.serverURL != "" {
+		return nil
+	}
 	return p.dockerClient.ContainerStop(ctx, p.containerID)
 }
 
 func (p *Predictor) Predict(inputs Inputs, context RequestContext) (*Response, error) {
-	inputMap, err := inputs.toMap()
+	inputMap, release, err := p.requestInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	id, err := uuid.NewV7()
 	if err != nil {
 		return nil, err
 	}
 
 	request := Request{
+		ID:      id.String(),
 		Input:   inputMap,
 		Context: context,
 	}
+	if p.uploadsOutputs() {
+		// Upload output files to the host rather than returning them as data URLs
+		request.OutputFilePrefix = p.receiver.uploadURL() + request.ID + "/"
+	}
 	requestBody, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
 
-	url := p.url()
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBody))
+	// Create the prediction with a known ID so it can be canceled
+	url := p.url() + "/" + request.ID
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Close = true
 
+	defer p.track(request.ID)()
+
+	prediction, err := p.doRequest(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	if p.receiver != nil && prediction.Output != nil {
+		output := p.receiver.resolveUploads(*prediction.Output)
+		prediction.Output = &output
+	}
+	return prediction, nil
+}
+
+// Cancel cancels the running predictions. The calls that started them return
+// once the model has stopped, with a "canceled" status and any output produced
+// so far. It returns ErrNoPrediction if no prediction is running.
+func (p *Predictor) Cancel(ctx context.Context) error {
+	p.mu.Lock()
+	ids := make([]string, 0, len(p.running))
+	for id := range p.running {
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+
+	canceled := false
+	for _, id := range ids {
+		err := p.cancel(ctx, id)
+		if errors.Is(err, ErrNoPrediction) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		canceled = true
+	}
+	if !canceled {
+		return ErrNoPrediction
+	}
+	return nil
+}
+
+func (p *Predictor) cancel(ctx context.Context, id string) error {
+	url := p.url() + "/" + id + "/cancel"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to cancel prediction %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		// The prediction finished before it could be canceled
+		return ErrNoPrediction
+	default:
+		return fmt.Errorf("/%s/%s/cancel call returned status %d", p.endpoint(), id, resp.StatusCode)
+	}
+}
+
+// track records that prediction id is running until the returned function is called.
+func (p *Predictor) track(id string) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == nil {
+		p.running = map[string]bool{}
+	}
+	p.running[id] = true
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.running, id)
+	}
+}
+
+// PredictAsync submits a prediction with a webhook pointing back at the
+// predictor and calls onEvent as the prediction progresses. It returns the
+// final state of the prediction. The predictor must have been created with
+// WithAsync.
+func (p *Predictor) PredictAsync(ctx context.Context, inputs Inputs, requestContext RequestContext, onEvent func(Event)) (*Response, error) {
+	if p.receiver == nil {
+		return nil, fmt.Errorf("Predictor was not started with asynchronous predictions enabled")
+	}
+
+	inputMap, release, err := p.requestInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	request := Request{
+		ID:      id.String(),
+		Input:   inputMap,
+		Context: requestContext,
+		Webhook: p.receiver.webhookURL(id.String()),
+	}
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := p.receiver.subscribe(request.ID)
+	defer p.receiver.unsubscribe(request.ID)
+	defer p.track(request.ID)()
+
+	url := p.url() + "/" + request.ID
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", "respond-async")
+
+	prediction, err := p.doRequest(req, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Webhooks stop arriving if the container dies, so keep an eye on it
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	tracker := eventTracker{onEvent: func(event Event) {
+		for i, item := range event.NewOutput {
+			event.NewOutput[i] = p.receiver.resolveUploads(item)
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}}
+	tracker.update(prediction)
+	for !prediction.Status.Terminal() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			if err := p.checkContainerRunning(ctx); err != nil {
+				return nil, err
+			}
+		case prediction = <-updates:
+			tracker.update(prediction)
+		}
+	}
+
+	if prediction.Output != nil {
+		output := p.receiver.resolveUploads(*prediction.Output)
+		prediction.Output = &output
+	}
+	return prediction, nil
+}
+
+func (p *Predictor) doRequest(req *http.Request, expectedStatus int) (*Response, error) {
 	httpClient := &http.Client{}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
+		return nil, fmt.Errorf("Failed to %s HTTP request to %s: %w", req.Method, req.URL, err)
 	}
 	defer resp.Body.Close()
 
@@ -214,7 +593,7 @@ func (p *Predictor) Predict(inputs Inputs, context RequestContext) (*Response, e
 		return nil, p.buildInputValidationErrorMessage(errorResponse)
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != expectedStatus {
 		return nil, fmt.Errorf("/%s call returned status %d", p.endpoint(), resp.StatusCode)
 	}
 
@@ -226,7 +605,10 @@ func (p *Predictor) Predict(inputs Inputs, context RequestContext) (*Response, e
 }
 
 func (p *Predictor) GetSchema() (*openapi3.T, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
+	if p.schema != nil {
+		return p.schema, nil
+	}
+	resp, err := http.Get(p.baseURL() + "/openapi.json")
 	if err != nil {
 		return nil, err
 	}
@@ -241,6 +623,15 @@ func (p *Predictor) GetSchema() (*openapi3.T, error) {
 	return openapi3.NewLoader().LoadFromData(body)
 }
 
+// serverArgs returns the command that starts the Cog HTTP server with extra
+// arguments appended. args is the command already configured, if any.
+func serverArgs(args []string, extra ...string) []string {
+	if len(args) == 0 {
+		args = []string{"python", "-m", "cog.server.http"}
+	}
+	return append(args, extra...)
+}
+
 func (p *Predictor) endpoint() string {
 	if p.isTrain {
 		return "trainings"
@@ -248,8 +639,15 @@ func (p *Predictor) endpoint() string {
 	return "predictions"
 }
 
+func (p *Predictor) baseURL() string {
+	if p.serverURL != "" {
+		return p.serverURL
+	}
+	return fmt.Sprintf("http://localhost:%d", p.port)
+}
+
 func (p *Predictor) url() string {
-	return fmt.Sprintf("http://localhost:%d/%s", p.port, p.endpoint())
+	return p.baseURL() + "/" + p.endpoint()
 }
 
 func (p *Predictor) buildInputValidationErrorMessage(errorResponse *ValidationErrorResponse) error {
@@ -264,6 +662,10 @@ func (p *Predictor) buildInputValidationErrorMessage(errorResponse *ValidationEr
 		errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", validationError.Location[2], validationError.Message))
 	}
 
+	return p.inputValidationError(errorMessages)
+}
+
+func (p *Predictor) inputValidationError(errorMessages []string) error {
 	command := "predict"
 	if p.isTrain {
 		command = "train"
@@ -0,0 +1,141 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPredictor(t *testing.T, handler http.Handler) *Predictor {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Predictor{port: server.Listener.Addr().(*net.TCPAddr).Port}
+}
+
+func TestPredictorCancel(t *testing.T) {
+	canceled := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /predictions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		require.Equal(t, r.PathValue("id"), request.ID)
+
+		// Block until the prediction is canceled, like the Cog server does
+		id := <-canceled
+		require.Equal(t, request.ID, id)
+		require.NoError(t, json.NewEncoder(w).Encode(Response{ID: id, Status: "canceled"}))
+	})
+	mux.HandleFunc("POST /predictions/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		canceled <- r.PathValue("id")
+		w.WriteHeader(http.StatusOK)
+	})
+	p := newTestPredictor(t, mux)
+
+	require.ErrorIs(t, p.Cancel(context.Background()), ErrNoPrediction)
+
+	done := make(chan *Response)
+	go func() {
+		response, err := p.Predict(Inputs{}, RequestContext{})
+		require.NoError(t, err)
+		done <- response
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.Cancel(context.Background()) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	response := <-done
+	require.Equal(t, status("canceled"), response.Status)
+	require.ErrorIs(t, p.Cancel(context.Background()), ErrNoPrediction)
+}
+
+func TestPredictorCancelTraining(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /trainings/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	p := newTestPredictor(t, mux)
+	p.isTrain = true
+	p.track("abc")
+
+	require.ErrorIs(t, p.Cancel(context.Background()), ErrNoPrediction)
+}
+
+func TestRemotePredictor(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health-check", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "READY"}`))
+	})
+	mux.HandleFunc("PUT /predictions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(Response{ID: r.PathValue("id"), Status: "succeeded"}))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	p, err := NewRemotePredictor(server.URL+"/", false)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(context.Background(), nil, time.Second))
+
+	response, err := p.Predict(Inputs{}, RequestContext{})
+	require.NoError(t, err)
+	require.Equal(t, status("succeeded"), response.Status)
+	require.NoError(t, p.Stop(context.Background()))
+}
+
+func TestRemotePredictorWaitsWhileBusy(t *testing.T) {
+	var healthChecks atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health-check", func(w http.ResponseWriter, r *http.Request) {
+		// Busy for longer than the timeout, which only applies to setup
+		if healthChecks.Add(1) <= 3 {
+			_, _ = w.Write([]byte(`{"status": "BUSY"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "READY"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	p, err := NewRemotePredictor(server.URL, false)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(context.Background(), nil, 200*time.Millisecond))
+	require.Equal(t, int32(4), healthChecks.Load())
+}
+
+func TestRemotePredictorInvalidURL(t *testing.T) {
+	_, err := NewRemotePredictor("localhost:5000", false)
+	require.ErrorContains(t, err, "Invalid server URL")
+}
+
+func TestPredictorResponseMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /predictions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{
+			"id": %q,
+			"status": "succeeded",
+			"output": "hello",
+			"logs": "loading\n",
+			"metrics": {"predict_time": 1.5},
+			"started_at": "2025-01-02T03:04:05.000001+00:00",
+			"completed_at": "2025-01-02T03:04:06.500001+00:00"
+		}`, r.PathValue("id"))
+	})
+	p := newTestPredictor(t, mux)
+
+	response, err := p.Predict(Inputs{}, RequestContext{})
+	require.NoError(t, err)
+	require.NotEmpty(t, response.ID)
+	require.Equal(t, "loading\n", response.Logs)
+	require.Equal(t, map[string]any{"predict_time": 1.5}, response.Metrics)
+	require.Equal(t, "2025-01-02T03:04:05.000001+00:00", response.StartedAt)
+	require.Equal(t, "2025-01-02T03:04:06.500001+00:00", response.CompletedAt)
+}
@@ -0,0 +1,122 @@
+package predict
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// session is a container that is kept running between invocations of cog
+// predict, so later predictions don't have to wait for setup() again.
+type session struct {
+	// Key identifies the image and options the container was started with
+	Key         string `json:"key"`
+	ContainerID string `json:"container_id"`
+	Port        int    `json:"port"`
+}
+
+func readSession(path string) (*session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read session: %w", err)
+	}
+	s := &session{}
+	if err := json.Unmarshal(data, s); err != nil {
+		// A corrupt session is as good as no session
+		console.Debugf("Ignoring invalid session %s: %s", path, err)
+		return nil, nil
+	}
+	return s, nil
+}
+
+func writeSession(path string, s *session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to write session: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write session: %w", err)
+	}
+	return nil
+}
+
+// sessionKey returns a hash of the image digest and the options the container
+// is run with. A warm container is only reused if they are all the same.
+func (p *Predictor) sessionKey(ctx context.Context) (string, error) {
+	image, err := p.dockerClient.Inspect(ctx, p.runOptions.Image)
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect image %q: %w", p.runOptions.Image, err)
+	}
+
+	data, err := json.Marshal(struct {
+		ImageID    string           `json:"image_id"`
+		Args       []string         `json:"args"`
+		Env        []string         `json:"env"`
+		GPUs       string           `json:"gpus"`
+		Volumes    []command.Volume `json:"volumes"`
+		ExtraHosts []string         `json:"extra_hosts"`
+		IsTrain    bool             `json:"is_train"`
+	}{
+		ImageID:    image.ID,
+		Args:       p.runOptions.Args,
+		Env:        p.runOptions.Env,
+		GPUs:       p.runOptions.GPUs,
+		Volumes:    p.runOptions.Volumes,
+		ExtraHosts: p.runOptions.ExtraHosts,
+		IsTrain:    p.isTrain,
+	})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// resumeSession attaches the predictor to the container recorded in the session
+// file if it was started with key and is ready for predictions.
+func (p *Predictor) resumeSession(ctx context.Context, key string) (bool, error) {
+	s, err := readSession(p.sessionPath)
+	if err != nil || s == nil || s.Key != key {
+		return false, err
+	}
+
+	cont, err := p.dockerClient.ContainerInspect(ctx, s.ContainerID)
+	if err != nil {
+		var notFound *command.NotFoundError
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if cont.State == nil || !cont.State.Running || cont.Config == nil || cont.Config.Labels[command.CogSessionLabelKey] != key {
+		return false, nil
+	}
+
+	p.containerID = s.ContainerID
+	p.port = s.Port
+	healthcheck, err := p.healthCheck(ctx)
+	if err != nil {
+		return false, err
+	}
+	if healthcheck == nil || healthcheck.Status != "READY" {
+		console.Debugf("Not reusing container %s, its status is %v", s.ContainerID, healthcheck)
+		p.containerID = ""
+		p.port = 0
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,61 @@
+package predict
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker/command"
+	"github.com/replicate/cog/pkg/docker/dockertest"
+)
+
+func TestSessionKey(t *testing.T) {
+	dockerClient := dockertest.NewMockCommand2(t)
+	dockerClient.EXPECT().Inspect(context.Background(), "my-model").Return(&image.InspectResponse{ID: "sha256:abc"}, nil)
+
+	p := &Predictor{dockerClient: dockerClient, runOptions: command.RunOptions{Image: "my-model", Env: []string{"A=1"}}}
+	key, err := p.sessionKey(context.Background())
+	require.NoError(t, err)
+
+	p.runOptions.Env = []string{"A=2"}
+	otherKey, err := p.sessionKey(context.Background())
+	require.NoError(t, err)
+	require.NotEqual(t, key, otherKey)
+}
+
+func TestResumeSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/health-check", r.URL.Path)
+		_, _ = w.Write([]byte(`{"status": "READY"}`))
+	}))
+	t.Cleanup(server.Close)
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	sessionPath := filepath.Join(t.TempDir(), ".cog", "session.json")
+	require.NoError(t, writeSession(sessionPath, &session{Key: "key", ContainerID: "container", Port: port}))
+
+	dockerClient := dockertest.NewMockCommand2(t)
+	dockerClient.EXPECT().ContainerInspect(context.Background(), "container").Return(&container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{Running: true}},
+		Config:            &container.Config{Labels: map[string]string{command.CogSessionLabelKey: "key"}},
+	}, nil)
+
+	p := &Predictor{dockerClient: dockerClient, sessionPath: sessionPath}
+
+	resumed, err := p.resumeSession(context.Background(), "other-key")
+	require.NoError(t, err)
+	require.False(t, resumed)
+
+	resumed, err = p.resumeSession(context.Background(), "key")
+	require.NoError(t, err)
+	require.True(t, resumed)
+	require.Equal(t, "container", p.containerID)
+	require.Equal(t, port, p.port)
+}
@@ -0,0 +1,219 @@
+package predict
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// FileTransfer is how input files are sent to the model. Output files are
+// uploaded separately, see WithOutputUploads.
+type FileTransfer string
+
+const (
+	// FileTransferAuto serves files larger than largeFileSize over HTTP and
+	// sends smaller files as data URLs
+	FileTransferAuto FileTransfer = "auto"
+	// FileTransferDataURL sends all files as data URLs in the request body
+	FileTransferDataURL FileTransfer = "data-url"
+	// FileTransferHTTP serves all files over HTTP from the host
+	FileTransferHTTP FileTransfer = "http"
+)
+
+// largeFileSize is the size above which FileTransferAuto serves files over
+// HTTP. Data URLs are read into memory and grow by a third when encoded.
+const largeFileSize = 25 * 1024 * 1024
+
+// ParseFileTransfer returns the FileTransfer called s.
+func ParseFileTransfer(s string) (FileTransfer, error) {
+	switch mode := FileTransfer(s); mode {
+	case FileTransferAuto, FileTransferDataURL, FileTransferHTTP:
+		return mode, nil
+	}
+	return "", fmt.Errorf("Invalid file transfer mode %q, expected one of: %s, %s, %s", s, FileTransferAuto, FileTransferDataURL, FileTransferHTTP)
+}
+
+// WithFileTransfer sets how input files are sent to the model. Files are sent
+// as data URLs by default, and always for servers started elsewhere, which
+// can't reach the host.
+func WithFileTransfer(mode FileTransfer) Option {
+	return func(p *Predictor) {
+		p.fileTransfer = mode
+	}
+}
+
+// WithOutputUploads has the model upload output files to the host, where they
+// are moved to the output path, rather than return them as data URLs. Servers
+// started elsewhere always return data URLs, since they can't reach the host.
+func WithOutputUploads() Option {
+	return func(p *Predictor) {
+		p.uploadOutputs = true
+	}
+}
+
+func (p *Predictor) uploadsOutputs() bool {
+	return p.serverURL == "" && p.uploadOutputs
+}
+
+func (p *Predictor) servesFiles() bool {
+	return p.serverURL == "" && (p.fileTransfer == FileTransferAuto || p.fileTransfer == FileTransferHTTP)
+}
+
+// requestInputs returns inputs as they are sent in a request, serving the
+// input files that shouldn't be sent as data URLs from the host. release stops
+// serving them, and must be called once the prediction has completed.
+func (p *Predictor) requestInputs(inputs Inputs) (inputMap map[string]any, release func(), err error) {
+	releases := []func(){}
+	release = func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	if p.receiver != nil && p.servesFiles() {
+		served := make(Inputs, len(inputs))
+		for key, input := range inputs {
+			switch {
+			case input.File != nil:
+				fileURL, ok, err := p.serveInputFile(*input.File, &releases)
+				if err != nil {
+					release()
+					return nil, nil, err
+				}
+				if ok {
+					input = Input{String: &fileURL}
+				}
+			case input.Array != nil:
+				items := make([]any, len(*input.Array))
+				for i, item := range *input.Array {
+					items[i] = item
+					str, isString := item.(string)
+					if !isString || !strings.HasPrefix(str, "@") {
+						continue
+					}
+					fileURL, ok, err := p.serveInputFile(str[1:], &releases)
+					if err != nil {
+						release()
+						return nil, nil, err
+					}
+					if ok {
+						items[i] = fileURL
+					}
+				}
+				input = Input{Array: &items}
+			}
+			served[key] = input
+		}
+		inputs = served
+	}
+
+	inputMap, err = inputs.toMap()
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return inputMap, release, nil
+}
+
+// serveInputFile serves the file at path if it should be sent over HTTP.
+func (p *Predictor) serveInputFile(path string, releases *[]func()) (string, bool, error) {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return "", false, fmt.Errorf("error expanding homedir for '%s': %w", path, err)
+	}
+	stat, err := os.Stat(expanded)
+	if err != nil {
+		return "", false, err
+	}
+	if p.fileTransfer == FileTransferAuto && stat.Size() <= largeFileSize {
+		return "", false, nil
+	}
+
+	fileURL, release := p.receiver.serveFile(expanded)
+	*releases = append(*releases, release)
+	return fileURL, true, nil
+}
+
+// InlineFiles replaces the file:// URLs of output files the model uploaded to
+// the predictor with data URLs, for outputs that aren't written to disk.
+func (p *Predictor) InlineFiles(output any) (any, error) {
+	if p.receiver == nil {
+		return output, nil
+	}
+	switch v := output.(type) {
+	case string:
+		path, ok := p.uploadedPath(v)
+		if !ok {
+			return v, nil
+		}
+		return fileToDataURL(path)
+	case []any:
+		inlined := make([]any, len(v))
+		for i, item := range v {
+			item, err := p.InlineFiles(item)
+			if err != nil {
+				return nil, err
+			}
+			inlined[i] = item
+		}
+		return inlined, nil
+	case map[string]any:
+		inlined := make(map[string]any, len(v))
+		for key, item := range v {
+			item, err := p.InlineFiles(item)
+			if err != nil {
+				return nil, err
+			}
+			inlined[key] = item
+		}
+		return inlined, nil
+	}
+	return output, nil
+}
+
+// WriteOutputFile writes the output file at fileURL to destination, and returns
+// the path it was written to. Files the model uploaded to the predictor are
+// moved there. The model can't refer to any other file on the host, so other
+// file:// URLs are an error.
+func (p *Predictor) WriteOutputFile(fileURL string, destination string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Scheme != "file" {
+		return files.WriteURLToFile(fileURL, destination)
+	}
+
+	path, ok := p.uploadedPath(fileURL)
+	if !ok {
+		return "", fmt.Errorf("Output %s is not a file uploaded by the model", fileURL)
+	}
+	outputPath, err := homedir.Expand(files.WithDefaultExt(destination, filepath.Ext(path)))
+	if err != nil {
+		return "", err
+	}
+	if err := files.MoveFile(path, outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// uploadedPath returns the path on the host of the file:// URL fileURL, if it
+// is a file the model uploaded to the predictor.
+func (p *Predictor) uploadedPath(fileURL string) (string, bool) {
+	if p.receiver == nil {
+		return "", false
+	}
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Scheme != "file" || u.Host != "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(p.receiver.uploadDir, filepath.Clean(u.Path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(p.receiver.uploadDir, rel), true
+}
@@ -0,0 +1,99 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestInputsServesFiles(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+	items := []any{"@" + path, "plain"}
+	inputs := Inputs{
+		"file":  Input{File: &path},
+		"files": Input{Array: &items},
+	}
+
+	// Small files are sent as data URLs unless HTTP is requested
+	p := &Predictor{receiver: r, fileTransfer: FileTransferAuto}
+	inputMap, release, err := p.requestInputs(inputs)
+	require.NoError(t, err)
+	release()
+	require.Equal(t, "data:text/plain;base64,aGVsbG8=", inputMap["file"])
+
+	p.fileTransfer = FileTransferHTTP
+	inputMap, release, err = p.requestInputs(inputs)
+	require.NoError(t, err)
+	defer release()
+	require.True(t, strings.HasPrefix(inputMap["file"].(string), r.baseURL()+"/files/"))
+	files := inputMap["files"].([]any)
+	require.True(t, strings.HasPrefix(files[0].(string), r.baseURL()+"/files/"))
+	require.Equal(t, "plain", files[1])
+
+	// The inputs passed in are left alone
+	require.Equal(t, path, *inputs["file"].File)
+}
+
+func TestParseFileTransfer(t *testing.T) {
+	mode, err := ParseFileTransfer("http")
+	require.NoError(t, err)
+	require.Equal(t, FileTransferHTTP, mode)
+
+	_, err = ParseFileTransfer("bind")
+	require.ErrorContains(t, err, "Invalid file transfer mode")
+}
+
+func TestInlineFiles(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	path := filepath.Join(r.uploadDir, "out.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+
+	p := &Predictor{receiver: r}
+	escaped := "file://" + r.uploadDir + "/../../etc/hosts"
+	output, err := p.InlineFiles(map[string]any{"file": "file://" + path, "text": "file:///etc/hosts", "escaped": escaped})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"file": "data:text/plain;base64,aGVsbG8=", "text": "file:///etc/hosts", "escaped": escaped}, output)
+}
+
+func TestWriteOutputFile(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+	p := &Predictor{receiver: r}
+	dir := t.TempDir()
+
+	src := filepath.Join(r.uploadDir, "upload.png")
+	require.NoError(t, os.WriteFile(src, []byte("png"), 0o644))
+	path, err := p.WriteOutputFile("file://"+src, filepath.Join(dir, "output"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "output.png"), path)
+	require.NoFileExists(t, src)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "png", string(content))
+
+	// Files outside the upload directory are left where they are
+	secret := filepath.Join(t.TempDir(), "id_rsa")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0o600))
+	for _, fileURL := range []string{"file://" + secret, "file://" + r.uploadDir + "/../" + filepath.Base(secret)} {
+		_, err = p.WriteOutputFile(fileURL, filepath.Join(dir, "stolen"))
+		require.ErrorContains(t, err, "is not a file uploaded by the model")
+	}
+	require.FileExists(t, secret)
+
+	// Without a receiver, no file:// URL is accepted
+	_, err = (&Predictor{}).WriteOutputFile("file://"+secret, filepath.Join(dir, "stolen"))
+	require.ErrorContains(t, err, "is not a file uploaded by the model")
+	require.FileExists(t, secret)
+}
@@ -0,0 +1,373 @@
+package predict
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ValidateInputs checks inputs against the input schema of the model and
+// converts values passed as strings, such as -i steps=50, to the types the model
+// expects. Mistakes are reported before the prediction is sent, rather than by
+// the server as a 422 once it has started.
+func (p *Predictor) ValidateInputs(inputs Inputs, schema *openapi3.T) error {
+	component := "Input"
+	if p.isTrain {
+		component = "TrainingInput"
+	}
+	ref, ok := schema.Components.Schemas[component]
+	if !ok || ref.Value == nil {
+		// Nothing to validate against, leave it to the server
+		return nil
+	}
+	inputSchema := ref.Value
+
+	names := make([]string, 0, len(inputSchema.Properties))
+	for name := range inputSchema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errorMessages := []string{}
+	for _, key := range keys {
+		property, ok := inputSchema.Properties[key]
+		if !ok || property.Value == nil {
+			message := "unknown input"
+			if suggestion := closestName(key, names); suggestion != "" {
+				message += fmt.Sprintf(", did you mean %q?", suggestion)
+			} else if len(names) > 0 {
+				message += ", expected one of: " + strings.Join(names, ", ")
+			}
+			errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", key, message))
+			continue
+		}
+
+		input, err := coerceInput(inputs[key], resolveProperty(property.Value))
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", key, err))
+			continue
+		}
+		inputs[key] = input
+	}
+
+	for _, name := range inputSchema.Required {
+		if _, ok := inputs[name]; !ok {
+			errorMessages = append(errorMessages, fmt.Sprintf("- %s: required input is missing", name))
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		return p.inputValidationError(errorMessages)
+	}
+	return nil
+}
+
+// resolveProperty returns the schema of an input property. Cog describes
+// inputs with choices as a reference to an enum, wrapped in allOf so the
+// property can have its own description and default. Optional inputs are
+// described as anyOf the type and null, which resolves to the type, made
+// nullable.
+func resolveProperty(property *openapi3.Schema) *openapi3.Schema {
+	if len(property.AnyOf) > 0 {
+		var branch *openapi3.Schema
+		nullable := false
+		for _, ref := range property.AnyOf {
+			switch {
+			case ref.Value == nil:
+				return property
+			case ref.Value.Type.Is("null"):
+				nullable = true
+			case branch != nil:
+				// A union of types, leave it to the server
+				return property
+			default:
+				branch = ref.Value
+			}
+		}
+		if branch == nil {
+			return property
+		}
+		resolved := *resolveProperty(branch)
+		resolved.Nullable = resolved.Nullable || nullable || property.Nullable
+		return &resolved
+	}
+	if len(property.AllOf) != 1 || property.AllOf[0].Value == nil {
+		return property
+	}
+	resolved := *property
+	ref := property.AllOf[0].Value
+	if resolved.Type == nil || len(*resolved.Type) == 0 {
+		resolved.Type = ref.Type
+	}
+	if len(resolved.Enum) == 0 {
+		resolved.Enum = ref.Enum
+	}
+	return &resolved
+}
+
+func coerceInput(input Input, schema *openapi3.Schema) (Input, error) {
+	switch {
+	case input.File != nil:
+		if isScalar(schema) && !schema.Type.Is("string") {
+			return input, fmt.Errorf("expected %s, got a file", describeType(schema))
+		}
+		return input, nil
+	case input.String != nil:
+		value, err := coerceValue(*input.String, schema)
+		if err != nil {
+			return input, err
+		}
+		if _, ok := value.(string); ok {
+			return input, nil
+		}
+		return jsonInput(value)
+	case input.Array != nil:
+		if schema.Items == nil || schema.Items.Value == nil {
+			return input, nil
+		}
+		items := make([]any, len(*input.Array))
+		converted := false
+		hasFiles := false
+		for i, item := range *input.Array {
+			if str, ok := item.(string); ok && strings.HasPrefix(str, "@") {
+				// Files are read when the request is sent
+				items[i] = item
+				hasFiles = true
+				continue
+			}
+			value, err := coerceValue(item, resolveProperty(schema.Items.Value))
+			if err != nil {
+				return input, fmt.Errorf("item %d: %w", i, err)
+			}
+			if _, ok := value.(string); !ok {
+				converted = true
+			}
+			items[i] = value
+		}
+		if !converted {
+			return input, nil
+		}
+		if hasFiles {
+			return Input{Array: &items}, nil
+		}
+		return jsonInput(items)
+	case input.Json != nil:
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(*input.Json))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return input, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if !isScalar(schema) {
+			return input, nil
+		}
+		coerced, err := coerceValue(value, schema)
+		if err != nil {
+			return input, err
+		}
+		if reflect.DeepEqual(coerced, value) {
+			return input, nil
+		}
+		return jsonInput(coerced)
+	}
+	return input, nil
+}
+
+// coerceValue converts strings to the scalar type in schema and checks the
+// result against the choices and bounds of the input. Integers are kept as
+// int64, so they aren't rounded to the nearest float64.
+func coerceValue(value any, schema *openapi3.Schema) (any, error) {
+	if !isScalar(schema) {
+		return value, nil
+	}
+	if value == nil {
+		// Optional inputs may be null, which the server checks
+		return nil, nil
+	}
+
+	var err error
+	switch v := value.(type) {
+	case string:
+		switch {
+		case schema.Type.Is("integer"):
+			value, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %q", v)
+			}
+		case schema.Type.Is("number"):
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", v)
+			}
+			value = n
+		case schema.Type.Is("boolean"):
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected true or false, got %q", v)
+			}
+			value = b
+		}
+	case json.Number:
+		if schema.Type.Is("integer") {
+			value, err = parseInteger(v.String())
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %v", v)
+			}
+		} else {
+			value, err = v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("expected %s, got %v", describeType(schema), v)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if !schema.Type.Is("integer") && !schema.Type.Is("number") {
+			return nil, fmt.Errorf("expected %s, got %v", describeType(schema), v)
+		}
+		if schema.Min != nil && float64(v) < *schema.Min {
+			return nil, fmt.Errorf("must be greater than or equal to %v, got %v", *schema.Min, v)
+		}
+		if schema.Max != nil && float64(v) > *schema.Max {
+			return nil, fmt.Errorf("must be less than or equal to %v, got %v", *schema.Max, v)
+		}
+	case float64:
+		if !schema.Type.Is("integer") && !schema.Type.Is("number") {
+			return nil, fmt.Errorf("expected %s, got %v", describeType(schema), v)
+		}
+		if schema.Type.Is("integer") {
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("expected an integer, got %v", v)
+			}
+			value = int64(v)
+		}
+		if schema.Min != nil && v < *schema.Min {
+			return nil, fmt.Errorf("must be greater than or equal to %v, got %v", *schema.Min, v)
+		}
+		if schema.Max != nil && v > *schema.Max {
+			return nil, fmt.Errorf("must be less than or equal to %v, got %v", *schema.Max, v)
+		}
+	case bool:
+		if !schema.Type.Is("boolean") {
+			return nil, fmt.Errorf("expected %s, got %v", describeType(schema), v)
+		}
+	case string:
+		if !schema.Type.Is("string") {
+			return nil, fmt.Errorf("expected %s, got %q", describeType(schema), v)
+		}
+	}
+
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		choices := make([]string, len(schema.Enum))
+		for i, choice := range schema.Enum {
+			choices[i] = fmt.Sprint(choice)
+		}
+		return nil, fmt.Errorf("%v is not one of the choices: %s", value, strings.Join(choices, ", "))
+	}
+	return value, nil
+}
+
+// parseInteger parses an integer from JSON, which may be written like a float
+// with no fractional part, such as 1e3 or 5.0.
+func parseInteger(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || math.Abs(f) > 1<<53 {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return int64(f), nil
+}
+
+func isScalar(schema *openapi3.Schema) bool {
+	return schema.Type.Is("string") || schema.Type.Is("integer") || schema.Type.Is("number") || schema.Type.Is("boolean")
+}
+
+func describeType(schema *openapi3.Schema) string {
+	switch {
+	case schema.Type.Is("integer"):
+		return "an integer"
+	case schema.Type.Is("number"):
+		return "a number"
+	case schema.Type.Is("boolean"):
+		return "true or false"
+	default:
+		return "a string"
+	}
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+		// Choices are decoded from the schema as float64
+		if n, ok := value.(int64); ok && reflect.DeepEqual(v, float64(n)) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonInput(value any) (Input, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Input{}, err
+	}
+	raw := json.RawMessage(data)
+	return Input{Json: &raw}, nil
+}
+
+// closestName returns the name most similar to name, or an empty string if
+// none of them is close enough to be a likely typo.
+func closestName(name string, names []string) string {
+	best := ""
+	bestDistance := 0
+	for _, candidate := range names {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if best == "" || distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	if best == "" || bestDistance > max(2, len(name)/3) {
+		return ""
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,148 @@
+package predict
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const validateTestSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0},
+          "steps": {"type": "integer", "title": "Steps", "default": 50, "minimum": 1, "maximum": 100, "x-order": 1},
+          "guidance": {"type": "number", "title": "Guidance", "default": 7.5, "x-order": 2},
+          "upscale": {"type": "boolean", "title": "Upscale", "default": false, "x-order": 3},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 4},
+          "seeds": {"type": "array", "items": {"type": "integer"}, "title": "Seeds", "x-order": 5},
+          "seed": {"anyOf": [{"type": "integer", "maximum": 9223372036854775807}, {"type": "null"}], "title": "Seed", "x-order": 6},
+          "negative_prompt": {"anyOf": [{"type": "string"}, {"type": "null"}], "title": "Negative Prompt", "x-order": 7}
+        }
+      },
+      "scheduler": {"title": "scheduler", "enum": ["DDIM", "K_EULER"], "type": "string"}
+    }
+  }
+}`
+
+func loadValidateTestSchema(t *testing.T) *openapi3.T {
+	t.Helper()
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(validateTestSchema))
+	require.NoError(t, err)
+	return schema
+}
+
+func stringInput(s string) Input {
+	return Input{String: &s}
+}
+
+func TestValidateInputsCoercesValues(t *testing.T) {
+	seeds := []any{"1", "2"}
+	inputs := Inputs{
+		"prompt":    stringInput("a cat"),
+		"steps":     stringInput("20"),
+		"guidance":  stringInput("3.5"),
+		"upscale":   stringInput("true"),
+		"scheduler": stringInput("K_EULER"),
+		"seeds":     Input{Array: &seeds},
+	}
+
+	p := &Predictor{}
+	require.NoError(t, p.ValidateInputs(inputs, loadValidateTestSchema(t)))
+
+	values, err := inputs.toMap()
+	require.NoError(t, err)
+	encoded, err := json.Marshal(values)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"prompt": "a cat", "steps": 20, "guidance": 3.5, "upscale": true, "scheduler": "K_EULER", "seeds": [1, 2]}`, string(encoded))
+}
+
+func TestValidateInputsReportsErrors(t *testing.T) {
+	inputs := Inputs{
+		"promt":     stringInput("a cat"),
+		"steps":     stringInput("200"),
+		"guidance":  stringInput("high"),
+		"upscale":   stringInput("maybe"),
+		"scheduler": stringInput("PNDM"),
+	}
+
+	p := &Predictor{}
+	err := p.ValidateInputs(inputs, loadValidateTestSchema(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `- promt: unknown input, did you mean "prompt"?`)
+	require.Contains(t, err.Error(), "- steps: must be less than or equal to 100, got 200")
+	require.Contains(t, err.Error(), `- guidance: expected a number, got "high"`)
+	require.Contains(t, err.Error(), `- upscale: expected true or false, got "maybe"`)
+	require.Contains(t, err.Error(), "- scheduler: PNDM is not one of the choices: DDIM, K_EULER")
+	require.Contains(t, err.Error(), "- prompt: required input is missing")
+}
+
+func TestValidateInputsChecksJSONValues(t *testing.T) {
+	steps := json.RawMessage(`2.5`)
+	inputs := Inputs{
+		"prompt": stringInput("a cat"),
+		"steps":  Input{Json: &steps},
+	}
+
+	p := &Predictor{}
+	err := p.ValidateInputs(inputs, loadValidateTestSchema(t))
+	require.ErrorContains(t, err, "- steps: expected an integer, got 2.5")
+}
+
+func TestValidateInputsKeepsLargeIntegers(t *testing.T) {
+	seed := json.RawMessage(`9007199254740993`)
+	inputs := Inputs{
+		"prompt": stringInput("a cat"),
+		"steps":  stringInput("9007199254740993"),
+		"seed":   Input{Json: &seed},
+	}
+
+	p := &Predictor{}
+	err := p.ValidateInputs(inputs, loadValidateTestSchema(t))
+	require.ErrorContains(t, err, "- steps: must be less than or equal to 100, got 9007199254740993")
+
+	inputs["steps"] = stringInput("20")
+	require.NoError(t, p.ValidateInputs(inputs, loadValidateTestSchema(t)))
+	values, err := inputs.toMap()
+	require.NoError(t, err)
+	encoded, err := json.Marshal(values)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"prompt": "a cat", "steps": 20, "seed": 9007199254740993}`, string(encoded))
+	require.Contains(t, string(encoded), `"seed":9007199254740993`)
+}
+
+func TestValidateInputsCoercesOptionalInputs(t *testing.T) {
+	null := json.RawMessage(`null`)
+	inputs := Inputs{
+		"prompt":          stringInput("a cat"),
+		"seed":            stringInput("42"),
+		"negative_prompt": Input{Json: &null},
+	}
+
+	p := &Predictor{}
+	require.NoError(t, p.ValidateInputs(inputs, loadValidateTestSchema(t)))
+	values, err := inputs.toMap()
+	require.NoError(t, err)
+	encoded, err := json.Marshal(values)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"prompt": "a cat", "seed": 42, "negative_prompt": null}`, string(encoded))
+
+	inputs["seed"] = stringInput("lucky")
+	require.ErrorContains(t, p.ValidateInputs(inputs, loadValidateTestSchema(t)), `- seed: expected an integer, got "lucky"`)
+}
+
+func TestClosestName(t *testing.T) {
+	names := []string{"guidance", "prompt", "steps"}
+	require.Equal(t, "prompt", closestName("Prompt", names))
+	require.Equal(t, "steps", closestName("step", names))
+	require.Equal(t, "", closestName("width", names))
+}
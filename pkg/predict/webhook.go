@@ -0,0 +1,337 @@
+package predict
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// containerHostname is the hostname containers started by the predictor use to
+// reach servers listening on the host.
+const containerHostname = "host.docker.internal"
+
+// webhookReceiver is an HTTP server running on the host that receives webhooks
+// and file uploads from the Cog server running inside the container, and serves
+// it input files that are too large to send as data URLs.
+//
+// Every path starts with a random token, so other containers and anything else
+// that can reach the address it listens on can't read the files it serves or
+// send it outputs.
+type webhookReceiver struct {
+	listener  net.Listener
+	token     string
+	server    *http.Server
+	uploadDir string
+	uploads   atomic.Int64
+	served    atomic.Int64
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	subscribers map[string]chan *Response
+	files       map[string]string
+	stored      map[string][]string
+}
+
+func newWebhookReceiver() (*webhookReceiver, error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("Failed to generate webhook receiver token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(receiverHost(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start webhook receiver: %w", err)
+	}
+
+	uploadDir, err := os.MkdirTemp("", "cog-uploads")
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	r := &webhookReceiver{
+		listener:    listener,
+		token:       token,
+		uploadDir:   uploadDir,
+		subscribers: map[string]chan *Response{},
+		files:       map[string]string{},
+		stored:      map[string][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /"+token+"/webhook/{id}", r.handleWebhook)
+	mux.HandleFunc("PUT /"+token+"/upload/{name}", r.handleUpload)
+	mux.HandleFunc("PUT /"+token+"/upload/{prefix}/{name}", r.handleUpload)
+	mux.HandleFunc("GET /"+token+"/files/{id}/{name}", r.handleFile)
+	r.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := r.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			console.Warnf("Webhook receiver stopped: %s", err)
+		}
+	}()
+
+	return r, nil
+}
+
+// receiverHost returns the address the webhook receiver listens on. On Linux,
+// containers reach the host through the gateway of the default Docker bridge.
+// Docker Desktop forwards host-gateway to the loopback interface of the host.
+func receiverHost() string {
+	if runtime.GOOS == "linux" {
+		if iface, err := net.InterfaceByName("docker0"); err == nil {
+			addrs, err := iface.Addrs()
+			if err == nil {
+				for _, addr := range addrs {
+					if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+						return ipNet.IP.String()
+					}
+				}
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// serverURL is the address of the receiver as the container sees it.
+func (r *webhookReceiver) serverURL() string {
+	port := r.listener.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf("http://%s:%d", containerHostname, port)
+}
+
+func (r *webhookReceiver) baseURL() string {
+	return r.serverURL() + "/" + r.token
+}
+
+func (r *webhookReceiver) webhookURL(id string) string {
+	return r.baseURL() + "/webhook/" + id
+}
+
+func (r *webhookReceiver) uploadURL() string {
+	return r.baseURL() + "/upload/"
+}
+
+// subscribe returns a channel that receives the state of prediction id every time
+// a webhook for it arrives.
+func (r *webhookReceiver) subscribe(id string) <-chan *Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Every webhook carries the full prediction state, so a small buffer is enough
+	// and intermediate updates can be dropped if the consumer falls behind.
+	ch := make(chan *Response, 16)
+	r.subscribers[id] = ch
+	return ch
+}
+
+func (r *webhookReceiver) unsubscribe(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subscribers, id)
+}
+
+func (r *webhookReceiver) handleWebhook(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	response := &Response{}
+	if err := json.NewDecoder(req.Body).Decode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	ch, ok := r.subscribers[id]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	if response.Status.Terminal() {
+		select {
+		case ch <- response:
+		case <-req.Context().Done():
+			return
+		}
+	} else {
+		select {
+		case ch <- response:
+		default:
+			console.Debugf("Dropping webhook for prediction %s, consumer is busy", id)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *webhookReceiver) handleUpload(w http.ResponseWriter, req *http.Request) {
+	name := filepath.Base(req.PathValue("name"))
+
+	// Outputs of a prediction commonly share the same filename, so give each
+	// upload its own directory.
+	dir := strconv.FormatInt(r.uploads.Add(1), 10)
+	if err := os.MkdirAll(filepath.Join(r.uploadDir, dir), 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		// Synchronous predictions upload to output_file_prefix as a form
+		file, err := formFile(req, "file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = file
+	}
+
+	path := filepath.Join(r.uploadDir, dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	location := r.uploadURL() + dir + "/" + name
+	r.mu.Lock()
+	r.stored[location] = []string{path}
+	// Synchronous predictions ignore Location and use the URL they uploaded to,
+	// which is the same for outputs with the same name
+	requestURL := r.serverURL() + req.URL.Path
+	r.stored[requestURL] = append(r.stored[requestURL], path)
+	r.mu.Unlock()
+
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// formFile returns the contents of the form field called name, without
+// reading the whole form into memory.
+func formFile(req *http.Request, name string) (io.Reader, error) {
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find %q in form: %w", name, err)
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+	}
+}
+
+// localPath returns the path on the host of a file that was uploaded to
+// fileURL. Files uploaded to the same URL are returned in the order they were
+// uploaded, which is the order they appear in the output.
+func (r *webhookReceiver) localPath(fileURL string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	paths := r.stored[fileURL]
+	if len(paths) == 0 {
+		return "", false
+	}
+	if len(paths) > 1 {
+		r.stored[fileURL] = paths[1:]
+	}
+	return paths[0], true
+}
+
+// resolveUploads replaces URLs of uploaded files in output with file:// URLs of
+// their location on the host.
+func (r *webhookReceiver) resolveUploads(output any) any {
+	switch v := output.(type) {
+	case string:
+		path, ok := r.localPath(v)
+		if !ok {
+			return v
+		}
+		return (&url.URL{Scheme: "file", Path: path}).String()
+	case []any:
+		resolved := make([]any, len(v))
+		for i, item := range v {
+			resolved[i] = r.resolveUploads(item)
+		}
+		return resolved
+	case map[string]any:
+		resolved := make(map[string]any, len(v))
+		for key, item := range v {
+			resolved[key] = r.resolveUploads(item)
+		}
+		return resolved
+	}
+	return output
+}
+
+// serveFile makes the file at path available to the container until release
+// is called, and returns its URL.
+func (r *webhookReceiver) serveFile(path string) (fileURL string, release func()) {
+	id := strconv.FormatInt(r.served.Add(1), 10)
+	r.mu.Lock()
+	r.files[id] = path
+	r.mu.Unlock()
+
+	// The Cog server names the downloaded file after the last part of the URL
+	fileURL = r.baseURL() + "/files/" + id + "/" + url.PathEscape(filepath.Base(path))
+	return fileURL, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.files, id)
+	}
+}
+
+func (r *webhookReceiver) handleFile(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	path, ok := r.files[req.PathValue("id")]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, req, stat.Name(), stat.ModTime(), f)
+}
+
+func (r *webhookReceiver) close(ctx context.Context) error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.server.Shutdown(ctx)
+		if rmErr := os.RemoveAll(r.uploadDir); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,146 @@
+package predict
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// hostURL rewrites a URL meant for the container so it can be reached from the test.
+func hostURL(r *webhookReceiver, url string) string {
+	return strings.Replace(url, containerHostname, r.listener.Addr().(*net.TCPAddr).IP.String(), 1)
+}
+
+func TestWebhookReceiverDeliversWebhooks(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	updates := r.subscribe("abc")
+
+	resp, err := http.Post(hostURL(r, r.webhookURL("abc")), "application/json", strings.NewReader(`{"id": "abc", "status": "succeeded", "logs": "hello\n"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	update := <-updates
+	require.Equal(t, "abc", update.ID)
+	require.True(t, update.Status.Terminal())
+	require.Equal(t, "hello\n", update.Logs)
+
+	resp, err = http.Post(hostURL(r, r.webhookURL("unknown")), "application/json", strings.NewReader(`{"status": "processing"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookReceiverUploads(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	upload := func() string {
+		req, err := http.NewRequest(http.MethodPut, hostURL(r, r.uploadURL()+"out.txt"), bytes.NewBufferString("hello"))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		return resp.Header.Get("Location")
+	}
+
+	first := upload()
+	second := upload()
+	require.NotEqual(t, first, second)
+
+	path, ok := r.localPath(first)
+	require.True(t, ok)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+
+	_, ok = r.localPath(r.uploadURL() + "../../etc/passwd")
+	require.False(t, ok)
+
+	output := r.resolveUploads(map[string]any{"files": []any{first}, "text": "plain"})
+	require.Equal(t, map[string]any{
+		"files": []any{"file://" + path},
+		"text":  "plain",
+	}, output)
+}
+
+func TestWebhookReceiverFormUploads(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	// Synchronous predictions upload every output to output_file_prefix + name
+	fileURL := r.uploadURL() + "prediction-id/out.txt"
+	for _, content := range []string{"first", "second"} {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", "out.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+
+		req, err := http.NewRequest(http.MethodPut, hostURL(r, fileURL), body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	output := r.resolveUploads([]any{fileURL, fileURL}).([]any)
+	for i, expected := range []string{"first", "second"} {
+		u, err := url.Parse(output[i].(string))
+		require.NoError(t, err)
+		content, err := os.ReadFile(u.Path)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(content))
+	}
+}
+
+func TestWebhookReceiverServesFiles(t *testing.T) {
+	r, err := newWebhookReceiver()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.close(t.Context()) })
+
+	path := filepath.Join(t.TempDir(), "my video.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("video"), 0o644))
+
+	fileURL, release := r.serveFile(path)
+	require.True(t, strings.HasSuffix(fileURL, "/my%20video.mp4"))
+
+	resp, err := http.Get(hostURL(r, fileURL))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "video", string(body))
+
+	// Files can't be fetched without the token of the receiver
+	resp, err = http.Get(hostURL(r, strings.Replace(fileURL, "/"+r.token, "", 1)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	release()
+	resp, err = http.Get(hostURL(r, fileURL))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -23,4 +23,5 @@ type Client interface {
 	Inspect(ctx context.Context, imageRef string, platform *Platform) (*ManifestResult, error)
 	GetImage(ctx context.Context, imageRef string, platform *Platform) (v1.Image, error)
 	Exists(ctx context.Context, imageRef string) (bool, error)
+	PushIndex(ctx context.Context, imageRef string, imageRefs []string) error
 }
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// DefaultPlatform is the platform images are built for when no platform is
+// given, which is the one Replicate runs models on.
+var DefaultPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// ParsePlatform parses a platform in the form os/arch or os/arch/variant, like
+// linux/arm64.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("Invalid platform %q, expected os/arch, like linux/amd64", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Platform{}, fmt.Errorf("Invalid platform %q, expected os/arch, like linux/amd64", s)
+		}
+	}
+	platform := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// ParsePlatforms parses a comma-separated list of platforms, like
+// linux/amd64,linux/arm64. Platforms that are listed twice are only returned
+// once.
+func ParsePlatforms(s string) ([]Platform, error) {
+	platforms := []Platform{}
+	for _, part := range strings.Split(s, ",") {
+		platform, err := ParsePlatform(part)
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, p := range platforms {
+			if p == platform {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms, nil
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+func (p Platform) v1() v1.Platform {
+	return v1.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant}
+}
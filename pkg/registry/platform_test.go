@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := ParsePlatform("linux/arm64")
+	require.NoError(t, err)
+	require.Equal(t, Platform{OS: "linux", Architecture: "arm64"}, platform)
+	require.Equal(t, "linux/arm64", platform.String())
+
+	platform, err = ParsePlatform("linux/arm/v7")
+	require.NoError(t, err)
+	require.Equal(t, Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, platform)
+	require.Equal(t, "linux/arm/v7", platform.String())
+
+	for _, s := range []string{"", "linux", "linux/", "/amd64", "linux/arm/v7/extra"} {
+		_, err := ParsePlatform(s)
+		require.ErrorContains(t, err, "Invalid platform", s)
+	}
+}
+
+func TestParsePlatforms(t *testing.T) {
+	platforms, err := ParsePlatforms("linux/amd64, linux/arm64,linux/amd64")
+	require.NoError(t, err)
+	require.Equal(t, []Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}, platforms)
+
+	_, err = ParsePlatforms("linux/amd64,")
+	require.Error(t, err)
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -27,12 +29,14 @@ func (c *RegistryClient) Inspect(ctx context.Context, imageRef string, platform
 		return nil, fmt.Errorf("parsing reference: %w", err)
 	}
 
-	desc, err := remote.Get(ref,
+	options := []remote.Option{
 		remote.WithContext(ctx),
 		remote.WithAuthFromKeychain(authn.DefaultKeychain),
-		// TODO[md]: map platform to remote.WithPlatform if necessary:
-		// remote.WithPlatform(...)
-	)
+	}
+	if platform != nil {
+		options = append(options, remote.WithPlatform(platform.v1()))
+	}
+	desc, err := remote.Get(ref, options...)
 	if err != nil {
 		if checkError(err, transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode) {
 			return nil, NotFoundError
@@ -91,9 +95,28 @@ func (c *RegistryClient) Inspect(ctx context.Context, imageRef string, platform
 		}
 	}
 
-	// platform is set, we expect a manifest list or error
+	// platform is set, so a single image has to be for that platform
 	if mediaType != types.OCIImageIndex && mediaType != types.DockerManifestList {
-		return nil, fmt.Errorf("image is not a manifest list but platform was specified")
+		img, err := desc.Image()
+		if err != nil {
+			return nil, fmt.Errorf("loading image: %w", err)
+		}
+		if err := checkImagePlatform(img, platform); err != nil {
+			return nil, err
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting manifest: %w", err)
+		}
+		result := &ManifestResult{
+			SchemaVersion: manifest.SchemaVersion,
+			MediaType:     string(mediaType),
+			Config:        manifest.Config.Digest.String(),
+		}
+		for _, layer := range manifest.Layers {
+			result.Layers = append(result.Layers, layer.Digest.String())
+		}
+		return result, nil
 	}
 
 	idx, err := desc.ImageIndex()
@@ -177,9 +200,16 @@ func (c *RegistryClient) GetImage(ctx context.Context, imageRef string, platform
 		}
 	}
 
-	// For platform-specific requests, we need to handle manifest lists
+	// For platform-specific requests, a single image has to be for that platform
 	if mediaType != types.OCIImageIndex && mediaType != types.DockerManifestList {
-		return nil, fmt.Errorf("image is not a manifest list but platform was specified")
+		img, err := desc.Image()
+		if err != nil {
+			return nil, fmt.Errorf("loading image: %w", err)
+		}
+		if err := checkImagePlatform(img, platform); err != nil {
+			return nil, err
+		}
+		return img, nil
 	}
 
 	idx, err := desc.ImageIndex()
@@ -234,6 +264,63 @@ func (c *RegistryClient) Exists(ctx context.Context, imageRef string) (bool, err
 	return true, nil
 }
 
+// PushIndex pushes an OCI image index to imageRef that points to the images in
+// imageRefs, which must already be pushed to the same repository. Each image
+// is listed under the platform in its config.
+func (c *RegistryClient) PushIndex(ctx context.Context, imageRef string, imageRefs []string) error {
+	ref, err := name.ParseReference(imageRef, name.Insecure)
+	if err != nil {
+		return fmt.Errorf("parsing reference: %w", err)
+	}
+
+	addenda := []mutate.IndexAddendum{}
+	for _, r := range imageRefs {
+		imgRef, err := name.ParseReference(r, name.Insecure)
+		if err != nil {
+			return fmt.Errorf("parsing reference: %w", err)
+		}
+		desc, err := remote.Get(imgRef,
+			remote.WithContext(ctx),
+			remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		)
+		if err != nil {
+			return fmt.Errorf("fetching descriptor of %s: %w", r, err)
+		}
+		img, err := desc.Image()
+		if err != nil {
+			return fmt.Errorf("loading image %s: %w", r, err)
+		}
+		configFile, err := img.ConfigFile()
+		if err != nil {
+			return fmt.Errorf("getting config of %s: %w", r, err)
+		}
+		descriptor := desc.Descriptor
+		descriptor.Platform = configFile.Platform()
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: descriptor})
+	}
+
+	index := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex), addenda...)
+	if err := remote.WriteIndex(ref, index,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+	); err != nil {
+		return fmt.Errorf("pushing index: %w", err)
+	}
+	return nil
+}
+
+// checkImagePlatform returns an error if img isn't for platform.
+func checkImagePlatform(img v1.Image, platform *Platform) error {
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("getting config: %w", err)
+	}
+	if configFile.OS != platform.OS || configFile.Architecture != platform.Architecture || (platform.Variant != "" && configFile.Variant != platform.Variant) {
+		return fmt.Errorf("platform not found: image is for %s/%s", configFile.OS, configFile.Architecture)
+	}
+	return nil
+}
+
 func checkError(err error, codes ...transport.ErrorCode) bool {
 	if err == nil {
 		return false
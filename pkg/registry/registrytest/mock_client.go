@@ -10,11 +10,18 @@ import (
 
 type MockRegistryClient struct {
 	mockImages map[string]bool
+	// mockPlatforms are the platforms of images added with
+	// AddMockImageForPlatforms
+	mockPlatforms map[string][]registry.Platform
+	// PushedIndexes are the images each index pushed with PushIndex points to
+	PushedIndexes map[string][]string
 }
 
 func NewMockRegistryClient() *MockRegistryClient {
 	return &MockRegistryClient{
-		mockImages: map[string]bool{},
+		mockImages:    map[string]bool{},
+		mockPlatforms: map[string][]registry.Platform{},
+		PushedIndexes: map[string][]string{},
 	}
 }
 
@@ -28,9 +35,30 @@ func (c *MockRegistryClient) GetImage(ctx context.Context, imageRef string, plat
 }
 
 func (c *MockRegistryClient) Inspect(ctx context.Context, imageRef string, platform *registry.Platform) (*registry.ManifestResult, error) {
-	return nil, nil
+	platforms, ok := c.mockPlatforms[imageRef]
+	if platform == nil || !ok {
+		return nil, nil
+	}
+	for _, p := range platforms {
+		if p == *platform {
+			return &registry.ManifestResult{}, nil
+		}
+	}
+	return nil, registry.NotFoundError
+}
+
+func (c *MockRegistryClient) PushIndex(ctx context.Context, imageRef string, imageRefs []string) error {
+	c.PushedIndexes[imageRef] = imageRefs
+	return nil
 }
 
 func (c *MockRegistryClient) AddMockImage(imageRef string) {
 	c.mockImages[imageRef] = true
 }
+
+// AddMockImageForPlatforms adds an image that Inspect only finds for
+// platforms.
+func (c *MockRegistryClient) AddMockImageForPlatforms(imageRef string, platforms ...registry.Platform) {
+	c.mockImages[imageRef] = true
+	c.mockPlatforms[imageRef] = platforms
+}
@@ -0,0 +1,342 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Strategy string
+
+const (
+	// RoundRobin sends requests to each ready replica in turn
+	RoundRobin Strategy = "round-robin"
+	// LeastBusy sends requests to the ready replica with the fewest requests
+	// in progress
+	LeastBusy Strategy = "least-busy"
+)
+
+// These status values are defined in python/cog/server/http.py
+const (
+	StatusStarting    = "STARTING"
+	StatusReady       = "READY"
+	StatusBusy        = "BUSY"
+	StatusSetupFailed = "SETUP_FAILED"
+	// StatusUnreachable is the status of a replica that doesn't respond to
+	// health checks
+	StatusUnreachable = "UNREACHABLE"
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case RoundRobin, LeastBusy:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("Invalid routing strategy %q, expected %q or %q", s, RoundRobin, LeastBusy)
+}
+
+type replica struct {
+	url    *url.URL
+	proxy  *httputil.ReverseProxy
+	active atomic.Int64
+	health atomic.Value
+}
+
+func (r *replica) status() string {
+	return r.health.Load().(string)
+}
+
+func (r *replica) available() bool {
+	status := r.status()
+	return status == StatusReady || status == StatusBusy
+}
+
+// Balancer is a reverse proxy that spreads predictions across replicas of a
+// Cog server, and answers for all of them on the endpoints that describe the
+// server.
+type Balancer struct {
+	replicas []*replica
+	strategy Strategy
+	next     atomic.Uint64
+	client   *http.Client
+
+	// OnStatusChange is called when the health check of a replica returns a
+	// different status, with the index of the replica
+	OnStatusChange func(i int, status string)
+}
+
+func NewBalancer(replicaURLs []string, strategy Strategy) (*Balancer, error) {
+	if len(replicaURLs) == 0 {
+		return nil, fmt.Errorf("A load balancer needs at least one replica")
+	}
+	b := &Balancer{
+		strategy: strategy,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, replicaURL := range replicaURLs {
+		u, err := url.Parse(replicaURL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid replica URL %q: %w", replicaURL, err)
+		}
+		r := &replica{url: u, proxy: httputil.NewSingleHostReverseProxy(u)}
+		r.health.Store(StatusStarting)
+		b.replicas = append(b.replicas, r)
+	}
+	return b, nil
+}
+
+// Statuses returns the last known status of each replica.
+func (b *Balancer) Statuses() []string {
+	statuses := make([]string, len(b.replicas))
+	for i, r := range b.replicas {
+		statuses[i] = r.status()
+	}
+	return statuses
+}
+
+// CheckHealth checks the health of every replica every interval, until ctx is
+// done. Requests are only sent to replicas that are ready or busy.
+func (b *Balancer) CheckHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.checkHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, r := range b.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := b.replicaHealth(ctx, r)
+			if previous := r.health.Swap(status); previous != status && b.OnStatusChange != nil && ctx.Err() == nil {
+				b.OnStatusChange(i, status)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) replicaHealth(ctx context.Context, r *replica) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url.JoinPath("health-check").String(), nil)
+	if err != nil {
+		return StatusUnreachable
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return StatusUnreachable
+	}
+	defer resp.Body.Close()
+	health := struct {
+		Status string `json:"status"`
+	}{}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&health) != nil || health.Status == "" {
+		return StatusUnreachable
+	}
+	return health.Status
+}
+
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == "/health-check":
+		b.serveHealthCheck(w)
+	case req.URL.Path == "/openapi.json":
+		b.serveOpenAPI(w, req)
+	case req.URL.Path == "/shutdown" || strings.HasSuffix(req.URL.Path, "/cancel"):
+		// Only the replica running a prediction can cancel it
+		b.broadcast(w, req)
+	default:
+		r := b.pick()
+		if r == nil {
+			http.Error(w, "No replica is ready", http.StatusServiceUnavailable)
+			return
+		}
+		defer r.active.Add(-1)
+		r.proxy.ServeHTTP(w, req)
+	}
+}
+
+// pick returns the replica to send a request to with its count of requests in
+// progress already incremented, or nil if none are ready. A Cog server runs one
+// prediction at a time and rejects others while it is busy, so replicas that
+// are idle are preferred, and busy ones are only picked when none are idle.
+func (b *Balancer) pick() *replica {
+	available, idle := []*replica{}, []*replica{}
+	for _, r := range b.replicas {
+		if !r.available() {
+			continue
+		}
+		available = append(available, r)
+		if r.status() == StatusReady && r.active.Load() == 0 {
+			idle = append(idle, r)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	start := int(b.next.Add(1) - 1)
+	for i := range idle {
+		// Another request may have claimed the replica since it was checked
+		if r := idle[(start+i)%len(idle)]; r.active.CompareAndSwap(0, 1) {
+			return r
+		}
+	}
+
+	picked := available[start%len(available)]
+	if b.strategy == LeastBusy {
+		// Ties go to the next replica in turn
+		for i := range available {
+			r := available[(start+i)%len(available)]
+			if r.active.Load() < picked.active.Load() {
+				picked = r
+			}
+		}
+	}
+	picked.active.Add(1)
+	return picked
+}
+
+// serveHealthCheck reports the best status of any replica, so the server is
+// ready as long as one replica is, along with the status of each.
+func (b *Balancer) serveHealthCheck(w http.ResponseWriter) {
+	statuses := b.Statuses()
+	status := StatusUnreachable
+	for _, candidate := range []string{StatusReady, StatusBusy, StatusStarting, StatusSetupFailed} {
+		if containsStatus(statuses, candidate) {
+			status = candidate
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "replicas": statuses})
+}
+
+// serveOpenAPI returns the schema the replicas serve, which is an error if
+// they don't all serve the same one.
+func (b *Balancer) serveOpenAPI(w http.ResponseWriter, req *http.Request) {
+	var schema []byte
+	for i, r := range b.replicas {
+		if !r.available() {
+			continue
+		}
+		body, err := b.get(req.Context(), r, "openapi.json")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get schema of replica %d: %s", i+1, err), http.StatusBadGateway)
+			return
+		}
+		if schema == nil {
+			schema = body
+			continue
+		}
+		if !jsonEqual(schema, body) {
+			http.Error(w, fmt.Sprintf("Replica %d serves a different schema from the others", i+1), http.StatusBadGateway)
+			return
+		}
+	}
+	if schema == nil {
+		http.Error(w, "No replica is ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(schema)
+}
+
+// broadcast sends a request to each replica until one succeeds, or to all of
+// them for /shutdown, and responds with the last response.
+func (b *Balancer) broadcast(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var last *http.Response
+	var lastBody []byte
+	for _, r := range b.replicas {
+		out, err := http.NewRequestWithContext(req.Context(), req.Method, r.url.JoinPath(req.URL.Path).String(), bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out.Header = req.Header.Clone()
+		resp, err := b.client.Do(out)
+		if err != nil {
+			continue
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		last, lastBody = resp, respBody
+		if resp.StatusCode < 300 && req.URL.Path != "/shutdown" {
+			break
+		}
+	}
+	if last == nil {
+		http.Error(w, "No replica responded", http.StatusBadGateway)
+		return
+	}
+	for key, values := range last.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(last.StatusCode)
+	_, _ = w.Write(lastBody)
+}
+
+func (b *Balancer) get(ctx context.Context, r *replica, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url.JoinPath(path).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func jsonEqual(a []byte, b []byte) bool {
+	var valueA, valueB any
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return bytes.Equal(a, b)
+	}
+	encodedA, _ := json.Marshal(valueA)
+	encodedB, _ := json.Marshal(valueB)
+	return bytes.Equal(encodedA, encodedB)
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReplica struct {
+	server      *httptest.Server
+	status      atomic.Value
+	predictions atomic.Int64
+	schema      string
+}
+
+func newFakeReplica(t *testing.T, schema string) *fakeReplica {
+	t.Helper()
+	f := &fakeReplica{schema: schema}
+	f.status.Store(StatusReady)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health-check", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status": %q}`, f.status.Load())
+	})
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, f.schema)
+	})
+	mux.HandleFunc("/predictions", func(w http.ResponseWriter, r *http.Request) {
+		f.predictions.Add(1)
+		fmt.Fprint(w, `{"status": "succeeded"}`)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func newTestBalancer(t *testing.T, strategy Strategy, replicas ...*fakeReplica) *httptest.Server {
+	t.Helper()
+	urls := []string{}
+	for _, r := range replicas {
+		urls = append(urls, r.server.URL)
+	}
+	b, err := NewBalancer(urls, strategy)
+	require.NoError(t, err)
+	b.checkHealth(context.Background())
+	server := httptest.NewServer(b)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	a, b, c := newFakeReplica(t, "{}"), newFakeReplica(t, "{}"), newFakeReplica(t, "{}")
+	c.status.Store(StatusSetupFailed)
+	server := newTestBalancer(t, RoundRobin, a, b, c)
+
+	for range 4 {
+		resp, err := http.Post(server.URL+"/predictions", "application/json", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	require.Equal(t, int64(2), a.predictions.Load())
+	require.Equal(t, int64(2), b.predictions.Load())
+	require.Equal(t, int64(0), c.predictions.Load())
+}
+
+func TestBalancerPrefersIdleReplicas(t *testing.T) {
+	for _, strategy := range []Strategy{RoundRobin, LeastBusy} {
+		busy, idle := newFakeReplica(t, "{}"), newFakeReplica(t, "{}")
+		busy.status.Store(StatusBusy)
+		server := newTestBalancer(t, strategy, busy, idle)
+
+		for range 3 {
+			resp, err := http.Post(server.URL+"/predictions", "application/json", nil)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		require.Equal(t, int64(0), busy.predictions.Load(), strategy)
+		require.Equal(t, int64(3), idle.predictions.Load(), strategy)
+	}
+
+	// Busy replicas are still used when none are idle
+	busy := newFakeReplica(t, "{}")
+	busy.status.Store(StatusBusy)
+	server := newTestBalancer(t, RoundRobin, busy)
+	resp, err := http.Post(server.URL+"/predictions", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, int64(1), busy.predictions.Load())
+}
+
+func TestBalancerHealthCheck(t *testing.T) {
+	a, b := newFakeReplica(t, "{}"), newFakeReplica(t, "{}")
+	a.status.Store(StatusStarting)
+	b.status.Store(StatusBusy)
+	server := newTestBalancer(t, LeastBusy, a, b)
+
+	resp, err := http.Get(server.URL + "/health-check")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	health := struct {
+		Status   string   `json:"status"`
+		Replicas []string `json:"replicas"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	require.Equal(t, StatusBusy, health.Status)
+	require.Equal(t, []string{StatusStarting, StatusBusy}, health.Replicas)
+}
+
+func TestBalancerNoReplicaReady(t *testing.T) {
+	a := newFakeReplica(t, "{}")
+	a.status.Store(StatusStarting)
+	server := newTestBalancer(t, LeastBusy, a)
+
+	resp, err := http.Post(server.URL+"/predictions", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestBalancerOpenAPI(t *testing.T) {
+	server := newTestBalancer(t, LeastBusy, newFakeReplica(t, `{"openapi": "3.0.2"}`), newFakeReplica(t, `{ "openapi":"3.0.2" }`))
+	resp, err := http.Get(server.URL + "/openapi.json")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"openapi": "3.0.2"}`, string(body))
+
+	server = newTestBalancer(t, LeastBusy, newFakeReplica(t, `{"openapi": "3.0.2"}`), newFakeReplica(t, `{"openapi": "3.1.0"}`))
+	resp, err = http.Get(server.URL + "/openapi.json")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestParseStrategy(t *testing.T) {
+	strategy, err := ParseStrategy("least-busy")
+	require.NoError(t, err)
+	require.Equal(t, LeastBusy, strategy)
+	_, err = ParseStrategy("random")
+	require.ErrorContains(t, err, "Invalid routing strategy")
+}
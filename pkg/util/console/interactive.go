@@ -11,10 +11,12 @@ import (
 )
 
 type Interactive struct {
-	Prompt   string
-	Default  string
-	Options  []string
-	Required bool
+	Prompt string
+	// Description is shown on the line before the prompt
+	Description string
+	Default     string
+	Options     []string
+	Required    bool
 }
 
 func (i Interactive) Read() (string, error) {
@@ -43,6 +45,9 @@ func (i Interactive) Read() (string, error) {
 	}
 
 	for {
+		if i.Description != "" {
+			fmt.Println(i.Description)
+		}
 		fmt.Printf("%s%s: ", i.Prompt, parens)
 		reader := bufio.NewReader(os.Stdin)
 		text, err := reader.ReadString('\n')
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
@@ -114,26 +116,77 @@ func WriteDataURLToFile(url string, destination string) (string, error) {
 	}
 	output := dataurlObj.Data
 
-	ext := path.Ext(destination)
-	dir := path.Dir(destination)
-	name := r8_path.TrimExt(path.Base(destination))
+	path, err := WriteFile(output, WithDefaultExt(destination, mime.ExtensionByType(dataurlObj.ContentType())))
+	if err != nil {
+		return "", err
+	}
 
-	// Check if ext is an integer, in which case ignore it...
-	if r8_path.IsExtInteger(ext) {
-		ext = ""
-		name = path.Base(destination)
+	return path, nil
+}
+
+// WriteURLToFile writes the file at fileURL to destination, and returns the path
+// it was written to. fileURL is a data URL or an HTTP URL that is downloaded.
+func WriteURLToFile(fileURL string, destination string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return WriteDataURLToFile(fileURL, destination)
 	}
 
-	if ext == "" {
-		ext = mime.ExtensionByType(dataurlObj.ContentType())
+	resp, err := http.Get(fileURL) // #nosec G107 - the URL is an output of the model
+	if err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", fileURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to download %s: status %d", fileURL, resp.StatusCode)
 	}
 
-	path, err := WriteFile(output, path.Join(dir, name+ext))
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = mime.ExtensionByType(resp.Header.Get("Content-Type"))
+	}
+	outputPath, err := homedir.Expand(WithDefaultExt(destination, ext))
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Create(outputPath)
 	if err != nil {
 		return "", err
 	}
+	defer out.Close()
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", fileURL, err)
+	}
+	return outputPath, out.Close()
+}
 
-	return path, nil
+// MoveFile moves src to dest, copying it if they are on different filesystems.
+func MoveFile(src string, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	if err := CopyFile(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// WithDefaultExt adds ext to destination if it doesn't have an extension.
+func WithDefaultExt(destination string, ext string) string {
+	destinationExt := path.Ext(destination)
+	dir := path.Dir(destination)
+	name := r8_path.TrimExt(path.Base(destination))
+
+	// Check if ext is an integer, in which case ignore it...
+	if r8_path.IsExtInteger(destinationExt) {
+		destinationExt = ""
+		name = path.Base(destination)
+	}
+
+	if destinationExt == "" {
+		destinationExt = ext
+	}
+	return path.Join(dir, name+destinationExt)
 }
 
 func WriteFile(output []byte, outputPath string) (string, error) {
@@ -1,6 +1,8 @@
 package files
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -32,3 +34,19 @@ func TestWriteNotRecognisedBase64DataURL(t *testing.T) {
 	_, err := WriteDataURLToFile("data:None;model/gltf-binary,SGVsbG8gVGhlcmU=", path)
 	require.NoError(t, err)
 }
+
+func TestWriteURLToFileDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path, err := WriteURLToFile(server.URL+"/files/out", filepath.Join(dir, "output"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "output.txt"), path)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+}